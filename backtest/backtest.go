@@ -0,0 +1,322 @@
+// Package backtest runs trading strategy over pairs and pool reserves recorded by replay.Recorder, offline and deterministically:
+// simulation is driven by recorded times only, so the same recording and strategy always give the same report.
+package backtest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc/ws"
+	"github.com/patrulek/rayscan/config"
+	"github.com/patrulek/rayscan/onchain"
+	"github.com/patrulek/rayscan/onchain/raydium"
+	"github.com/patrulek/rayscan/replay"
+	"github.com/patrulek/rayscan/trading"
+)
+
+// Strategy defines which pairs are entered, with how many lamports, and when positions are closed.
+type Strategy struct {
+	EntryRules   []trading.EntryRule
+	EntryAmount  float64 // In lamports.
+	ExitRules    []trading.ExitRule
+	Latency      time.Duration // Delay between decision and fill.
+	PollInterval time.Duration // How often exit rules are evaluated.
+}
+
+// StrategyFromConfig creates strategy of paper trading with given config.
+func StrategyFromConfig(cfg config.Trading) Strategy {
+	return Strategy{
+		EntryRules:   trading.EntryRulesFromConfig(cfg),
+		EntryAmount:  float64(cfg.EntryAmount),
+		ExitRules:    trading.ExitRulesFromConfig(cfg),
+		Latency:      cfg.Latency,
+		PollInterval: cfg.PollInterval,
+	}
+}
+
+// Pair is a pair found in recording, with time its pool was seen by the first observer.
+type Pair struct {
+	Info *onchain.PairInfo
+	Time time.Time
+}
+
+// Pairs finds pairs in recorded logs. Logs are analyzed one by one with recorded RPC responses, so pipeline config
+// has to be the same as while recording (eg. commitments), otherwise transactions won't be found.
+func Pairs(player *replay.Player, cfg config.Pipeline) ([]Pair, error) {
+	// Recorded responses are served at once; only missing ones would be retried, and they never appear.
+	cfg.NotFoundRetryDelay = 0
+	cfg.AnalyzeTimeout = min(cfg.AnalyzeTimeout, time.Second)
+
+	rpcPool := player.RPCPool()
+	dedup := onchain.NewSignatureDedup(cfg)
+
+	observers := make(map[string]*onchain.LogObserver)
+	for _, name := range player.Connections() {
+		observers[name] = onchain.NewLogObserver(rpcPool, name, cfg, dedup, onchain.DefaultSubscriptions())
+		dedup.Register(name)
+	}
+
+	analyzer := onchain.NewTxAnalyzer(rpcPool, cfg)
+	collector := onchain.NewPairCollector(cfg)
+
+	pairC := make(chan *onchain.PairInfo, cfg.ChannelSize)
+	collector.Start([]chan<- *onchain.PairInfo{pairC}, nil)
+
+	var infos []*onchain.PairInfo
+	doneC := make(chan struct{})
+	go func() {
+		defer close(doneC)
+
+		for pair := range pairC {
+			infos = append(infos, pair)
+		}
+	}()
+
+	seen := make(map[solana.Signature]time.Time) // Time signature was recorded first.
+	candidateC := make(chan onchain.TxCandidate, 1)
+
+	for _, rec := range player.Logs() {
+		var log ws.LogResult
+		if err := json.Unmarshal(rec.Log, &log); err != nil {
+			return nil, fmt.Errorf("error parsing recorded log: %w", err)
+		}
+
+		if _, ok := seen[log.Value.Signature]; !ok {
+			seen[log.Value.Signature] = rec.Time
+		}
+
+		observers[rec.Connection].HandleLog(rec.Program, &log, candidateC)
+
+		select {
+		case candidate := <-candidateC:
+			analyzer.Analyze(candidate, collector.Channel())
+		default:
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	if err := collector.Stop(ctx); err != nil {
+		return nil, err
+	}
+
+	if n := collector.Dropped(); n > 0 {
+		return nil, fmt.Errorf("%d pairs dropped by collector", n) // Report would depend on timing.
+	}
+
+	close(pairC)
+	<-doneC
+
+	pairs := make([]Pair, 0, len(infos))
+	for _, info := range infos {
+		at, ok := seen[info.AmmInfo.TxID]
+		if !ok {
+			at = info.AmmInfo.TxTime
+		}
+
+		info.Readiness = at
+		pairs = append(pairs, Pair{Info: info, Time: at})
+	}
+
+	return pairs, nil
+}
+
+// Run simulates strategy over pairs seen within [from, to); zero time means no bound. Positions are entered when pool
+// opens (or when pair is seen, if later) and then tracked with recorded reserves until they're closed or history ends.
+// Pairs without recorded reserves can't be tracked, so they're only counted as unsimulated.
+func Run(pairs []Pair, history *ReserveHistory, strategy Strategy, from, to time.Time) Report {
+	pairs = append([]Pair(nil), pairs...)
+	sort.SliceStable(pairs, func(i, j int) bool {
+		if !pairs[i].Time.Equal(pairs[j].Time) {
+			return pairs[i].Time.Before(pairs[j].Time)
+		}
+		return pairs[i].Info.TokenAddress().String() < pairs[j].Info.TokenAddress().String()
+	})
+
+	if strategy.PollInterval <= 0 {
+		strategy.PollInterval = time.Second
+	}
+
+	end := history.End()
+	for _, pair := range pairs {
+		if pair.Time.After(end) {
+			end = pair.Time
+		}
+	}
+
+	r := &run{
+		history:   history,
+		strategy:  strategy,
+		end:       end,
+		entryRule: make(map[string]*RuleStats),
+		exitRule:  make(map[string]*RuleStats),
+	}
+
+	report := Report{From: from, To: to}
+	for _, pair := range pairs {
+		if (!from.IsZero() && pair.Time.Before(from)) || (!to.IsZero() && !pair.Time.Before(to)) {
+			continue
+		}
+
+		if !history.Recorded(pair.Info.AmmInfo.PoolCoinTokenAccount, pair.Info.AmmInfo.PoolPcTokenAccount) {
+			report.Unsimulated++
+			continue
+		}
+
+		report.Pairs++
+		r.trade(pair)
+	}
+
+	r.report(&report)
+	return report
+}
+
+// run holds state of single simulation.
+type run struct {
+	history  *ReserveHistory
+	strategy Strategy
+	end      time.Time
+
+	positions []*trading.Position
+	trades    []Trade
+	entryRule map[string]*RuleStats
+	exitRule  map[string]*RuleStats
+}
+
+// reserves returns recorded reserves of pair's pool at given time, or its initial reserves if none were recorded yet.
+func (r *run) reserves(pair *onchain.PairInfo, at time.Time) raydium.AmmLiveInfo {
+	if live, ok := r.history.At(pair.AmmInfo.PoolCoinTokenAccount, pair.AmmInfo.PoolPcTokenAccount, at); ok {
+		return live
+	}
+
+	return pair.AmmInfo.InitialLiveInfo
+}
+
+// openPositions returns number of positions held at given time.
+func (r *run) openPositions(at time.Time) int {
+	count := 0
+	for _, p := range r.positions {
+		if !p.OpenTime.After(at) && (p.Status == trading.PositionOpen || p.CloseTime.After(at)) {
+			count++
+		}
+	}
+
+	return count
+}
+
+// checkEntry returns name of the first entry rule pair doesn't pass at given time, or empty string.
+func (r *run) checkEntry(pair *onchain.PairInfo, at time.Time) string {
+	openPositions := r.openPositions(at)
+	for _, rule := range r.strategy.EntryRules {
+		if err := rule.Check(pair, openPositions, at); err != nil {
+			return ruleName(rule)
+		}
+	}
+
+	return ""
+}
+
+// trade enters pair if it passes entry rules, as paper engine does, and tracks the position until it's closed.
+func (r *run) trade(pair Pair) {
+	info := pair.Info
+	if rule := r.checkEntry(info, pair.Time); rule != "" {
+		r.rule(r.entryRule, rule).Rejected++
+		return
+	}
+
+	decision := pair.Time
+	if open := info.AmmInfo.InitialLiveInfo.UpdateTime; open.After(decision) {
+		decision = open // Pool cannot be swapped before its open time.
+	}
+
+	filled := decision.Add(r.strategy.Latency)
+
+	// Rules are evaluated again at fill time, like paper engine does after waiting.
+	if rule := r.checkEntry(info, filled); rule != "" {
+		r.rule(r.entryRule, rule).Rejected++
+		return
+	}
+
+	expected := r.reserves(info, pair.Time)
+	live := r.reserves(info, filled)
+	tokensOut := live.QuoteBuy(r.strategy.EntryAmount)
+	if tokensOut == 0 {
+		r.rule(r.entryRule, "NoLiquidity").Rejected++
+		return
+	}
+
+	position := &trading.Position{
+		Token:           info.TokenAddress(),
+		AmmID:           info.AmmInfo.AmmID,
+		TokenVault:      info.AmmInfo.PoolCoinTokenAccount,
+		CurrencyVault:   info.AmmInfo.PoolPcTokenAccount,
+		Status:          trading.PositionOpen,
+		OpenTime:        filled,
+		Cost:            r.strategy.EntryAmount,
+		Size:            tokensOut,
+		CurrentLiveInfo: live,
+		Fills:           []trading.Fill{{Side: trading.SideBuy, Time: filled, AmountIn: r.strategy.EntryAmount, AmountOut: tokensOut, Paper: true}},
+	}
+	position.PeakValue = position.Value()
+
+	trade := Trade{Seen: pair.Time}
+	trade.Fills = append(trade.Fills, newFill(position.Fills[0], expected.QuoteBuy(r.strategy.EntryAmount)))
+
+	r.positions = append(r.positions, position)
+	r.track(info, position, &trade)
+	r.trades = append(r.trades, trade)
+}
+
+// track evaluates exit rules every poll interval and closes position when any of them is met.
+func (r *run) track(pair *onchain.PairInfo, position *trading.Position, trade *Trade) {
+	for now := position.OpenTime.Add(r.strategy.PollInterval); !now.After(r.end); now = now.Add(r.strategy.PollInterval) {
+		position.CurrentLiveInfo = r.reserves(pair, now)
+		if value := position.Value(); value > position.PeakValue {
+			position.PeakValue = value
+		}
+
+		for _, rule := range r.strategy.ExitRules {
+			exit, reason := rule.ShouldExit(position, now)
+			if !exit {
+				continue
+			}
+
+			expected := position.Value()
+			closed := now.Add(r.strategy.Latency)
+			position.CurrentLiveInfo = r.reserves(pair, closed)
+			lamportsOut := position.Value()
+
+			fill := trading.Fill{Side: trading.SideSell, Time: closed, AmountIn: position.Size, AmountOut: lamportsOut, Paper: true}
+			position.Fills = append(position.Fills, fill)
+			position.Proceeds = lamportsOut
+			position.Status = trading.PositionClosed
+			position.CloseTime = closed
+			position.ExitReason = reason
+
+			trade.Fills = append(trade.Fills, newFill(fill, expected))
+			trade.ExitRule = ruleName(rule)
+			return
+		}
+	}
+}
+
+func (r *run) rule(rules map[string]*RuleStats, name string) *RuleStats {
+	stats, ok := rules[name]
+	if !ok {
+		stats = &RuleStats{Rule: name}
+		rules[name] = stats
+	}
+
+	return stats
+}
+
+// ruleName returns name of rule type, eg. "TakeProfit".
+func ruleName(rule interface{}) string {
+	return reflect.TypeOf(rule).Name()
+}
@@ -0,0 +1,233 @@
+package backtest
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/patrulek/rayscan/onchain"
+	"github.com/patrulek/rayscan/onchain/raydium"
+	"github.com/patrulek/rayscan/replay"
+	"github.com/patrulek/rayscan/trading"
+)
+
+var start = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func testKey(seed byte) solana.PublicKey {
+	var key solana.PublicKey
+	for i := range key {
+		key[i] = seed
+	}
+
+	return key
+}
+
+// testPair returns pair seen at given offset from start, with pool open at the same time and given initial reserves.
+func testPair(seed byte, at time.Duration, lamports, tokens float64) Pair {
+	info := &onchain.PairInfo{}
+	info.MarketInfo.BaseMint = testKey(seed)
+	info.AmmInfo.AmmID = testKey(seed + 1)
+	info.AmmInfo.PoolCoinTokenAccount = testKey(seed + 2)
+	info.AmmInfo.PoolPcTokenAccount = testKey(seed + 3)
+	info.AmmInfo.InitialLiveInfo = raydium.AmmLiveInfo{UpdateTime: start.Add(at), PooledLamports: lamports, PooledToken: tokens, Price: tokens / lamports}
+
+	return Pair{Info: info, Time: start.Add(at)}
+}
+
+// addReserves adds reserves of pair's pool at given offset from start.
+func addReserves(h *ReserveHistory, pair Pair, at time.Duration, lamports, tokens float64) {
+	h.Add(pair.Info.AmmInfo.PoolCoinTokenAccount, start.Add(at), tokens)
+	h.Add(pair.Info.AmmInfo.PoolPcTokenAccount, start.Add(at), lamports)
+}
+
+func testStrategy() Strategy {
+	return Strategy{
+		EntryRules:   []trading.EntryRule{trading.MinLiquidity(10e9), trading.MaxOpenPositions(1)},
+		EntryAmount:  1e9,
+		ExitRules:    []trading.ExitRule{trading.TakeProfit(0.5), trading.StopLoss(0.3)},
+		PollInterval: time.Second,
+	}
+}
+
+func testRecording() ([]Pair, *ReserveHistory) {
+	winner := testPair(10, 0, 100e9, 1e9)
+	skipped := testPair(20, 2*time.Second, 100e9, 1e9) // Winner is still open.
+	small := testPair(30, 10*time.Second, 5e9, 1e9)
+	loser := testPair(40, 20*time.Second, 100e9, 1e9)
+
+	h := NewReserveHistory()
+	addReserves(h, winner, 0, 100e9, 1e9)
+	addReserves(h, winner, 5*time.Second, 300e9, 0.34e9)
+	addReserves(h, skipped, 2*time.Second, 100e9, 1e9)
+	addReserves(h, small, 10*time.Second, 5e9, 1e9)
+	addReserves(h, loser, 20*time.Second, 100e9, 1e9)
+	addReserves(h, loser, 25*time.Second, 50e9, 2e9)
+
+	return []Pair{loser, small, skipped, winner}, h
+}
+
+func TestRunReport(t *testing.T) {
+	pairs, history := testRecording()
+	report := Run(pairs, history, testStrategy(), time.Time{}, time.Time{})
+
+	if report.Pairs != 4 || len(report.Trades) != 2 || report.Fills != 4 {
+		t.Fatalf("unexpected report (pairs: %d, trades: %d, fills: %d)", report.Pairs, len(report.Trades), report.Fills)
+	}
+
+	if report.Closed != 2 || report.Wins != 1 || report.WinRate != 0.5 {
+		t.Fatalf("unexpected results (closed: %d, wins: %d, win rate: %v)", report.Closed, report.Wins, report.WinRate)
+	}
+
+	winner, loser := report.Trades[0], report.Trades[1]
+	if winner.ExitRule != "TakeProfit" || !winner.CloseTime.Equal(start.Add(5*time.Second)) || winner.PnL <= 0 {
+		t.Fatalf("unexpected winner trade: %+v", winner)
+	}
+
+	if loser.ExitRule != "StopLoss" || !loser.CloseTime.Equal(start.Add(25*time.Second)) || loser.PnL >= 0 {
+		t.Fatalf("unexpected loser trade: %+v", loser)
+	}
+
+	if pnl := winner.PnL + loser.PnL; report.TotalPnL != pnl {
+		t.Fatalf("expected total pnl %v, got %v", pnl, report.TotalPnL)
+	}
+
+	wantEntry := []RuleStats{{Rule: "MinLiquidity", Rejected: 1}, {Rule: "MaxOpenPositions", Rejected: 1}}
+	if !reflect.DeepEqual(report.EntryRules, wantEntry) {
+		t.Fatalf("unexpected entry rules: %+v", report.EntryRules)
+	}
+
+	wantExit := []RuleStats{{Rule: "TakeProfit", Trades: 1, Wins: 1, PnL: winner.PnL}, {Rule: "StopLoss", Trades: 1, PnL: loser.PnL}}
+	if !reflect.DeepEqual(report.ExitRules, wantExit) {
+		t.Fatalf("unexpected exit rules: %+v", report.ExitRules)
+	}
+
+	buckets := 0
+	for _, b := range report.Returns.Buckets {
+		buckets += b.Count
+	}
+
+	if buckets != 2 || report.Returns.P10 != loser.Return || report.Returns.P90 != winner.Return {
+		t.Fatalf("unexpected returns distribution: %+v", report.Returns)
+	}
+}
+
+func TestRunIsDeterministic(t *testing.T) {
+	pairs, history := testRecording()
+	first := Run(pairs, history, testStrategy(), time.Time{}, time.Time{})
+
+	// Order of pairs doesn't matter; they're simulated by time.
+	for i, j := 0, len(pairs)-1; i < j; i, j = i+1, j-1 {
+		pairs[i], pairs[j] = pairs[j], pairs[i]
+	}
+
+	if second := Run(pairs, history, testStrategy(), time.Time{}, time.Time{}); !reflect.DeepEqual(first, second) {
+		t.Fatalf("reports differ:\n%+v\n%+v", first, second)
+	}
+}
+
+func TestRunRange(t *testing.T) {
+	pairs, history := testRecording()
+	report := Run(pairs, history, testStrategy(), start.Add(2*time.Second), start.Add(20*time.Second))
+
+	// Skipped pair is entered, as winner is out of range; loser is out of range.
+	if report.Pairs != 2 || len(report.Trades) != 1 || report.Trades[0].Token != testKey(20).String() {
+		t.Fatalf("unexpected report (pairs: %d, trades: %+v)", report.Pairs, report.Trades)
+	}
+
+	if report.Trades[0].Status != trading.PositionOpen || report.ExitRules[len(report.ExitRules)-1].Rule != "Open" {
+		t.Fatalf("expected trade with unchanged reserves to stay open: %+v", report.Trades[0])
+	}
+}
+
+func TestRunSkipsPairsWithoutReserves(t *testing.T) {
+	pairs, history := testRecording()
+	unrecorded := testPair(50, 30*time.Second, 100e9, 1e9) // Would pass entry rules at its initial reserves.
+
+	report := Run(append(pairs, unrecorded), history, testStrategy(), start.Add(30*time.Second), time.Time{})
+	if report.Pairs != 0 || report.Unsimulated != 1 || len(report.Trades) != 0 {
+		t.Fatalf("expected pair without reserves to be left out (pairs: %d, unsimulated: %d, trades: %+v)", report.Pairs, report.Unsimulated, report.Trades)
+	}
+}
+
+func TestRunSlippage(t *testing.T) {
+	pair := testPair(10, 0, 100e9, 1e9)
+
+	h := NewReserveHistory()
+	addReserves(h, pair, 0, 100e9, 1e9)
+	addReserves(h, pair, time.Second, 200e9, 0.5e9) // Price doubled before fill.
+
+	strategy := testStrategy()
+	strategy.Latency = 2 * time.Second
+
+	report := Run([]Pair{pair}, h, strategy, time.Time{}, time.Time{})
+	if len(report.Trades) != 1 {
+		t.Fatalf("expected 1 trade, got %d", len(report.Trades))
+	}
+
+	buy := report.Trades[0].Fills[0]
+	if !buy.Time.Equal(start.Add(2*time.Second)) || buy.Slippage < 0.7 || buy.Slippage > 0.8 {
+		t.Fatalf("unexpected buy fill: %+v", buy)
+	}
+
+	if report.MaxSlippage != buy.Slippage {
+		t.Fatalf("expected max slippage %v, got %v", buy.Slippage, report.MaxSlippage)
+	}
+}
+
+func TestHistoryFromPlayer(t *testing.T) {
+	vault := testKey(1)
+	balance := func(at time.Duration, amount string) replay.Record {
+		params, _ := json.Marshal([]interface{}{vault.String(), map[string]string{"commitment": "processed"}})
+		return replay.Record{
+			Kind:       replay.KindRPC,
+			Time:       start.Add(at),
+			Connection: "node",
+			Method:     "getTokenAccountBalance",
+			Params:     params,
+			Result:     json.RawMessage(`{"context":{"slot":1},"value":{"amount":"` + amount + `","decimals":6,"uiAmountString":"0"}}`),
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "recording.jsonl")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	enc := json.NewEncoder(f)
+	for _, rec := range []replay.Record{balance(2*time.Second, "200"), balance(0, "100")} {
+		if err := enc.Encode(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f.Close()
+
+	player, err := replay.LoadPlayer(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := HistoryFromPlayer(player)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		at     time.Duration
+		amount float64
+		ok     bool
+	}{{-time.Second, 0, false}, {0, 100, true}, {time.Second, 100, true}, {3 * time.Second, 200, true}} {
+		b, ok := h.balance(vault, start.Add(c.at))
+		if ok != c.ok || b.amount != c.amount {
+			t.Fatalf("balance at %v: got %v (%v), want %v (%v)", c.at, b.amount, ok, c.amount, c.ok)
+		}
+	}
+
+	if !h.End().Equal(start.Add(2 * time.Second)) {
+		t.Fatalf("unexpected end: %v", h.End())
+	}
+}
@@ -0,0 +1,129 @@
+package backtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/patrulek/rayscan/onchain/raydium"
+	"github.com/patrulek/rayscan/replay"
+)
+
+// ReserveHistory holds balances of pool vaults over time, as read by position manager while recording.
+type ReserveHistory struct {
+	balances map[solana.PublicKey][]balance // Vault -> balances ordered by time
+	end      time.Time
+}
+
+type balance struct {
+	time   time.Time
+	amount float64
+}
+
+func NewReserveHistory() *ReserveHistory {
+	return &ReserveHistory{balances: make(map[solana.PublicKey][]balance)}
+}
+
+// HistoryFromPlayer creates history of vault balances from recorded getTokenAccountBalance responses.
+func HistoryFromPlayer(player *replay.Player) (*ReserveHistory, error) {
+	h := NewReserveHistory()
+
+	for _, rec := range player.Responses("getTokenAccountBalance") {
+		if rec.RPCError != nil || rec.Error != "" {
+			continue
+		}
+
+		var params []json.RawMessage
+		if err := json.Unmarshal(rec.Params, &params); err != nil || len(params) == 0 {
+			return nil, fmt.Errorf("invalid getTokenAccountBalance params: %s", rec.Params)
+		}
+
+		var vault solana.PublicKey
+		if err := json.Unmarshal(params[0], &vault); err != nil {
+			return nil, fmt.Errorf("invalid vault address: %w", err)
+		}
+
+		var result rpc.GetTokenAccountBalanceResult
+		if err := json.Unmarshal(rec.Result, &result); err != nil {
+			return nil, fmt.Errorf("invalid balance of vault %s: %w", vault, err)
+		}
+
+		if result.Value == nil {
+			continue
+		}
+
+		amount, err := strconv.ParseFloat(result.Value.Amount, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid balance of vault %s: %w", vault, err)
+		}
+
+		h.Add(vault, rec.Time, amount)
+	}
+
+	return h, nil
+}
+
+// Add adds balance of vault at given time.
+func (h *ReserveHistory) Add(vault solana.PublicKey, at time.Time, amount float64) {
+	balances := h.balances[vault]
+	i := sort.Search(len(balances), func(i int) bool { return balances[i].time.After(at) })
+
+	balances = append(balances, balance{})
+	copy(balances[i+1:], balances[i:])
+	balances[i] = balance{time: at, amount: amount}
+	h.balances[vault] = balances
+
+	if at.After(h.end) {
+		h.end = at
+	}
+}
+
+// Recorded returns true if balances of both vaults of pool were recorded.
+func (h *ReserveHistory) Recorded(tokenVault, currencyVault solana.PublicKey) bool {
+	return len(h.balances[tokenVault]) > 0 && len(h.balances[currencyVault]) > 0
+}
+
+// End returns time of the latest balance.
+func (h *ReserveHistory) End() time.Time {
+	return h.end
+}
+
+// At returns reserves of pool with given vaults made of their latest balances not later than given time;
+// false is returned if any of vaults has no balance by then.
+func (h *ReserveHistory) At(tokenVault, currencyVault solana.PublicKey, at time.Time) (raydium.AmmLiveInfo, bool) {
+	token, ok := h.balance(tokenVault, at)
+	if !ok {
+		return raydium.AmmLiveInfo{}, false
+	}
+
+	currency, ok := h.balance(currencyVault, at)
+	if !ok || token.amount == 0 || currency.amount == 0 {
+		return raydium.AmmLiveInfo{}, false
+	}
+
+	updated := token.time
+	if currency.time.After(updated) {
+		updated = currency.time
+	}
+
+	return raydium.AmmLiveInfo{
+		UpdateTime:     updated,
+		PooledLamports: currency.amount,
+		PooledToken:    token.amount,
+		Price:          token.amount / currency.amount,
+	}, true
+}
+
+func (h *ReserveHistory) balance(vault solana.PublicKey, at time.Time) (balance, bool) {
+	balances := h.balances[vault]
+	i := sort.Search(len(balances), func(i int) bool { return balances[i].time.After(at) })
+	if i == 0 {
+		return balance{}, false
+	}
+
+	return balances[i-1], true
+}
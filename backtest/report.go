@@ -0,0 +1,204 @@
+package backtest
+
+import (
+	"encoding/json"
+	"math"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/patrulek/rayscan/trading"
+)
+
+// Report summarizes backtest; PnL statistics are calculated over closed positions only, as in trading.Ledger.
+type Report struct {
+	From, To    time.Time // Range of pair times; zero if unbounded.
+	Pairs       int       // Pairs seen within range and simulated.
+	Unsimulated int       // Pairs seen within range without recorded reserves; they're left out of the report.
+
+	Trades      []Trade
+	Closed      int
+	Wins        int
+	WinRate     float64
+	TotalPnL    float64 // Lamports.
+	MaxDrawdown float64 // Lamports.
+
+	Fills        int
+	MeanSlippage float64 // Mean fraction of expected amount lost between decision and fill.
+	MaxSlippage  float64
+
+	Returns Distribution
+
+	EntryRules []RuleStats // Pairs rejected by every entry rule.
+	ExitRules  []RuleStats // Positions closed by every exit rule; still open ones are counted as "Open".
+}
+
+// Trade is a single entered position.
+type Trade struct {
+	Token      string
+	AmmID      string
+	Seen       time.Time // Time pair was seen by the first observer.
+	Status     trading.PositionStatus
+	OpenTime   time.Time
+	CloseTime  time.Time
+	Cost       float64
+	Proceeds   float64
+	PnL        float64 // Realized for closed positions, unrealized for open ones.
+	Return     float64
+	ExitRule   string
+	ExitReason string
+	Fills      []Fill
+}
+
+// Fill is a simulated swap with amount it was expected to give when decision was made.
+type Fill struct {
+	trading.Fill
+	Expected float64
+	Slippage float64 // Fraction of expected amount not received; negative if fill was better than expected.
+}
+
+func newFill(fill trading.Fill, expected float64) Fill {
+	f := Fill{Fill: fill, Expected: expected}
+	if expected > 0 {
+		f.Slippage = (expected - fill.AmountOut) / expected
+	}
+
+	return f
+}
+
+// Distribution describes returns of closed positions, as fractions of their cost.
+type Distribution struct {
+	P10, P50, P90 float64
+	Buckets       []Bucket
+}
+
+type Bucket struct {
+	Range string
+	Count int
+}
+
+// Return ranges of distribution buckets; first and last ones are unbounded.
+var bucketBounds = []struct {
+	label string
+	max   float64
+}{
+	{"< -50%", -0.5},
+	{"-50% to -10%", -0.1},
+	{"-10% to 0%", 0},
+	{"0% to 10%", 0.1},
+	{"10% to 50%", 0.5},
+	{"50% to 100%", 1},
+	{">= 100%", math.Inf(1)},
+}
+
+// RuleStats is contribution of a single rule.
+type RuleStats struct {
+	Rule     string
+	Rejected int     `json:",omitempty"` // Entry rules only.
+	Trades   int     `json:",omitempty"` // Exit rules only.
+	Wins     int     `json:",omitempty"`
+	PnL      float64 `json:",omitempty"`
+}
+
+func (r *run) report(report *Report) {
+	positions := make([]trading.Position, len(r.positions))
+	for i, p := range r.positions {
+		positions[i] = *p
+
+		trade := &r.trades[i]
+		trade.Token, trade.AmmID = p.Token.String(), p.AmmID.String()
+		trade.Status, trade.OpenTime, trade.CloseTime = p.Status, p.OpenTime, p.CloseTime
+		trade.Cost, trade.Proceeds, trade.PnL = p.Cost, p.Proceeds, p.PnL()
+		trade.ExitReason = p.ExitReason
+		if p.Cost > 0 {
+			trade.Return = trade.PnL / p.Cost
+		}
+
+		if p.Status == trading.PositionOpen {
+			trade.ExitRule = "Open"
+		}
+
+		stats := r.rule(r.exitRule, trade.ExitRule)
+		stats.Trades++
+		stats.PnL += trade.PnL
+		if trade.PnL > 0 {
+			stats.Wins++
+		}
+	}
+
+	ledger := trading.NewLedger(positions)
+	report.Trades = r.trades
+	report.Closed, report.Wins, report.WinRate = ledger.Trades, ledger.Wins, ledger.WinRate
+	report.TotalPnL, report.MaxDrawdown = ledger.TotalPnL, ledger.MaxDrawdown
+
+	var returns []float64
+	for _, trade := range r.trades {
+		for _, fill := range trade.Fills {
+			report.Fills++
+			report.MeanSlippage += fill.Slippage
+			report.MaxSlippage = math.Max(report.MaxSlippage, fill.Slippage)
+		}
+
+		if trade.Status == trading.PositionClosed {
+			returns = append(returns, trade.Return)
+		}
+	}
+
+	if report.Fills > 0 {
+		report.MeanSlippage /= float64(report.Fills)
+	}
+
+	report.Returns = distribution(returns)
+
+	for _, rule := range r.strategy.EntryRules {
+		report.EntryRules = append(report.EntryRules, *r.rule(r.entryRule, ruleName(rule)))
+	}
+	if stats, ok := r.entryRule["NoLiquidity"]; ok {
+		report.EntryRules = append(report.EntryRules, *stats)
+	}
+
+	for _, rule := range r.strategy.ExitRules {
+		report.ExitRules = append(report.ExitRules, *r.rule(r.exitRule, ruleName(rule)))
+	}
+	if stats, ok := r.exitRule["Open"]; ok {
+		report.ExitRules = append(report.ExitRules, *stats)
+	}
+}
+
+func distribution(returns []float64) Distribution {
+	var d Distribution
+	for _, b := range bucketBounds {
+		d.Buckets = append(d.Buckets, Bucket{Range: b.label})
+	}
+
+	if len(returns) == 0 {
+		return d
+	}
+
+	sort.Float64s(returns)
+	percentile := func(p float64) float64 {
+		return returns[int(math.Ceil(p*float64(len(returns))))-1]
+	}
+
+	d.P10, d.P50, d.P90 = percentile(0.1), percentile(0.5), percentile(0.9)
+
+	for _, ret := range returns {
+		for i, b := range bucketBounds {
+			if ret < b.max {
+				d.Buckets[i].Count++
+				break
+			}
+		}
+	}
+
+	return d
+}
+
+func (r Report) ExportJSON(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,230 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Reason tells why entry was removed from cache.
+type Reason int
+
+const (
+	ReasonExpired Reason = iota // Entry was older than cache TTL.
+	ReasonEvicted               // Entry was least recently used one when cache was full.
+)
+
+func (r Reason) String() string {
+	switch r {
+	case ReasonExpired:
+		return "expired"
+	case ReasonEvicted:
+		return "evicted"
+	default:
+		return "unknown"
+	}
+}
+
+// Stats are counters of cache operations.
+type Stats struct {
+	Len     int
+	Size    int // Maximal number of entries; zero means unbounded.
+	Hits    uint64
+	Misses  uint64
+	Adds    uint64
+	Expired uint64
+	Evicted uint64
+}
+
+type entry[K comparable, V any] struct {
+	key   K
+	value V
+	added time.Time
+}
+
+// LRU is a map bounded by number of entries and their age. When full, least recently used entry is evicted;
+// entries older than TTL are treated as absent and removed on access or by Sweep.
+type LRU[K comparable, V any] struct {
+	size    int
+	ttl     time.Duration
+	onEvict func(K, V, Reason)
+
+	mu    sync.Mutex
+	items map[K]*list.Element
+	order *list.List // Front is the most recently used entry.
+	stats Stats
+}
+
+// New creates cache with given size and TTL; zero size means unbounded and zero TTL means entries never expire.
+// onEvict, if not nil, is called for every expired or evicted entry, but not for deleted ones.
+func New[K comparable, V any](size int, ttl time.Duration, onEvict func(K, V, Reason)) *LRU[K, V] {
+	return &LRU[K, V]{
+		size:    size,
+		ttl:     ttl,
+		onEvict: onEvict,
+		items:   make(map[K]*list.Element),
+		order:   list.New(),
+		stats:   Stats{Size: size},
+	}
+}
+
+// Add adds entry if there is no (unexpired) entry with given key and returns true if it did.
+func (c *LRU[K, V]) Add(key K, value V) bool {
+	_, added := c.GetOrAdd(key, value)
+	return added
+}
+
+// GetOrAdd returns value of unexpired entry with given key or, if there is none, adds given value and returns it.
+// Check and add are done atomically, so only one of concurrent callers with the same key adds the entry.
+func (c *LRU[K, V]) GetOrAdd(key K, value V) (V, bool) {
+	now := time.Now()
+	var removed []*entry[K, V]
+	var reasons []Reason
+
+	c.mu.Lock()
+	if elem, ok := c.items[key]; ok {
+		if !c.expired(elem, now) {
+			c.order.MoveToFront(elem)
+			c.stats.Hits++
+			actual := elem.Value.(*entry[K, V]).value
+			c.mu.Unlock()
+			return actual, false
+		}
+
+		removed, reasons = append(removed, c.remove(elem)), append(reasons, ReasonExpired)
+	}
+
+	c.items[key] = c.order.PushFront(&entry[K, V]{key: key, value: value, added: now})
+	c.stats.Adds++
+
+	for c.size > 0 && c.order.Len() > c.size {
+		removed, reasons = append(removed, c.remove(c.order.Back())), append(reasons, ReasonEvicted)
+	}
+	c.mu.Unlock()
+
+	c.notify(removed, reasons)
+	return value, true
+}
+
+// Get returns value of unexpired entry with given key.
+func (c *LRU[K, V]) Get(key K) (V, bool) {
+	var zero V
+	now := time.Now()
+
+	c.mu.Lock()
+	elem, ok := c.items[key]
+	if !ok {
+		c.stats.Misses++
+		c.mu.Unlock()
+		return zero, false
+	}
+
+	if c.expired(elem, now) {
+		c.stats.Misses++
+		removed := c.remove(elem)
+		c.mu.Unlock()
+
+		c.notify([]*entry[K, V]{removed}, []Reason{ReasonExpired})
+		return zero, false
+	}
+
+	c.order.MoveToFront(elem)
+	c.stats.Hits++
+	value := elem.Value.(*entry[K, V]).value
+	c.mu.Unlock()
+
+	return value, true
+}
+
+// Contains tells if there is unexpired entry with given key.
+func (c *LRU[K, V]) Contains(key K) bool {
+	_, ok := c.Get(key)
+	return ok
+}
+
+// Delete removes entry with given key without calling onEvict.
+func (c *LRU[K, V]) Delete(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[key]; ok {
+		c.remove(elem)
+	}
+}
+
+func (c *LRU[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.order.Len()
+}
+
+// Sweep removes all expired entries and returns their number.
+func (c *LRU[K, V]) Sweep() int {
+	if c.ttl <= 0 {
+		return 0
+	}
+
+	now := time.Now()
+	var removed []*entry[K, V]
+	var reasons []Reason
+
+	c.mu.Lock()
+	for elem := c.order.Back(); elem != nil; {
+		prev := elem.Prev()
+		if c.expired(elem, now) {
+			removed, reasons = append(removed, c.remove(elem)), append(reasons, ReasonExpired)
+		}
+		elem = prev
+	}
+	c.mu.Unlock()
+
+	c.notify(removed, reasons)
+	return len(removed)
+}
+
+// Stats returns copy of cache counters.
+func (c *LRU[K, V]) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.Len = c.order.Len()
+	return stats
+}
+
+func (c *LRU[K, V]) expired(elem *list.Element, now time.Time) bool {
+	return c.ttl > 0 && now.Sub(elem.Value.(*entry[K, V]).added) > c.ttl
+}
+
+// remove removes entry from cache. Caller has to hold the lock.
+func (c *LRU[K, V]) remove(elem *list.Element) *entry[K, V] {
+	e := c.order.Remove(elem).(*entry[K, V])
+	delete(c.items, e.key)
+	return e
+}
+
+// notify updates counters and calls onEvict for removed entries. Called without the lock, so callback may use the cache.
+func (c *LRU[K, V]) notify(removed []*entry[K, V], reasons []Reason) {
+	if len(removed) == 0 {
+		return
+	}
+
+	c.mu.Lock()
+	for _, reason := range reasons {
+		if reason == ReasonExpired {
+			c.stats.Expired++
+		} else {
+			c.stats.Evicted++
+		}
+	}
+	c.mu.Unlock()
+
+	if c.onEvict == nil {
+		return
+	}
+
+	for i, e := range removed {
+		c.onEvict(e.key, e.value, reasons[i])
+	}
+}
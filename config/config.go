@@ -1,32 +1,248 @@
 package config
 
-import "github.com/pelletier/go-toml"
+import (
+	"net/url"
+	"reflect"
+	"slices"
+	"time"
+
+	"github.com/pelletier/go-toml"
+)
 
 const (
 	DefaultConfigPath = "config.toml"
 )
 
 type RPCNode struct {
-	Name        string
-	RPCEndpoint string `toml:"rpc"`
-	WSEndpoint  string `toml:"ws"`
-	Observer    bool   `toml:"observer"`
+	Name        string   `toml:"-"` // Set from key of node table.
+	RPCEndpoint string   `toml:"rpc"`
+	WSEndpoint  string   `toml:"ws"`
+	Geyser      string   `toml:"geyser"`       // Yellowstone gRPC endpoint (http:// or https://); observer streams transactions from it instead of ws logs.
+	GeyserToken string   `toml:"geyser_token"` // Sent as x-token header of geyser requests.
+	Observer    bool     `toml:"observer"`     // Same as observer role.
+	Source      string   `toml:"source"`       // What observer subscribes for: logs, blocks, transactions, geyser or polling; geyser if its endpoint is set, logs if ws one is, polling otherwise.
+	Fallback    []string `toml:"fallback"`     // Sources started in order while observer's source and fallbacks before them are degraded.
+	Roles       []string `toml:"roles"`        // Node serves only requests of given roles; all but observer and send-tx if empty.
+	Priority    int      `toml:"priority"`     // Weight used by weighted selection strategy; defaults to 1.
+
+	// Request budgets; zero means unlimited.
+	RequestsPerSecond       int            `toml:"rps"`
+	Burst                   int            `toml:"burst"`      // Defaults to rps.
+	MethodRequestsPerSecond map[string]int `toml:"method_rps"` // Method name -> requests per second.
+
+	// Transport settings; headers, auth and timeout apply to all endpoints, proxy only to rpc one and TLS to rpc and geyser ones.
+	Headers               map[string]string `toml:"headers"`
+	BearerToken           string            `toml:"bearer_token"`
+	Username              string            `toml:"username"` // Basic auth.
+	Password              string            `toml:"password"`
+	Proxy                 string            `toml:"proxy"` // HTTP proxy URL; environment proxy is used if empty.
+	TLSInsecureSkipVerify bool              `toml:"tls_insecure_skip_verify"`
+	TLSCAFile             string            `toml:"tls_ca_file"`   // PEM file with additional root certificates.
+	TLSCertFile           string            `toml:"tls_cert_file"` // PEM client certificate; requires key file.
+	TLSKeyFile            string            `toml:"tls_key_file"`
+	Timeout               time.Duration     `toml:"timeout"` // Request timeout and ws handshake timeout; 0 means no request timeout.
+}
+
+// IsObserver tells if node has observer role, given either by observer flag or in roles.
+func (n RPCNode) IsObserver() bool {
+	return n.Observer || slices.Contains(n.Roles, "observer")
+}
+
+// EffectivePriority returns weight of node used by weighted selection strategy; zero priority means 1.
+func (n RPCNode) EffectivePriority() int {
+	return max(1, n.Priority)
+}
+
+// ObserverSource returns what observer of node subscribes for; by default geyser is used if node has geyser endpoint,
+// logs if it has ws endpoint, and nodes with rpc endpoint only are polled.
+func (n RPCNode) ObserverSource() string {
+	switch {
+	case n.Source != "":
+		return n.Source
+	case n.Geyser != "":
+		return "geyser"
+	case n.WSEndpoint != "":
+		return "logs"
+	default:
+		return "polling"
+	}
+}
+
+// Trading holds settings of position manager, paper engine and their entry/exit rules.
+// Percentages are fractions of position cost (eg. 0.5 = 50%); zero value disables given rule.
+type Trading struct {
+	Enabled      bool          `toml:"enabled"`
+	Paper        bool          `toml:"paper" default:"true"`
+	StateFile    string        `toml:"state_file" default:"positions.json"`
+	PollInterval time.Duration `toml:"poll_interval" default:"2s"`
+	Slippage     float64       `toml:"slippage" default:"0.05"`
+	Latency      time.Duration `toml:"latency"` // Simulated delay between decision and fill.
+	LedgerFile   string        `toml:"ledger_file" default:"ledger"`
+
+	// Entry rules; paper engine enters pairs only if entry amount is set.
+	EntryAmount      uint64        `toml:"entry_amount"`   // In lamports.
+	MinLiquidity     uint64        `toml:"min_liquidity"`  // Minimal initial pooled lamports.
+	MaxOpenDelay     time.Duration `toml:"max_open_delay"` // Skip pairs whose trading opens later than that.
+	MaxOpenPositions int           `toml:"max_open_positions"`
+
+	// Exit rules.
+	TakeProfit   float64       `toml:"take_profit"`
+	StopLoss     float64       `toml:"stop_loss"`
+	TrailingStop float64       `toml:"trailing_stop"`
+	MaxHoldTime  time.Duration `toml:"max_hold_time"`
+}
+
+// Hedge holds settings of hedged requests of a method.
+type Hedge struct {
+	Fanout int           `toml:"fanout"` // Number of connections request is sent to.
+	Delay  time.Duration `toml:"delay"`  // Delay between consecutive requests; 0 sends all at once.
+}
+
+// Pool holds settings of RPC connection pool.
+type Pool struct {
+	Strategy         string `toml:"strategy" default:"round-robin"`      // Selection strategy for regular requests.
+	CriticalStrategy string `toml:"critical_strategy" default:"latency"` // Selection strategy for latency critical requests.
+	Base             string `toml:"base"`                                // Name of base node; optional.
+
+	// Background health checking; nodes failing any check are taken out of rotation until they pass again.
+	HealthInterval time.Duration `toml:"health_interval" default:"10s"` // How often nodes are probed; 0 disables health checker.
+	MaxSlotLag     uint64        `toml:"max_slot_lag" default:"50"`     // Maximal number of slots node may be behind highest-slot node.
+	MaxLatency     time.Duration `toml:"max_latency"`                   // Maximal latency of probe; 0 disables check.
+
+	Hedge map[string]Hedge `toml:"hedge"` // Method -> hedging settings of latency critical requests.
+}
+
+// Pipeline holds tunables of log observers, tx analyzer and pair collector.
+type Pipeline struct {
+	ChannelSize     int           `toml:"channel_size" default:"32"`      // Buffer size of channels between components.
+	StartTimeout    time.Duration `toml:"start_timeout" default:"15s"`    // Timeout of starting log observers.
+	ShutdownTimeout time.Duration `toml:"shutdown_timeout" default:"15s"` // Timeout of stopping all components.
+
+	SubscribeTimeout        time.Duration `toml:"subscribe_timeout" default:"15s"`        // Timeout of (re)subscribing for program logs.
+	ResubscribeDelay        time.Duration `toml:"resubscribe_delay" default:"5s"`         // Initial delay between failed resubscription attempts; doubled after each failure.
+	ResubscribeMaxDelay     time.Duration `toml:"resubscribe_max_delay" default:"1m"`     // Maximal delay between failed resubscription attempts.
+	SubscriptionIdleTimeout time.Duration `toml:"subscription_idle_timeout" default:"1m"` // Subscription without messages for that long is considered dead; 0 disables check.
+	LogsCommitment          string        `toml:"logs_commitment" default:"processed"`    // Commitment of log subscriptions.
+	GapFillLimit            int           `toml:"gap_fill_limit" default:"1000"`          // Maximal number of signatures fetched after reconnect to find missed logs; 0 disables gap fill.
+	GapFillTimeout          time.Duration `toml:"gap_fill_timeout" default:"2m"`          // Timeout of gap fill after single reconnect.
+	FallbackDelay           time.Duration `toml:"fallback_delay" default:"30s"`           // How long source has to be degraded before its fallback starts, and working before it stops.
+	PollInterval            time.Duration `toml:"poll_interval" default:"2s"`             // Delay between polls of program signatures by polling source.
+	PollLimit               int           `toml:"poll_limit" default:"1000"`              // Maximal number of new signatures handled per poll; newer ones are left for next polls, up to 10 polls behind.
+
+	AnalyzeTimeout        time.Duration `toml:"analyze_timeout" default:"300s"`        // Timeout of analyzing single transaction, including waiting for it to be confirmed.
+	GetTransactionTimeout time.Duration `toml:"get_transaction_timeout" default:"5s"`  // Timeout of single getTransaction request.
+	NotFoundRetryDelay    time.Duration `toml:"not_found_retry_delay" default:"200ms"` // Delay before asking again for transaction that isn't confirmed yet.
+	TxCommitment          string        `toml:"tx_commitment" default:"confirmed"`     // Commitment of getTransaction requests; processed isn't supported by nodes.
+	MaxTransactionVersion uint64        `toml:"max_transaction_version" default:"1"`
+
+	TokenInfoTimeout      time.Duration `toml:"token_info_timeout" default:"15s"` // Timeout of fetching token signatures and supply.
+	SignatureLimit        int           `toml:"signature_limit" default:"100"`    // Number of token signatures fetched to find its creation.
+	TokenSupplyCommitment string        `toml:"token_supply_commitment" default:"finalized"`
+
+	DedupSize           int           `toml:"dedup_size" default:"100000"`          // Maximal number of remembered signatures and created pairs, per cache.
+	DedupTTL            time.Duration `toml:"dedup_ttl" default:"1h"`               // How long signatures and created pairs are remembered.
+	PendingMarketLimit  int           `toml:"pending_market_limit" default:"10000"` // Maximal number of markets waiting for their pool.
+	PendingMarketTTL    time.Duration `toml:"pending_market_ttl" default:"30m"`     // How long market waits for its pool before it's dropped.
+	MemoryStatsInterval time.Duration `toml:"memory_stats_interval" default:"1m"`   // How often memory and cache stats are printed; 0 disables them.
+
+	RaceWindow          time.Duration `toml:"race_window" default:"10s"`          // How long observers have to see signature before it's counted as missed.
+	RaceSummaryInterval time.Duration `toml:"race_summary_interval" default:"5m"` // How often observer leaderboard is printed (and exported); 0 disables it.
+	RaceFile            string        `toml:"race_file"`                          // Base name of leaderboard export files (.json and .csv); empty disables export.
 }
 
 type Config struct {
-	Nodes map[string]RPCNode
+	Nodes    map[string]RPCNode `toml:"nodes"`
+	Pool     Pool               `toml:"pool"`
+	Pipeline Pipeline           `toml:"pipeline"`
+	Trading  Trading            `toml:"trading"`
 }
 
+// LoadConfig reads config file, resolves environment variables and secret files, applies environment overrides and validates the result.
 func LoadConfig(path string) (Config, error) {
 	tree, err := toml.LoadFile(path)
 	if err != nil {
 		return Config{}, err
 	}
 
+	typ := reflect.TypeOf(Config{})
+	if err := resolve(tree, typ, nil); err != nil {
+		return Config{}, err
+	}
+
+	if err := applyEnv(tree, typ, nil); err != nil {
+		return Config{}, err
+	}
+
 	var config Config
 	if err := tree.Unmarshal(&config); err != nil {
 		return Config{}, err
 	}
 
+	if err := config.Validate(); err != nil {
+		return Config{}, err
+	}
+
 	return config, nil
 }
+
+// Redacted returns copy of config that can be printed: secrets (auth, header values, and userinfo, paths and queries
+// of endpoint URLs, which often carry API keys) are replaced, and node priorities are set to their effective values.
+func (c Config) Redacted() Config {
+	nodes := make(map[string]RPCNode, len(c.Nodes))
+	for name, node := range c.Nodes {
+		if node.BearerToken != "" {
+			node.BearerToken = redacted
+		}
+
+		if node.Password != "" {
+			node.Password = redacted
+		}
+
+		if node.GeyserToken != "" {
+			node.GeyserToken = redacted
+		}
+
+		headers := make(map[string]string, len(node.Headers))
+		for k := range node.Headers {
+			headers[k] = redacted
+		}
+		node.Headers = headers
+
+		node.RPCEndpoint = redactURL(node.RPCEndpoint)
+		node.WSEndpoint = redactURL(node.WSEndpoint)
+		node.Geyser = redactURL(node.Geyser)
+		node.Proxy = redactURL(node.Proxy)
+		node.Priority = node.EffectivePriority()
+
+		nodes[name] = node
+	}
+
+	c.Nodes = nodes
+	return c
+}
+
+const redacted = "<redacted>"
+
+// redactURL returns scheme and host of given URL, with userinfo and anything after host replaced.
+func redactURL(raw string) string {
+	if raw == "" {
+		return raw
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return redacted
+	}
+
+	s := u.Scheme + "://"
+	if u.User != nil {
+		s += redacted + "@"
+	}
+	s += u.Host
+
+	if (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.Fragment != "" {
+		s += "/" + redacted
+	}
+
+	return s
+}
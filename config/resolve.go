@@ -0,0 +1,250 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml"
+)
+
+// EnvPrefix is prefix of environment variables overriding config keys, eg. RAYSCAN_TRADING_ENABLED overrides trading.enabled
+// and RAYSCAN_NODES_MAINNET_RPC overrides rpc of mainnet node. Non alphanumeric characters of keys are replaced with underscores.
+const EnvPrefix = "RAYSCAN_"
+
+// Suffix of keys whose value is read from file given as their value, eg. bearer_token_file sets bearer_token.
+const secretFileSuffix = "_file"
+
+// KeyError is an error of config value with given key.
+type KeyError struct {
+	Key string
+	Err error
+}
+
+func (e *KeyError) Error() string {
+	return fmt.Sprintf("config key %s: %s", e.Key, e.Err)
+}
+
+func (e *KeyError) Unwrap() error {
+	return e.Err
+}
+
+func keyError(path []string, format string, args ...interface{}) error {
+	return &KeyError{Key: strings.Join(path, "."), Err: fmt.Errorf(format, args...)}
+}
+
+// ${VAR} or ${VAR:-default}.
+var envVarRegexp = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(?::-([^}]*))?\}`)
+
+// interpolate replaces environment variable references in given string with their values.
+func interpolate(s string) (string, error) {
+	var err error
+	result := envVarRegexp.ReplaceAllStringFunc(s, func(ref string) string {
+		match := envVarRegexp.FindStringSubmatch(ref)
+		if value, ok := os.LookupEnv(match[1]); ok {
+			return value
+		}
+
+		if strings.Contains(ref, ":-") {
+			return match[2]
+		}
+
+		err = fmt.Errorf("environment variable %s is not set", match[1])
+		return ref
+	})
+
+	return result, err
+}
+
+// resolve checks that all keys of tree are known, interpolates environment variables in its string values
+// and replaces secret file keys (eg. bearer_token_file) with contents of given files.
+func resolve(tree *toml.Tree, typ reflect.Type, path []string) error {
+	for _, key := range tree.Keys() {
+		keyPath := append(path[:len(path):len(path)], key)
+		value := tree.GetPath([]string{key})
+
+		fieldTyp, ok := keyType(typ, key)
+		if !ok && strings.HasSuffix(key, secretFileSuffix) {
+			if err := resolveSecretFile(tree, typ, path, key); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if !ok {
+			return keyError(keyPath, "unknown key")
+		}
+
+		switch v := value.(type) {
+		case *toml.Tree:
+			if err := resolve(v, fieldTyp, keyPath); err != nil {
+				return err
+			}
+		case string:
+			s, err := interpolate(v)
+			if err != nil {
+				return &KeyError{Key: strings.Join(keyPath, "."), Err: err}
+			}
+			tree.SetPath([]string{key}, s)
+		case []interface{}:
+			for i, elem := range v {
+				if s, ok := elem.(string); ok {
+					var err error
+					if v[i], err = interpolate(s); err != nil {
+						return &KeyError{Key: strings.Join(keyPath, "."), Err: err}
+					}
+				}
+			}
+			tree.SetPath([]string{key}, v)
+		}
+	}
+
+	return nil
+}
+
+// resolveSecretFile sets string key to contents of file given by its secret file key, eg. bearer_token to contents of bearer_token_file.
+func resolveSecretFile(tree *toml.Tree, typ reflect.Type, path []string, fileKey string) error {
+	keyPath := append(path[:len(path):len(path)], fileKey)
+	key := strings.TrimSuffix(fileKey, secretFileSuffix)
+
+	if fieldTyp, ok := keyType(typ, key); !ok || fieldTyp.Kind() != reflect.String {
+		return keyError(keyPath, "unknown key")
+	}
+
+	if tree.HasPath([]string{key}) {
+		return keyError(keyPath, "%s is set too", key)
+	}
+
+	filePath, ok := tree.GetPath([]string{fileKey}).(string)
+	if !ok {
+		return keyError(keyPath, "file path has to be a string")
+	}
+
+	filePath, err := interpolate(filePath)
+	if err != nil {
+		return &KeyError{Key: strings.Join(keyPath, "."), Err: err}
+	}
+
+	secret, err := os.ReadFile(filePath)
+	if err != nil {
+		return &KeyError{Key: strings.Join(keyPath, "."), Err: err}
+	}
+
+	tree.SetPath([]string{key}, strings.TrimRight(string(secret), "\r\n"))
+	return tree.DeletePath([]string{fileKey})
+}
+
+// keyType returns type of value of given key within struct or map of given type.
+func keyType(typ reflect.Type, key string) (reflect.Type, bool) {
+	switch typ.Kind() {
+	case reflect.Map:
+		return typ.Elem(), true
+	case reflect.Struct:
+		for i := 0; i < typ.NumField(); i++ {
+			if field := typ.Field(i); tomlKey(field) == key || strings.EqualFold(field.Name, key) && field.Tag.Get("toml") == "" {
+				return field.Type, true
+			}
+		}
+	}
+
+	return nil, false
+}
+
+func tomlKey(field reflect.StructField) string {
+	if key := field.Tag.Get("toml"); key != "" {
+		return key
+	}
+
+	return strings.ToLower(field.Name)
+}
+
+// applyEnv overrides keys of tree with values of their environment variables.
+// Every field of structs can be overridden; entries of maps only if they exist in tree.
+func applyEnv(root *toml.Tree, typ reflect.Type, path []string) error {
+	switch typ.Kind() {
+	case reflect.Struct:
+		for i := 0; i < typ.NumField(); i++ {
+			field := typ.Field(i)
+			if tomlKey(field) == "-" {
+				continue // Not read from config.
+			}
+
+			if err := applyEnv(root, field.Type, append(path[:len(path):len(path)], tomlKey(field))); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	case reflect.Map:
+		tree, ok := root.GetPath(path).(*toml.Tree)
+		if !ok {
+			return nil
+		}
+
+		for _, key := range tree.Keys() {
+			if err := applyEnv(root, typ.Elem(), append(path[:len(path):len(path)], key)); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	envVar := EnvPrefix + envName(path)
+	raw, ok := os.LookupEnv(envVar)
+	if !ok {
+		return nil
+	}
+
+	value, err := parseEnvValue(typ, raw)
+	if err != nil {
+		return keyError(path, "invalid value of %s: %s", envVar, err)
+	}
+
+	root.SetPath(path, value)
+	return nil
+}
+
+var envNameReplacer = regexp.MustCompile(`[^A-Za-z0-9]+`)
+
+func envName(path []string) string {
+	return strings.ToUpper(envNameReplacer.ReplaceAllString(strings.Join(path, "_"), "_"))
+}
+
+// parseEnvValue converts environment variable to value of the same type TOML parser would produce for given field type.
+func parseEnvValue(typ reflect.Type, raw string) (interface{}, error) {
+	if typ == reflect.TypeOf(time.Duration(0)) {
+		return raw, nil // Parsed as duration string.
+	}
+
+	switch typ.Kind() {
+	case reflect.String:
+		return raw, nil
+	case reflect.Bool:
+		return strconv.ParseBool(raw)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.ParseInt(raw, 10, 64)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v, err := strconv.ParseUint(raw, 10, 63)
+		return int64(v), err
+	case reflect.Float32, reflect.Float64:
+		return strconv.ParseFloat(raw, 64)
+	case reflect.Slice:
+		var values []interface{}
+		for _, s := range strings.Split(raw, ",") {
+			v, err := parseEnvValue(typ.Elem(), strings.TrimSpace(s))
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v)
+		}
+		return values, nil
+	}
+
+	return nil, errors.New("unsupported type")
+}
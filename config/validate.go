@@ -0,0 +1,246 @@
+package config
+
+import (
+	"net/url"
+	"time"
+)
+
+// Validate checks config values; returned error is a *KeyError naming the offending key.
+func (c Config) Validate() error {
+	if len(c.Nodes) == 0 {
+		return keyError([]string{"nodes"}, "no nodes configured")
+	}
+
+	for name, node := range c.Nodes {
+		if err := node.validate([]string{"nodes", name}); err != nil {
+			return err
+		}
+	}
+
+	if err := c.Pool.validate([]string{"pool"}); err != nil {
+		return err
+	}
+
+	if _, ok := c.Nodes[c.Pool.Base]; c.Pool.Base != "" && !ok {
+		return keyError([]string{"pool", "base"}, "unknown node %s", c.Pool.Base)
+	}
+
+	if err := c.Pipeline.validate([]string{"pipeline"}); err != nil {
+		return err
+	}
+
+	return c.Trading.validate([]string{"trading"})
+}
+
+// Commitment levels accepted by nodes.
+var commitments = map[string]bool{"processed": true, "confirmed": true, "finalized": true}
+
+func (p Pipeline) validate(path []string) error {
+	key := func(k string) []string { return append(path[:len(path):len(path)], k) }
+
+	if p.ChannelSize <= 0 {
+		return keyError(key("channel_size"), "has to be positive")
+	}
+
+	for k, v := range map[string]time.Duration{
+		"start_timeout":           p.StartTimeout,
+		"shutdown_timeout":        p.ShutdownTimeout,
+		"subscribe_timeout":       p.SubscribeTimeout,
+		"analyze_timeout":         p.AnalyzeTimeout,
+		"get_transaction_timeout": p.GetTransactionTimeout,
+		"token_info_timeout":      p.TokenInfoTimeout,
+		"dedup_ttl":               p.DedupTTL,
+		"pending_market_ttl":      p.PendingMarketTTL,
+		"race_window":             p.RaceWindow,
+		"gap_fill_timeout":        p.GapFillTimeout,
+		"fallback_delay":          p.FallbackDelay,
+		"poll_interval":           p.PollInterval,
+	} {
+		if v <= 0 {
+			return keyError(key(k), "has to be positive")
+		}
+	}
+
+	for k, v := range map[string]int{"dedup_size": p.DedupSize, "pending_market_limit": p.PendingMarketLimit, "poll_limit": p.PollLimit} {
+		if v <= 0 {
+			return keyError(key(k), "has to be positive")
+		}
+	}
+
+	for k, v := range map[string]time.Duration{"resubscribe_delay": p.ResubscribeDelay, "resubscribe_max_delay": p.ResubscribeMaxDelay, "subscription_idle_timeout": p.SubscriptionIdleTimeout, "not_found_retry_delay": p.NotFoundRetryDelay, "memory_stats_interval": p.MemoryStatsInterval, "race_summary_interval": p.RaceSummaryInterval} {
+		if v < 0 {
+			return keyError(key(k), "can't be negative")
+		}
+	}
+
+	if p.ResubscribeMaxDelay < p.ResubscribeDelay {
+		return keyError(key("resubscribe_max_delay"), "can't be less than resubscribe_delay (%v)", p.ResubscribeDelay)
+	}
+
+	if p.GapFillLimit < 0 {
+		return keyError(key("gap_fill_limit"), "can't be negative")
+	}
+
+	if p.RaceWindow > p.DedupTTL {
+		return keyError(key("race_window"), "can't exceed dedup_ttl (%v)", p.DedupTTL)
+	}
+
+	if p.GetTransactionTimeout > p.AnalyzeTimeout {
+		return keyError(key("get_transaction_timeout"), "can't exceed analyze_timeout (%v)", p.AnalyzeTimeout)
+	}
+
+	for k, v := range map[string]string{"logs_commitment": p.LogsCommitment, "tx_commitment": p.TxCommitment, "token_supply_commitment": p.TokenSupplyCommitment} {
+		if !commitments[v] {
+			return keyError(key(k), "unknown commitment %q; use processed, confirmed or finalized", v)
+		}
+	}
+
+	if p.TxCommitment == "processed" {
+		return keyError(key("tx_commitment"), "processed isn't supported by getTransaction; use confirmed or finalized")
+	}
+
+	if p.SignatureLimit < 1 || p.SignatureLimit > 1000 {
+		return keyError(key("signature_limit"), "has to be within [1, 1000]")
+	}
+
+	return nil
+}
+
+func (n RPCNode) validate(path []string) error {
+	key := func(k string) []string { return append(path[:len(path):len(path)], k) }
+
+	if n.RPCEndpoint == "" {
+		return keyError(key("rpc"), "is required")
+	}
+
+	if err := n.validateSource(key, "source", n.ObserverSource()); err != nil {
+		return err
+	}
+
+	seen := map[string]bool{n.ObserverSource(): true}
+	for _, source := range n.Fallback {
+		if err := n.validateSource(key, "fallback", source); err != nil {
+			return err
+		}
+
+		if seen[source] {
+			return keyError(key("fallback"), "has to list distinct sources other than node's source (%s)", n.ObserverSource())
+		}
+		seen[source] = true
+	}
+
+	if n.Geyser != "" {
+		if u, err := url.Parse(n.Geyser); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return keyError(key("geyser"), "has to be http:// or https:// URL")
+		}
+	}
+
+	for k, v := range map[string]int{"priority": n.Priority, "rps": n.RequestsPerSecond, "burst": n.Burst} {
+		if v < 0 {
+			return keyError(key(k), "can't be negative")
+		}
+	}
+
+	for method, rps := range n.MethodRequestsPerSecond {
+		if rps < 0 {
+			return keyError(append(key("method_rps"), method), "can't be negative")
+		}
+	}
+
+	if n.Timeout < 0 {
+		return keyError(key("timeout"), "can't be negative")
+	}
+
+	if n.Password != "" && n.Username == "" {
+		return keyError(key("username"), "is required with password")
+	}
+
+	if n.BearerToken != "" && n.Username != "" {
+		return keyError(key("bearer_token"), "can't be used with basic auth")
+	}
+
+	if (n.TLSCertFile == "") != (n.TLSKeyFile == "") {
+		return keyError(key("tls_key_file"), "tls_cert_file and tls_key_file have to be set together")
+	}
+
+	return nil
+}
+
+func (p Pool) validate(path []string) error {
+	key := func(k string) []string { return append(path[:len(path):len(path)], k) }
+
+	for k, v := range map[string]time.Duration{"health_interval": p.HealthInterval, "max_latency": p.MaxLatency} {
+		if v < 0 {
+			return keyError(key(k), "can't be negative")
+		}
+	}
+
+	for method, hedge := range p.Hedge {
+		if hedge.Fanout < 0 {
+			return keyError(append(key("hedge"), method, "fanout"), "can't be negative")
+		}
+
+		if hedge.Delay < 0 {
+			return keyError(append(key("hedge"), method, "delay"), "can't be negative")
+		}
+	}
+
+	return nil
+}
+
+func (t Trading) validate(path []string) error {
+	key := func(k string) []string { return append(path[:len(path):len(path)], k) }
+
+	if t.Enabled && t.PollInterval <= 0 {
+		return keyError(key("poll_interval"), "has to be positive")
+	}
+
+	if t.Slippage < 0 || t.Slippage >= 1 {
+		return keyError(key("slippage"), "has to be within [0, 1)")
+	}
+
+	for k, v := range map[string]time.Duration{"latency": t.Latency, "max_open_delay": t.MaxOpenDelay, "max_hold_time": t.MaxHoldTime} {
+		if v < 0 {
+			return keyError(key(k), "can't be negative")
+		}
+	}
+
+	for k, v := range map[string]float64{"take_profit": t.TakeProfit, "stop_loss": t.StopLoss, "trailing_stop": t.TrailingStop} {
+		if v < 0 {
+			return keyError(key(k), "can't be negative")
+		}
+	}
+
+	if t.StopLoss > 1 {
+		return keyError(key("stop_loss"), "can't exceed 1")
+	}
+
+	if t.TrailingStop > 1 {
+		return keyError(key("trailing_stop"), "can't exceed 1")
+	}
+
+	if t.MaxOpenPositions < 0 {
+		return keyError(key("max_open_positions"), "can't be negative")
+	}
+
+	return nil
+}
+
+// validateSource checks source of node's observer, given by key k, and that node has endpoint the source requires.
+func (n RPCNode) validateSource(key func(string) []string, k, source string) error {
+	switch source {
+	case "logs", "blocks", "transactions":
+		if n.IsObserver() && n.WSEndpoint == "" {
+			return keyError(key("ws"), "is required for observer with %s source", source)
+		}
+	case "geyser":
+		if n.Geyser == "" {
+			return keyError(key("geyser"), "is required for geyser source")
+		}
+	case "polling":
+	default:
+		return keyError(key(k), "has to be logs, blocks, transactions, geyser or polling")
+	}
+
+	return nil
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gagliardetto/solana-go/rpc"
@@ -16,59 +17,259 @@ import (
 type Connection struct {
 	ConnectionInfo config.RPCNode
 	RPCClient      *rpc.Client
-	CooldownUntil  time.Time
+
+	jsonrpcClient rpc.JSONRPCClient // Client that RPCClient sends requests through; tracks results of requests.
+
+	limiter        *tokenBucket            // Requests per second limit; nil if unlimited.
+	methodLimiters map[string]*tokenBucket // Method -> requests per second limit.
+
+	mu            sync.Mutex
+	cooldownUntil time.Time
+	retryAfter    time.Duration // Retry-After of last rate limited response.
+	failures      int           // Consecutive failures.
+	stats         ConnectionStats
+	latency       latencyWindow // Latencies of recent successful requests.
+	unhealthy     bool          // Set by health checks; unhealthy connection is out of rotation.
+	healthReason  string        // Reason of last failed health check.
+
+	outstanding   atomic.Int64 // Requests in flight.
+	currentWeight int          // Weighted selection state; guarded by pool lock.
+}
+
+func newConnection(node config.RPCNode) (*Connection, error) {
+	c := &Connection{
+		ConnectionInfo: node,
+		methodLimiters: make(map[string]*tokenBucket),
+	}
+
+	if node.RequestsPerSecond > 0 {
+		c.limiter = newTokenBucket(float64(node.RequestsPerSecond), node.Burst)
+	}
+
+	for method, rps := range node.MethodRequestsPerSecond {
+		if rps > 0 {
+			c.methodLimiters[method] = newTokenBucket(float64(rps), 0)
+		}
+	}
+
+	client, err := newHTTPClient(node)
+	if err != nil {
+		return nil, err
+	}
+
+	httpClient := &retryAfterClient{
+		Client: client,
+		conn:   c,
+	}
+
+	c.jsonrpcClient = &trackingClient{
+		JSONRPCClient: jsonrpc.NewClientWithOpts(node.RPCEndpoint, &jsonrpc.RPCClientOpts{HTTPClient: httpClient, CustomHeaders: nodeHeaders(node)}),
+		conn:          c,
+	}
+	c.RPCClient = rpc.NewWithCustomRPCClient(c.jsonrpcClient)
+
+	return c, nil
+}
+
+// WrapRPCClient replaces RPCClient with one that sends requests through wrapper of connection's JSON-RPC client.
+func (c *Connection) WrapRPCClient(wrap func(rpc.JSONRPCClient) rpc.JSONRPCClient) {
+	c.RPCClient = rpc.NewWithCustomRPCClient(wrap(c.jsonrpcClient))
 }
 
 type RPCPool struct {
 	Connections []*Connection
 	CurrentIdx  int
 	mu          sync.RWMutex
+
+	strategy         Strategy // Selection strategy of regular requests.
+	criticalStrategy Strategy // Selection strategy of latency critical requests.
+
+	hedges map[string]config.Hedge // Method -> hedging settings.
+	base   string                  // Name of base connection.
+
+	connectHook func(*Connection) // Called for connections added by Reload.
 }
 
 func (r *RPCPool) Size() int {
-	return len(r.Connections)
+	return len(r.ConnectionList())
 }
 
-func (r *RPCPool) BaseConnection() Connection {
-	for _, c := range r.Connections {
-		if c.ConnectionInfo.RPCEndpoint == rpc.MainNetBeta_RPC {
-			return *c
-		}
+// ConnectionList returns current connections of the pool. Returned slice is never modified, as reload replaces it with a new one.
+func (r *RPCPool) ConnectionList() []*Connection {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.Connections
+}
+
+// BaseConnection returns connection configured as base one in pool settings.
+func (r *RPCPool) BaseConnection() (*Connection, error) {
+	r.mu.RLock()
+	base := r.base // Replaced by reload.
+	r.mu.RUnlock()
+
+	if base == "" {
+		return nil, ErrNoBaseConnection
 	}
 
-	panic("No base connection found!")
+	return r.NamedConnection(base)
 }
 
-func (r *RPCPool) NamedConnection(name string) Connection {
-	for _, c := range r.Connections {
+// NamedConnection returns connection with given name; returned error wraps ErrConnectionNotFound if there is none.
+func (r *RPCPool) NamedConnection(name string) (*Connection, error) {
+	for _, c := range r.ConnectionList() {
 		if c.ConnectionInfo.Name == name {
-			return *c
+			return c, nil
 		}
 	}
 
-	panic(fmt.Sprintf("No connection with name %s found!", name))
+	return nil, &ConnectionError{Name: name, Err: ErrConnectionNotFound}
 }
 
+// Client returns client of connection chosen by pool strategy; it's nil if pool has no connections.
 func (r *RPCPool) Client() *rpc.Client {
-	r.mu.Lock()
-	defer r.mu.Unlock()
+	return r.ClientForMethod("")
+}
+
+// ClientForMethod returns client of connection chosen by pool strategy among connections that aren't on cooldown and have budget left for given method.
+// If no connection has budget left, connection is chosen among those that aren't on cooldown and request will wait for its budget.
+// Returned client is nil if pool has no connections.
+func (r *RPCPool) ClientForMethod(method string) *rpc.Client {
+	conn, err := r.selectConnection(context.Background(), RoleAny, method, false)
+	if err != nil {
+		return nil // Any role fails only if pool is empty.
+	}
+
+	return conn.RPCClient
+}
+
+// CriticalClient is like ClientForMethod, but uses pool strategy for latency critical requests.
+func (r *RPCPool) CriticalClient(method string) *rpc.Client {
+	conn, err := r.selectConnection(context.Background(), RoleAny, method, true)
+	if err != nil {
+		return nil
+	}
+
+	return conn.RPCClient
+}
 
-	oldIdx := r.CurrentIdx
+// ClientFor returns client of connection with given role; returned error wraps ErrNoConnectionForRole if no connection has it.
+func (r *RPCPool) ClientFor(ctx context.Context, role Role) (*rpc.Client, error) {
+	return r.RoleClientForMethod(ctx, role, "")
+}
+
+// RoleClientForMethod is like ClientForMethod, but chooses only among connections with given role. It waits while all of them
+// are on cooldown, until given context is done.
+func (r *RPCPool) RoleClientForMethod(ctx context.Context, role Role, method string) (*rpc.Client, error) {
+	conn, err := r.selectConnection(ctx, role, method, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return conn.RPCClient, nil
+}
+
+// selectConnection picks connection with strategy of regular or latency critical requests.
+func (r *RPCPool) selectConnection(ctx context.Context, role Role, method string, critical bool) (*Connection, error) {
+	var conn *Connection
+	err := r.waitCandidates(ctx, role, method, func(candidates []int) {
+		strategy := r.strategy
+		if critical {
+			strategy = r.criticalStrategy
+		}
+
+		idx := r.pick(candidates, strategy)
+		r.CurrentIdx = (idx + 1) % len(r.Connections)
+		conn = r.Connections[idx]
+	})
+
+	return conn, err
+}
+
+// waitCandidates calls choose with indexes of connections (ordered from current round-robin position) with given role that can serve given method;
+// choose is called with the pool lock held. While all connections are on cooldown, it waits without holding the lock until any of them can be used
+// or given context is done. Returned error wraps ErrNoConnectionForRole if no connection has given role, so none would ever match.
+func (r *RPCPool) waitCandidates(ctx context.Context, role Role, method string, choose func(candidates []int)) error {
+	for waited := false; ; waited = true {
+		r.mu.Lock()
+		candidates, err := r.candidates(role, method)
+		if err == nil && len(candidates) > 0 {
+			choose(candidates)
+		}
+		r.mu.Unlock()
+
+		if err != nil || len(candidates) > 0 {
+			return err
+		}
 
-	for i := 0; r.Connections[oldIdx].CooldownUntil.After(time.Now()); i++ {
-		oldIdx = (oldIdx + 1) % len(r.Connections)
-		if i == len(r.Connections) {
+		if !waited {
 			fmt.Printf("All connections are on cooldown, waiting for cooldown to end... Consider adding new RPC providers\n")
-			time.Sleep(50 * time.Millisecond)
-			i = 0
 		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
+
+// candidates returns indexes of connections with given role that can serve given method now; it's empty if all of them are on cooldown.
+// Caller has to hold the lock.
+func (r *RPCPool) candidates(role Role, method string) ([]int, error) {
+	if !r.hasRole(role) {
+		return nil, fmt.Errorf("%w: %s", ErrNoConnectionForRole, role)
+	}
+
+	now := time.Now()
+	var usable, withBudget, unhealthy []int
+
+	for i := range r.Connections {
+		idx := (r.CurrentIdx + i) % len(r.Connections)
+		conn := r.Connections[idx]
+
+		if !conn.HasRole(role) || conn.CooldownUntil().After(now) {
+			continue
+		}
+
+		if !conn.Healthy() {
+			unhealthy = append(unhealthy, idx)
+			continue
+		}
+
+		usable = append(usable, idx)
+		if conn.hasBudget(method, now) {
+			withBudget = append(withBudget, idx)
+		}
+	}
+
+	// Degraded node is better than none at all.
+	if len(usable) == 0 {
+		usable = unhealthy
+	}
+
+	if len(withBudget) > 0 {
+		return withBudget, nil
+	}
+
+	return usable, nil
+}
+
+// Stats returns counters of all connections by connection name.
+func (r *RPCPool) Stats() map[string]ConnectionStats {
+	conns := r.ConnectionList()
+	stats := make(map[string]ConnectionStats, len(conns))
+	for _, c := range conns {
+		stats[c.ConnectionInfo.Name] = c.Stats()
 	}
 
-	r.CurrentIdx = (oldIdx + 1) % len(r.Connections)
-	return r.Connections[oldIdx].RPCClient
+	return stats
 }
 
 func (r *RPCPool) Close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
 	for _, c := range r.Connections {
 		c.RPCClient.Close()
 	}
@@ -82,51 +283,97 @@ type ConnectionInfo struct {
 	WSNode  string
 }
 
-func NewRPCClientPool(nodes map[string]config.RPCNode) (*RPCPool, error) {
+func NewRPCClientPool(nodes map[string]config.RPCNode, poolCfg config.Pool) (*RPCPool, error) {
 	var rpcPool RPCPool
 
+	if err := rpcPool.configure(nodes, poolCfg); err != nil {
+		return nil, err
+	}
+
 	initialLen := len(nodes)
 	fmt.Printf("Checking connection list...\n")
 
+	var healthyConnectionNames []string
+
 	for k, v := range nodes {
-		rpcClient := rpc.New(v.RPCEndpoint)
-
-		ctx, cancel := context.WithTimeout(context.Background(), 2000*time.Millisecond)
-		health, err := rpcClient.GetHealth(ctx)
-		cancel()
-
-		if err != nil || health != "ok" {
-			reason := err.Error()
-			code := -1
-			var asErr *jsonrpc.RPCError
-			if errors.As(err, &asErr) {
-				reason = err.(*jsonrpc.RPCError).Message
-				code = err.(*jsonrpc.RPCError).Code
-			}
+		v.Name = k
+		conn, err := newConnection(v)
+		if err != nil {
+			rpcPool.Close()
+			return nil, &ConnectionError{Name: k, Err: err}
+		}
 
-			fmt.Printf("Remove unhealthy connection: %s (reason: %s, code: %d)\n", v.Name, reason, code)
-			rpcClient.Close()
-			continue
+		// Unhealthy connections are kept out of rotation until health checker reinstates them.
+		rpcPool.Connections = append(rpcPool.Connections, conn)
+
+		if conn.checkHealth() {
+			healthyConnectionNames = append(healthyConnectionNames, v.Name)
 		}
+	}
 
-		v.Name = k
-		fmt.Printf("Connection %s is healthy\n", v.Name)
+	if len(healthyConnectionNames) == 0 {
+		rpcPool.Close()
+		return nil, ErrNoHealthyConnections
+	}
 
-		rpcPool.Connections = append(rpcPool.Connections, &Connection{
-			ConnectionInfo: v,
-			RPCClient:      rpcClient,
-		})
+	fmt.Printf("Connection list checked! %d/%d connections are ok [%s] (strategy: %s, critical strategy: %s)\n", len(healthyConnectionNames), initialLen, strings.Join(healthyConnectionNames, ", "), rpcPool.strategy, rpcPool.criticalStrategy)
+	return &rpcPool, nil
+}
+
+// configure validates pool settings and applies them. Caller has to hold the lock if pool is in use.
+func (r *RPCPool) configure(nodes map[string]config.RPCNode, poolCfg config.Pool) error {
+	strategy, err := ParseStrategy(poolCfg.Strategy)
+	if err != nil {
+		return err
 	}
 
-	if len(rpcPool.Connections) == 0 {
-		return nil, fmt.Errorf("No healthy connections found!")
+	criticalStrategy, err := ParseStrategy(poolCfg.CriticalStrategy)
+	if err != nil {
+		return err
 	}
 
-	healthyConnectionNames := make([]string, len(rpcPool.Connections))
-	for i, c := range rpcPool.Connections {
-		healthyConnectionNames[i] = c.ConnectionInfo.Name
+	for name, node := range nodes {
+		for _, role := range node.Roles {
+			if _, err := ParseRole(role); err != nil {
+				return &ConnectionError{Name: name, Err: err}
+			}
+		}
 	}
 
-	fmt.Printf("Connection list checked! %d/%d connections are ok [%s]\n", len(rpcPool.Connections), initialLen, strings.Join(healthyConnectionNames, ", "))
-	return &rpcPool, nil
+	if _, ok := nodes[poolCfg.Base]; poolCfg.Base != "" && !ok {
+		return &ConnectionError{Name: poolCfg.Base, Err: ErrConnectionNotFound}
+	}
+
+	r.strategy, r.criticalStrategy = strategy, criticalStrategy
+	r.hedges = poolCfg.Hedge
+	r.base = poolCfg.Base
+	return nil
+}
+
+// checkHealth checks once if node is healthy and marks connection accordingly.
+func (c *Connection) checkHealth() bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 2000*time.Millisecond)
+	health, err := c.RPCClient.GetHealth(ctx)
+	cancel()
+
+	if err != nil || health != "ok" {
+		reason := fmt.Sprintf("health: %s", health)
+		code := -1
+		if err != nil {
+			reason = err.Error()
+		}
+
+		var asErr *jsonrpc.RPCError
+		if errors.As(err, &asErr) {
+			reason = asErr.Message
+			code = asErr.Code
+		}
+
+		fmt.Printf("Unhealthy connection: %s (reason: %s, code: %d)\n", c.ConnectionInfo.Name, reason, code)
+		c.setHealth(false, reason)
+		return false
+	}
+
+	fmt.Printf("Connection %s is healthy\n", c.ConnectionInfo.Name)
+	return true
 }
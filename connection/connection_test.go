@@ -0,0 +1,440 @@
+package connection
+
+import (
+	"context"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/gagliardetto/solana-go/rpc/jsonrpc"
+	"github.com/gorilla/websocket"
+	"github.com/patrulek/rayscan/config"
+	"github.com/patrulek/rayscan/fakerpc"
+	"github.com/pelletier/go-toml"
+)
+
+// testPoolConfig returns default pool settings without background health checks.
+func testPoolConfig(t *testing.T) config.Pool {
+	t.Helper()
+
+	var cfg config.Pool
+	if err := toml.Unmarshal(nil, &cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg.HealthInterval = 0
+	return cfg
+}
+
+// newTestServers starts fake server for every given name; servers are closed with the test.
+func newTestServers(t *testing.T, fixtures map[string]fakerpc.Fixtures) (map[string]*fakerpc.Server, map[string]config.RPCNode) {
+	t.Helper()
+
+	servers := make(map[string]*fakerpc.Server)
+	nodes := make(map[string]config.RPCNode)
+
+	for name, f := range fixtures {
+		s := fakerpc.NewServer(f)
+		t.Cleanup(s.Close)
+
+		servers[name] = s
+		nodes[name] = config.RPCNode{RPCEndpoint: s.RPCURL(), WSEndpoint: s.WSURL()}
+	}
+
+	return servers, nodes
+}
+
+func newTestPool(t *testing.T, nodes map[string]config.RPCNode, cfg config.Pool) *RPCPool {
+	t.Helper()
+
+	pool, err := NewRPCClientPool(nodes, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+
+	return pool
+}
+
+func TestPoolKeepsUnhealthyNodeOutOfRotation(t *testing.T) {
+	servers, nodes := newTestServers(t, map[string]fakerpc.Fixtures{
+		"healthy": {Slot: 100},
+		"behind":  {Slot: 50, Health: "Node is behind by 50 slots"},
+	})
+	pool := newTestPool(t, nodes, testPoolConfig(t))
+
+	behind, err := pool.NamedConnection("behind")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if behind.Healthy() {
+		t.Fatalf("expected node failing health check to be unhealthy")
+	}
+
+	for i := 0; i < 4; i++ {
+		if _, err := pool.Client().GetSlot(context.Background(), rpc.CommitmentProcessed); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := servers["healthy"].AssertCalled("getSlot", 4); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := servers["behind"].AssertCalled("getSlot", 0); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPoolFailsWithoutHealthyNodes(t *testing.T) {
+	_, nodes := newTestServers(t, map[string]fakerpc.Fixtures{
+		"a": {Health: "unhealthy"},
+		"b": {Health: "unhealthy"},
+	})
+
+	if _, err := NewRPCClientPool(nodes, testPoolConfig(t)); !errors.Is(err, ErrNoHealthyConnections) {
+		t.Fatalf("expected ErrNoHealthyConnections, got %v", err)
+	}
+}
+
+func TestRateLimitedConnectionCoolsDown(t *testing.T) {
+	servers, nodes := newTestServers(t, map[string]fakerpc.Fixtures{"a": {}, "b": {}})
+	pool := newTestPool(t, nodes, testPoolConfig(t))
+
+	servers["a"].InjectFault("getSlot", fakerpc.Fault{HTTPStatus: 429, RetryAfter: 3 * time.Second, Times: 1})
+
+	a, _ := pool.NamedConnection("a")
+	if _, err := a.RPCClient.GetSlot(context.Background(), rpc.CommitmentProcessed); ClassifyError(err) != ErrorRateLimited {
+		t.Fatalf("expected rate limited error, got %v", err)
+	}
+
+	stats := a.Stats()
+	if stats.RateLimited != 1 || stats.Cooldowns != 1 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+
+	// Retry-After is longer than exponential cooldown.
+	if until := time.Until(stats.CooldownUntil); until < 2*time.Second || until > 3*time.Second {
+		t.Fatalf("expected cooldown of Retry-After, got %v", until)
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := pool.Client().GetSlot(context.Background(), rpc.CommitmentProcessed); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := servers["b"].AssertCalled("getSlot", 3); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWaitForCooldownRespectsContext(t *testing.T) {
+	servers, nodes := newTestServers(t, map[string]fakerpc.Fixtures{"a": {}})
+	pool := newTestPool(t, nodes, testPoolConfig(t))
+
+	servers["a"].InjectFault("getSlot", fakerpc.Fault{HTTPStatus: 429, RetryAfter: 5 * time.Second, Times: 1})
+	pool.Client().GetSlot(context.Background(), rpc.CommitmentProcessed)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	errC := make(chan error, 1)
+	go func() {
+		_, err := pool.RoleClientForMethod(ctx, RoleAny, "getSlot")
+		errC <- err
+	}()
+
+	// Pool isn't locked while waiting.
+	time.Sleep(100 * time.Millisecond)
+	statsC := make(chan struct{})
+	go func() {
+		pool.Stats()
+		pool.Reload(nodes, testPoolConfig(t))
+		close(statsC)
+	}()
+
+	select {
+	case <-statsC:
+	case <-time.After(50 * time.Millisecond):
+		t.Fatalf("pool is locked while waiting for cooldown")
+	}
+
+	if err := <-errC; !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+}
+
+func TestSelectFailsWithoutMatchingConnections(t *testing.T) {
+	_, nodes := newTestServers(t, map[string]fakerpc.Fixtures{"a": {}})
+	pool := newTestPool(t, nodes, testPoolConfig(t))
+
+	if _, err := pool.RoleClientForMethod(context.Background(), RoleSendTx, ""); !errors.Is(err, ErrNoConnectionForRole) {
+		t.Fatalf("expected ErrNoConnectionForRole, got %v", err)
+	}
+
+	if _, err := pool.Reload(map[string]config.RPCNode{}, testPoolConfig(t)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := pool.RoleClientForMethod(context.Background(), RoleAny, ""); !errors.Is(err, ErrNoConnectionForRole) {
+		t.Fatalf("expected ErrNoConnectionForRole of empty pool, got %v", err)
+	}
+
+	if pool.Client() != nil {
+		t.Fatalf("expected no client of empty pool")
+	}
+}
+
+func TestNodeBehindErrorCoolsDown(t *testing.T) {
+	servers, nodes := newTestServers(t, map[string]fakerpc.Fixtures{"a": {}})
+	pool := newTestPool(t, nodes, testPoolConfig(t))
+
+	servers["a"].InjectFault("getSlot", fakerpc.Fault{RPCError: &jsonrpc.RPCError{Code: rpcCodeNodeUnhealthy, Message: "Node is behind"}, Times: 1})
+
+	a, _ := pool.NamedConnection("a")
+	if _, err := a.RPCClient.GetSlot(context.Background(), rpc.CommitmentProcessed); ClassifyError(err) != ErrorNodeBehind {
+		t.Fatalf("expected node behind error, got %v", err)
+	}
+
+	if stats := a.Stats(); stats.NodeBehind != 1 || time.Until(stats.CooldownUntil) < nodeBehindCooldown-time.Second {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestCallerDeadlineDoesNotCoolDown(t *testing.T) {
+	servers, nodes := newTestServers(t, map[string]fakerpc.Fixtures{"a": {}, "b": {}})
+
+	// Node b times out requests itself.
+	b := nodes["b"]
+	b.Timeout = 50 * time.Millisecond
+	nodes["b"] = b
+
+	pool := newTestPool(t, nodes, testPoolConfig(t))
+	servers["a"].SetLatency("getSlot", 200*time.Millisecond)
+	servers["b"].SetLatency("getSlot", 200*time.Millisecond)
+
+	for name, timeout := range map[string]time.Duration{"a": 50 * time.Millisecond, "b": time.Second} {
+		conn, _ := pool.NamedConnection(name)
+
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		_, err := conn.RPCClient.GetSlot(ctx, rpc.CommitmentProcessed)
+		cancel()
+
+		if ClassifyError(err) != ErrorTimeout {
+			t.Fatalf("expected timeout of %s, got %v", name, err)
+		}
+	}
+
+	if stats := pool.Stats()["a"]; stats.Timeouts != 0 || !stats.CooldownUntil.IsZero() {
+		t.Fatalf("expected caller's deadline not to cool node down: %+v", stats)
+	}
+
+	if stats := pool.Stats()["b"]; stats.Timeouts != 1 || stats.CooldownUntil.IsZero() {
+		t.Fatalf("expected node timeout to cool node down: %+v", stats)
+	}
+}
+
+func TestNotFoundDoesNotCoolDown(t *testing.T) {
+	_, nodes := newTestServers(t, map[string]fakerpc.Fixtures{"a": {}})
+	pool := newTestPool(t, nodes, testPoolConfig(t))
+
+	a, _ := pool.NamedConnection("a")
+	_, err := a.RPCClient.GetTransaction(context.Background(), [64]byte{1}, nil)
+	if !errors.Is(err, rpc.ErrNotFound) {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+
+	if stats := a.Stats(); stats.Errors != 0 || !stats.CooldownUntil.IsZero() {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestHedgeReturnsFastestAnswer(t *testing.T) {
+	servers, nodes := newTestServers(t, map[string]fakerpc.Fixtures{"slow": {Slot: 1}, "fast": {Slot: 2}})
+
+	cfg := testPoolConfig(t)
+	cfg.Hedge = map[string]config.Hedge{"getSlot": {Fanout: 2}}
+	pool := newTestPool(t, nodes, cfg)
+
+	servers["slow"].SetLatency("getSlot", time.Second)
+
+	start := time.Now()
+	slot, winner, err := Hedge(context.Background(), pool, RoleAny, "getSlot", "slow", func(ctx context.Context, client *rpc.Client) (uint64, error) {
+		return client.GetSlot(ctx, rpc.CommitmentProcessed)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if winner != "fast" || slot != 2 || time.Since(start) > 500*time.Millisecond {
+		t.Fatalf("expected fast answer, got slot %d from %s after %v", slot, winner, time.Since(start))
+	}
+
+	for name, want := range map[string]uint64{"slow": 0, "fast": 1} {
+		if stats := pool.Stats()[name]; stats.Hedged != 1 || stats.HedgeWins != want {
+			t.Fatalf("unexpected hedge stats of %s: %+v", name, stats)
+		}
+	}
+}
+
+func TestHedgeStopsOnNotFound(t *testing.T) {
+	servers, nodes := newTestServers(t, map[string]fakerpc.Fixtures{"a": {}, "b": {}})
+
+	cfg := testPoolConfig(t)
+	cfg.Hedge = map[string]config.Hedge{"getTransaction": {Fanout: 2, Delay: 100 * time.Millisecond}}
+	pool := newTestPool(t, nodes, cfg)
+
+	_, winner, err := Hedge(context.Background(), pool, RoleAny, "getTransaction", "a", func(ctx context.Context, client *rpc.Client) (*rpc.GetTransactionResult, error) {
+		return client.GetTransaction(ctx, [64]byte{1}, nil)
+	})
+	if !errors.Is(err, rpc.ErrNotFound) || winner != "a" {
+		t.Fatalf("expected not found answer of a, got %v from %s", err, winner)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	if err := servers["b"].AssertCalled("getTransaction", 0); err != nil {
+		t.Fatalf("expected no hedged request after not found answer: %v", err)
+	}
+}
+
+// newWSServer starts websocket server accepting every connection; it's closed with the test.
+func newWSServer(t *testing.T, tls bool) *httptest.Server {
+	t.Helper()
+
+	var upgrader websocket.Upgrader
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if conn, err := upgrader.Upgrade(w, r, nil); err == nil {
+			conn.Close()
+		}
+	})
+
+	s := httptest.NewUnstartedServer(handler)
+	if tls {
+		s.StartTLS()
+	} else {
+		s.Start()
+	}
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func TestDialWSConnUsesNodeTLS(t *testing.T) {
+	s := newWSServer(t, true)
+	node := config.RPCNode{Name: "node", RPCEndpoint: s.URL, WSEndpoint: "wss" + strings.TrimPrefix(s.URL, "https")}
+
+	conn, err := newConnection(node)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := conn.DialWSConn(context.Background()); err == nil {
+		t.Fatalf("expected self-signed certificate to be rejected without CA file")
+	}
+
+	node.TLSCAFile = filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(node.TLSCAFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.Certificate().Raw}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if conn, err = newConnection(node); err != nil {
+		t.Fatal(err)
+	}
+
+	wsConn, err := conn.DialWSConn(context.Background())
+	if err != nil {
+		t.Fatalf("expected certificate to be trusted with CA file: %v", err)
+	}
+	wsConn.Close()
+}
+
+func TestDialWSConnUsesNodeProxy(t *testing.T) {
+	s := newWSServer(t, false)
+
+	// Proxy tunnels CONNECT requests to their target.
+	var tunnels atomic.Int32
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect {
+			http.Error(w, "only CONNECT is supported", http.StatusMethodNotAllowed)
+			return
+		}
+
+		target, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer target.Close()
+
+		client, buf, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer client.Close()
+
+		tunnels.Add(1)
+		client.Write([]byte("HTTP/1.1 200 OK\r\n\r\n"))
+		go io.Copy(target, buf)
+		io.Copy(client, target)
+	}))
+	t.Cleanup(proxy.Close)
+
+	node := config.RPCNode{Name: "node", RPCEndpoint: s.URL, WSEndpoint: "ws" + strings.TrimPrefix(s.URL, "http"), Proxy: proxy.URL}
+
+	conn, err := newConnection(node)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wsConn, err := conn.DialWSConn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	wsConn.Close()
+
+	if tunnels.Load() != 1 {
+		t.Fatalf("expected websocket to be dialed through proxy, got %d tunnels", tunnels.Load())
+	}
+}
+
+func TestConnectHookMayUsePool(t *testing.T) {
+	_, nodes := newTestServers(t, map[string]fakerpc.Fixtures{"a": {}, "b": {}})
+	pool := newTestPool(t, map[string]config.RPCNode{"a": nodes["a"]}, testPoolConfig(t))
+
+	var hooked []string
+	pool.SetConnectHook(func(c *Connection) {
+		hooked = append(hooked, c.ConnectionInfo.Name)
+		pool.ConnectionList() // Takes pool lock.
+	})
+
+	doneC := make(chan error, 1)
+	go func() {
+		_, err := pool.Reload(nodes, testPoolConfig(t))
+		doneC <- err
+	}()
+
+	select {
+	case err := <-doneC:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("reload deadlocked in connect hook")
+	}
+
+	if len(hooked) != 1 || hooked[0] != "b" {
+		t.Fatalf("expected hook called for added connection only, got %v", hooked)
+	}
+}
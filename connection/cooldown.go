@@ -0,0 +1,177 @@
+package connection
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+const (
+	cooldownBase       = 500 * time.Millisecond // Cooldown after first failure; doubled with each consecutive one.
+	cooldownMax        = time.Minute
+	nodeBehindCooldown = 10 * time.Second // Minimal cooldown of node that is behind; it rarely catches up immediately.
+)
+
+// ConnectionStats are counters of requests sent through connection.
+type ConnectionStats struct {
+	Requests      uint64
+	Errors        uint64
+	RateLimited   uint64
+	Timeouts      uint64
+	NodeBehind    uint64
+	Cooldowns     uint64
+	Throttled     uint64 // Requests that waited for rate limit budget.
+	Hedged        uint64 // Hedged requests connection took part in.
+	HedgeWins     uint64 // Hedged requests connection answered first.
+	CooldownUntil time.Time
+	P50Latency    time.Duration // Median latency of recent successful requests.
+	Outstanding   int64         // Requests in flight.
+}
+
+// CooldownUntil returns time until which connection shouldn't be used.
+func (c *Connection) CooldownUntil() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.cooldownUntil
+}
+
+// Stats returns copy of connection counters.
+func (c *Connection) Stats() ConnectionStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.CooldownUntil = c.cooldownUntil
+	stats.P50Latency = c.latency.p50()
+	stats.Outstanding = c.outstanding.Load()
+	return stats
+}
+
+// report updates counters with result of a request sent with given context and puts connection on exponential cooldown
+// if node is overloaded or failing. Request that outlived caller's context is counted as canceled, not as node timeout.
+func (c *Connection) report(ctx context.Context, err error, latency time.Duration) {
+	class := ClassifyError(err)
+	if class == ErrorTimeout && ctx.Err() != nil {
+		class = ErrorCanceled // Caller's deadline, not node's request timeout.
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.stats.Requests++
+
+	switch class {
+	case ErrorNone, ErrorNotFound:
+		c.failures = 0
+		c.latency.add(latency)
+		return
+	case ErrorCanceled:
+		return
+	case ErrorOther:
+		c.stats.Errors++
+		return
+	}
+
+	c.stats.Errors++
+	c.failures++
+
+	cooldown := cooldownBase << min(c.failures-1, 16)
+	if cooldown > cooldownMax {
+		cooldown = cooldownMax
+	}
+
+	switch class {
+	case ErrorRateLimited:
+		c.stats.RateLimited++
+		if c.retryAfter > cooldown {
+			cooldown = c.retryAfter
+		}
+		c.retryAfter = 0
+	case ErrorTimeout:
+		c.stats.Timeouts++
+	case ErrorNodeBehind:
+		c.stats.NodeBehind++
+		cooldown = max(cooldown, nodeBehindCooldown)
+	}
+
+	c.stats.Cooldowns++
+	c.cooldownUntil = time.Now().Add(cooldown)
+	fmt.Printf("[%v] RPCPool: connection %s on cooldown for %v (reason: %s, consecutive failures: %d)\n", time.Now().Format("2006-01-02 15:04:05.000"), c.ConnectionInfo.Name, cooldown, class, c.failures)
+}
+
+func (c *Connection) setRetryAfter(retryAfter time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.retryAfter = retryAfter
+}
+
+// trackingClient reports result of every request to its connection.
+type trackingClient struct {
+	rpc.JSONRPCClient
+	conn *Connection
+}
+
+func (t *trackingClient) CallForInto(ctx context.Context, out interface{}, method string, params []interface{}) error {
+	if err := t.conn.acquire(ctx, method); err != nil {
+		return err
+	}
+
+	t.conn.outstanding.Add(1)
+	start := time.Now()
+	err := t.JSONRPCClient.CallForInto(ctx, out, method, params)
+	t.conn.outstanding.Add(-1)
+
+	t.conn.report(ctx, err, time.Since(start))
+	return err
+}
+
+func (t *trackingClient) Close() error {
+	if c, ok := t.JSONRPCClient.(io.Closer); ok {
+		return c.Close()
+	}
+
+	return nil
+}
+
+// retryAfterClient passes Retry-After header of rate limited responses to its connection.
+type retryAfterClient struct {
+	*http.Client
+	conn *Connection
+}
+
+func (h *retryAfterClient) Do(req *http.Request) (*http.Response, error) {
+	resp, err := h.Client.Do(req)
+	if err != nil || resp.StatusCode != http.StatusTooManyRequests {
+		return resp, err
+	}
+
+	if retryAfter := parseRetryAfter(resp.Header.Get("Retry-After")); retryAfter > 0 {
+		h.conn.setRetryAfter(retryAfter)
+	}
+
+	return resp, err
+}
+
+// parseRetryAfter parses Retry-After header given either in seconds or as HTTP date.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if t, err := http.ParseTime(value); err == nil {
+		return time.Until(t)
+	}
+
+	return 0
+}
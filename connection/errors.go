@@ -0,0 +1,143 @@
+package connection
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/gagliardetto/solana-go/rpc/jsonrpc"
+)
+
+// Errors returned by pool lookups; use errors.Is to check them.
+var (
+	ErrConnectionNotFound   = errors.New("connection not found")
+	ErrNoBaseConnection     = errors.New("no base connection configured")
+	ErrNoHealthyConnections = errors.New("no healthy connections found")
+	ErrUnknownStrategy      = errors.New("unknown connection selection strategy")
+	ErrUnknownRole          = errors.New("unknown connection role")
+	ErrNoConnectionForRole  = errors.New("no connection with role")
+)
+
+// ConnectionError is an error related to connection with given name.
+type ConnectionError struct {
+	Name string
+	Err  error
+}
+
+func (e *ConnectionError) Error() string {
+	return fmt.Sprintf("connection %s: %s", e.Name, e.Err)
+}
+
+func (e *ConnectionError) Unwrap() error {
+	return e.Err
+}
+
+// ErrorClass tells how RPC error should affect connection that returned it.
+type ErrorClass int
+
+const (
+	ErrorNone        ErrorClass = iota
+	ErrorOther                  // Any other error; doesn't put connection on cooldown.
+	ErrorCanceled               // Request canceled by caller; not a node fault.
+	ErrorNotFound               // Requested data not available (yet); not a node fault.
+	ErrorRateLimited            // HTTP 429 or JSON-RPC rate limit error.
+	ErrorTimeout                // Request timed out.
+	ErrorNodeBehind             // Node is unhealthy or behind the cluster.
+)
+
+func (c ErrorClass) String() string {
+	switch c {
+	case ErrorNone:
+		return "none"
+	case ErrorCanceled:
+		return "canceled"
+	case ErrorNotFound:
+		return "not found"
+	case ErrorRateLimited:
+		return "rate limited"
+	case ErrorTimeout:
+		return "timeout"
+	case ErrorNodeBehind:
+		return "node behind"
+	default:
+		return "other"
+	}
+}
+
+// JSON-RPC error codes returned by Solana nodes and popular providers.
+const (
+	rpcCodeNodeUnhealthy            = -32005 // Node is behind by N slots.
+	rpcCodeBlockNotAvailable        = -32004
+	rpcCodeMinContextSlotNotReached = -32016
+	rpcCodeRateLimited              = -32429 // Used by some providers instead of HTTP 429.
+	rpcCodeTooManyRequests          = 429
+
+	// Invalid requests; every node answers them the same way.
+	rpcCodeInvalidRequest             = -32600
+	rpcCodeMethodNotFound             = -32601
+	rpcCodeInvalidParams              = -32602
+	rpcCodeUnsupportedTransactionVers = -32015 // Transaction version higher than maxSupportedTransactionVersion.
+)
+
+// IsPermanentError tells if request failed because of itself, not because of the node, so retrying it is pointless.
+func IsPermanentError(err error) bool {
+	var rpcErr *jsonrpc.RPCError
+	if !errors.As(err, &rpcErr) {
+		return false
+	}
+
+	switch rpcErr.Code {
+	case rpcCodeInvalidRequest, rpcCodeMethodNotFound, rpcCodeInvalidParams, rpcCodeUnsupportedTransactionVers:
+		return true
+	}
+
+	return false
+}
+
+// ClassifyError tells what kind of failure given RPC error is.
+func ClassifyError(err error) ErrorClass {
+	if err == nil {
+		return ErrorNone
+	}
+
+	if errors.Is(err, rpc.ErrNotFound) {
+		return ErrorNotFound
+	}
+
+	if errors.Is(err, context.Canceled) {
+		return ErrorCanceled
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrorTimeout
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return ErrorTimeout
+	}
+
+	var httpErr *jsonrpc.HTTPError
+	if errors.As(err, &httpErr) && httpErr.Code == 429 {
+		return ErrorRateLimited
+	}
+
+	var rpcErr *jsonrpc.RPCError
+	if errors.As(err, &rpcErr) {
+		switch rpcErr.Code {
+		case rpcCodeRateLimited, rpcCodeTooManyRequests:
+			return ErrorRateLimited
+		case rpcCodeNodeUnhealthy, rpcCodeBlockNotAvailable, rpcCodeMinContextSlotNotReached:
+			return ErrorNodeBehind
+		}
+
+		if msg := strings.ToLower(rpcErr.Message); strings.Contains(msg, "rate limit") || strings.Contains(msg, "too many requests") {
+			return ErrorRateLimited
+		}
+	}
+
+	return ErrorOther
+}
@@ -0,0 +1,207 @@
+package connection
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/patrulek/rayscan/config"
+)
+
+// HealthEvent is published when connection is taken out of rotation or brought back.
+type HealthEvent struct {
+	Connection string
+	Healthy    bool
+	Reason     string // Reason of failed check; empty for recovered connection.
+	Slot       uint64
+	SlotLag    uint64 // Slots behind highest-slot connection.
+	Latency    time.Duration
+	Time       time.Time
+}
+
+// Healthy returns false if connection failed last health check.
+func (c *Connection) Healthy() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return !c.unhealthy
+}
+
+// HealthReason returns reason of last failed health check.
+func (c *Connection) HealthReason() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.healthReason
+}
+
+// setHealth updates health state of connection and returns true if it changed.
+func (c *Connection) setHealth(healthy bool, reason string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	changed := c.unhealthy == healthy
+	c.unhealthy = !healthy
+	c.healthReason = reason
+	return changed
+}
+
+// HealthChecker periodically probes every connection of the pool (health, slot lag and latency) and takes failing ones out of rotation until they recover.
+type HealthChecker struct {
+	rpcPool *RPCPool
+	cfg     config.Pool
+
+	stopC chan struct{}
+	doneC chan struct{}
+
+	running atomic.Bool
+}
+
+func NewHealthChecker(rpcPool *RPCPool, cfg config.Pool) *HealthChecker {
+	return &HealthChecker{
+		rpcPool: rpcPool,
+		cfg:     cfg,
+		stopC:   make(chan struct{}),
+		doneC:   make(chan struct{}),
+	}
+}
+
+func (h *HealthChecker) Start(eventPublishC chan<- HealthEvent) error {
+	if h.cfg.HealthInterval <= 0 {
+		return fmt.Errorf("health interval has to be positive")
+	}
+
+	if !h.running.CompareAndSwap(false, true) {
+		return fmt.Errorf("HealthChecker is already running")
+	}
+
+	fmt.Printf("[%v] HealthChecker: starting (interval: %v, max slot lag: %d, max latency: %v)...\n", time.Now().Format("2006-01-02 15:04:05.000"), h.cfg.HealthInterval, h.cfg.MaxSlotLag, h.cfg.MaxLatency)
+
+	go func() {
+		defer close(h.doneC)
+
+		ticker := time.NewTicker(h.cfg.HealthInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-h.stopC:
+				return
+			case <-ticker.C:
+				for _, event := range h.Check() {
+					select {
+					case eventPublishC <- event:
+					case <-h.stopC:
+						return
+					}
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+type probeResult struct {
+	slot    uint64
+	latency time.Duration
+	err     error
+}
+
+// Check probes all connections once, updates their health and returns events of connections whose health changed.
+func (h *HealthChecker) Check() []HealthEvent {
+	conns := h.rpcPool.ConnectionList()
+	results := make([]probeResult, len(conns))
+
+	var wg sync.WaitGroup
+	for i, conn := range conns {
+		wg.Add(1)
+		go func(i int, conn *Connection) {
+			defer wg.Done()
+			results[i] = h.probe(conn)
+		}(i, conn)
+	}
+	wg.Wait()
+
+	var highestSlot uint64
+	for _, result := range results {
+		if result.err == nil {
+			highestSlot = max(highestSlot, result.slot)
+		}
+	}
+
+	var events []HealthEvent
+	now := time.Now()
+
+	for i, conn := range conns {
+		result := results[i]
+		lag := highestSlot - min(highestSlot, result.slot)
+
+		var reason string
+		switch {
+		case result.err != nil:
+			reason = result.err.Error()
+		case h.cfg.MaxSlotLag > 0 && lag > h.cfg.MaxSlotLag:
+			reason = fmt.Sprintf("slot lag %d exceeds %d", lag, h.cfg.MaxSlotLag)
+		case h.cfg.MaxLatency > 0 && result.latency > h.cfg.MaxLatency:
+			reason = fmt.Sprintf("latency %v exceeds %v", result.latency, h.cfg.MaxLatency)
+		}
+
+		if !conn.setHealth(reason == "", reason) {
+			continue
+		}
+
+		events = append(events, HealthEvent{
+			Connection: conn.ConnectionInfo.Name,
+			Healthy:    reason == "",
+			Reason:     reason,
+			Slot:       result.slot,
+			SlotLag:    lag,
+			Latency:    result.latency,
+			Time:       now,
+		})
+	}
+
+	return events
+}
+
+// probe checks node health and reads its current slot.
+func (h *HealthChecker) probe(conn *Connection) probeResult {
+	ctx, cancel := context.WithTimeout(context.Background(), min(h.cfg.HealthInterval, 5*time.Second))
+	defer cancel()
+
+	start := time.Now()
+	health, err := conn.RPCClient.GetHealth(ctx)
+	if err != nil {
+		return probeResult{err: err}
+	}
+
+	if health != rpc.HealthOk {
+		return probeResult{err: fmt.Errorf("health: %s", health)}
+	}
+
+	slot, err := conn.RPCClient.GetSlot(ctx, rpc.CommitmentProcessed)
+	if err != nil {
+		return probeResult{err: err}
+	}
+
+	return probeResult{slot: slot, latency: time.Since(start) / 2} // Mean latency of both requests.
+}
+
+func (h *HealthChecker) Stop(ctx context.Context) error {
+	if !h.running.CompareAndSwap(true, false) {
+		return fmt.Errorf("HealthChecker is not running")
+	}
+
+	close(h.stopC)
+
+	select {
+	case <-h.doneC:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,141 @@
+package connection
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+// Hedge sends the same read request to connections chosen by critical strategy, as configured for given method,
+// and returns first successful result along with name of connection that answered it. Remaining requests are canceled.
+// Error wrapping rpc.ErrNotFound is a final answer as well; it's returned at once without launching further requests.
+// Preferred connection, if given and usable, is asked first. Without hedging configured request is sent to single connection.
+// If all requests fail, error of first failed one is returned.
+// Only connections with given role are used.
+func Hedge[T any](ctx context.Context, r *RPCPool, role Role, method, prefer string, call func(ctx context.Context, client *rpc.Client) (T, error)) (T, string, error) {
+	var zero T
+
+	r.mu.RLock()
+	hedge := r.hedges[method] // Replaced by reload.
+	r.mu.RUnlock()
+
+	conns, err := r.hedgeConnections(ctx, role, method, prefer, max(1, hedge.Fanout))
+	if err != nil {
+		return zero, "", err
+	}
+
+	type result struct {
+		conn  *Connection
+		value T
+		err   error
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan result, len(conns))
+	launched, pending := 0, 0
+
+	launch := func() {
+		conn := conns[launched]
+		launched++
+		pending++
+
+		go func() {
+			value, err := call(ctx, conn.RPCClient)
+			results <- result{conn: conn, value: value, err: err}
+		}()
+	}
+
+	launch()
+	for hedge.Delay <= 0 && launched < len(conns) {
+		launch()
+	}
+
+	timer := time.NewTimer(hedge.Delay)
+	defer timer.Stop()
+
+	var firstErr error
+
+	for {
+		select {
+		case <-ctx.Done():
+			return zero, "", ctx.Err()
+		case <-timer.C:
+			if launched < len(conns) {
+				launch()
+				timer.Reset(hedge.Delay)
+			}
+		case res := <-results:
+			pending--
+
+			// Not found is a valid answer (eg. transaction isn't confirmed yet); other nodes wouldn't know better.
+			if res.err == nil || errors.Is(res.err, rpc.ErrNotFound) {
+				if len(conns) > 1 {
+					r.recordHedge(conns[:launched], res.conn)
+				}
+
+				return res.value, res.conn.ConnectionInfo.Name, res.err
+			}
+
+			if firstErr == nil {
+				firstErr = res.err
+			}
+
+			// Don't wait for hedge delay if request already failed.
+			if launched < len(conns) {
+				launch()
+				timer.Reset(hedge.Delay)
+			} else if pending == 0 {
+				return zero, "", firstErr
+			}
+		}
+	}
+}
+
+// hedgeConnections returns up to n distinct connections for hedged request, first of them chosen by critical strategy or preferred one.
+func (r *RPCPool) hedgeConnections(ctx context.Context, role Role, method, prefer string, n int) ([]*Connection, error) {
+	var conns []*Connection
+	err := r.waitCandidates(ctx, role, method, func(candidates []int) {
+		first := -1
+		for _, idx := range candidates {
+			if r.Connections[idx].ConnectionInfo.Name == prefer {
+				first = idx
+			}
+		}
+
+		if first == -1 {
+			first = r.pick(candidates, r.criticalStrategy)
+			r.CurrentIdx = (first + 1) % len(r.Connections)
+		}
+
+		conns = []*Connection{r.Connections[first]}
+		for _, idx := range candidates {
+			if len(conns) == n {
+				break
+			}
+
+			if idx != first {
+				conns = append(conns, r.Connections[idx])
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return conns, nil
+}
+
+func (r *RPCPool) recordHedge(conns []*Connection, winner *Connection) {
+	for _, conn := range conns {
+		conn.mu.Lock()
+		conn.stats.Hedged++
+		if conn == winner {
+			conn.stats.HedgeWins++
+		}
+		conn.mu.Unlock()
+	}
+}
@@ -0,0 +1,109 @@
+package connection
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// tokenBucket limits rate of requests; it holds up to burst tokens and refills them at given rate per second.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if burst < 1 {
+		burst = max(1, int(rate))
+	}
+
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// refill adds tokens accumulated since last refill. Caller has to hold the lock.
+func (b *tokenBucket) refill(now time.Time) {
+	b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+}
+
+// available returns true if request can be sent without waiting.
+func (b *tokenBucket) available(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill(now)
+	return b.tokens >= 1
+}
+
+// wait takes a token, waiting until it's available. Returns true if request had to wait.
+func (b *tokenBucket) wait(ctx context.Context) (bool, error) {
+	b.mu.Lock()
+	b.refill(time.Now())
+	b.tokens-- // Reserve token even if it's not available yet, so waiting requests are served in order.
+	delay := time.Duration(-b.tokens / b.rate * float64(time.Second))
+	b.mu.Unlock()
+
+	if delay <= 0 {
+		return false, nil
+	}
+
+	select {
+	case <-time.After(delay):
+		return true, nil
+	case <-ctx.Done():
+		b.mu.Lock()
+		b.tokens++ // Give back reserved token.
+		b.mu.Unlock()
+		return true, ctx.Err()
+	}
+}
+
+// hasBudget returns true if request of given method can be sent through connection without waiting.
+func (c *Connection) hasBudget(method string, now time.Time) bool {
+	if c.limiter != nil && !c.limiter.available(now) {
+		return false
+	}
+
+	if limiter, ok := c.methodLimiters[method]; ok && !limiter.available(now) {
+		return false
+	}
+
+	return true
+}
+
+// acquire waits until request of given method fits into connection's budgets.
+func (c *Connection) acquire(ctx context.Context, method string) error {
+	var throttled bool
+
+	if c.limiter != nil {
+		waited, err := c.limiter.wait(ctx)
+		if err != nil {
+			return err
+		}
+		throttled = waited
+	}
+
+	if limiter, ok := c.methodLimiters[method]; ok {
+		waited, err := limiter.wait(ctx)
+		if err != nil {
+			return err
+		}
+		throttled = throttled || waited
+	}
+
+	if throttled {
+		c.mu.Lock()
+		c.stats.Throttled++
+		c.mu.Unlock()
+	}
+
+	return nil
+}
@@ -0,0 +1,98 @@
+package connection
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/patrulek/rayscan/config"
+)
+
+// ReloadResult lists connections changed by Reload; connection of changed node is both removed and added.
+type ReloadResult struct {
+	Added   []*Connection
+	Removed []*Connection
+}
+
+// SetConnectHook sets function called for every connection added by Reload before it's used by the pool.
+// Hook is called without pool lock held, so it may use the pool.
+func (r *RPCPool) SetConnectHook(hook func(*Connection)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.connectHook = hook
+}
+
+// Reload applies new nodes and pool settings: connections of removed or changed nodes are closed
+// and connections of new or changed nodes are created; connections of unchanged nodes keep their state.
+// Pool is left unchanged if settings are invalid.
+func (r *RPCPool) Reload(nodes map[string]config.RPCNode, poolCfg config.Pool) (ReloadResult, error) {
+	var result ReloadResult
+
+	if err := (&RPCPool{}).configure(nodes, poolCfg); err != nil {
+		return result, err
+	}
+
+	current := make(map[string]*Connection)
+	for _, c := range r.ConnectionList() {
+		current[c.ConnectionInfo.Name] = c
+	}
+
+	var conns []*Connection
+	for name, node := range nodes {
+		node.Name = name
+		if c, ok := current[name]; ok && reflect.DeepEqual(c.ConnectionInfo, node) {
+			conns = append(conns, c)
+			continue
+		}
+
+		c, err := newConnection(node)
+		if err != nil {
+			for _, added := range result.Added {
+				added.RPCClient.Close()
+			}
+
+			return ReloadResult{}, &ConnectionError{Name: name, Err: err}
+		}
+
+		c.checkHealth()
+		result.Added = append(result.Added, c)
+		conns = append(conns, c)
+	}
+
+	for name, c := range current {
+		if node, ok := nodes[name]; ok {
+			node.Name = name
+			if reflect.DeepEqual(c.ConnectionInfo, node) {
+				continue
+			}
+		}
+
+		result.Removed = append(result.Removed, c)
+	}
+
+	r.mu.RLock()
+	hook := r.connectHook
+	r.mu.RUnlock()
+
+	if hook != nil {
+		for _, c := range result.Added {
+			hook(c)
+		}
+	}
+
+	r.mu.Lock()
+	r.configure(nodes, poolCfg)
+	r.Connections = conns
+	r.CurrentIdx = 0
+	strategy, criticalStrategy := r.strategy, r.criticalStrategy
+	r.mu.Unlock()
+
+	// Requests already sent through removed connections are completed by their HTTP clients.
+	for _, c := range result.Removed {
+		c.RPCClient.Close()
+	}
+
+	fmt.Printf("[%v] RPCPool: reloaded (connections: %d, added: %d, removed: %d, strategy: %s, critical strategy: %s)\n", time.Now().Format("2006-01-02 15:04:05.000"), len(conns), len(result.Added), len(result.Removed), strategy, criticalStrategy)
+	return result, nil
+}
@@ -0,0 +1,80 @@
+package connection
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/patrulek/rayscan/config"
+)
+
+// Role is a kind of work connection is used for.
+type Role string
+
+const (
+	RoleAny          Role = ""              // Any connection; used by requests that don't ask for a role.
+	RoleObserver     Role = "observer"      // Subscribes for program logs.
+	RoleTxFetch      Role = "tx-fetch"      // Fetches observed transactions; latency critical.
+	RoleAccountReads Role = "account-reads" // Reads accounts, balances and token supplies.
+	RoleSendTx       Role = "send-tx"       // Sends transactions; should be given only to trusted nodes.
+	RoleBackfill     Role = "backfill"      // Heavy historical queries, eg. signatures of an address.
+)
+
+func ParseRole(s string) (Role, error) {
+	switch role := Role(s); role {
+	case RoleObserver, RoleTxFetch, RoleAccountReads, RoleSendTx, RoleBackfill:
+		return role, nil
+	default:
+		return "", fmt.Errorf("%w: %s", ErrUnknownRole, s)
+	}
+}
+
+// explicit tells if role has to be given to node explicitly; other roles are served by nodes without roles configured.
+func (r Role) explicit() bool {
+	return r == RoleObserver || r == RoleSendTx
+}
+
+// HasRole tells if connection serves requests of given role.
+func (c *Connection) HasRole(role Role) bool {
+	if role == RoleAny {
+		return true
+	}
+
+	if role == RoleObserver && c.ConnectionInfo.Observer {
+		return true
+	}
+
+	if len(c.ConnectionInfo.Roles) == 0 {
+		return !role.explicit()
+	}
+
+	return slices.Contains(c.ConnectionInfo.Roles, string(role))
+}
+
+func (r *RPCPool) hasRole(role Role) bool {
+	for _, c := range r.Connections {
+		if c.HasRole(role) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ValidateConfig checks connection roles and pool strategies of given config; returned error is a *config.KeyError naming the offending key.
+func ValidateConfig(cfg config.Config) error {
+	for key, strategy := range map[string]string{"pool.strategy": cfg.Pool.Strategy, "pool.critical_strategy": cfg.Pool.CriticalStrategy} {
+		if _, err := ParseStrategy(strategy); err != nil {
+			return &config.KeyError{Key: key, Err: err}
+		}
+	}
+
+	for name, node := range cfg.Nodes {
+		for _, role := range node.Roles {
+			if _, err := ParseRole(role); err != nil {
+				return &config.KeyError{Key: fmt.Sprintf("nodes.%s.roles", name), Err: err}
+			}
+		}
+	}
+
+	return nil
+}
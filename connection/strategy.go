@@ -0,0 +1,111 @@
+package connection
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Strategy decides which of usable connections serves next request.
+type Strategy string
+
+const (
+	StrategyRoundRobin       Strategy = "round-robin"       // Connections in turn.
+	StrategyWeighted         Strategy = "weighted"          // Connections in turn, proportionally to their priority.
+	StrategyLatency          Strategy = "latency"           // Connection with lowest median latency of recent requests.
+	StrategyLeastOutstanding Strategy = "least-outstanding" // Connection with fewest requests in flight.
+)
+
+func ParseStrategy(s string) (Strategy, error) {
+	switch strategy := Strategy(s); strategy {
+	case "":
+		return StrategyRoundRobin, nil
+	case StrategyRoundRobin, StrategyWeighted, StrategyLatency, StrategyLeastOutstanding:
+		return strategy, nil
+	default:
+		return "", fmt.Errorf("%w: %s", ErrUnknownStrategy, s)
+	}
+}
+
+// Number of recent request latencies median is calculated from.
+const latencySamples = 64
+
+type latencyWindow struct {
+	samples [latencySamples]time.Duration
+	count   int
+	next    int
+}
+
+func (w *latencyWindow) add(latency time.Duration) {
+	w.samples[w.next] = latency
+	w.next = (w.next + 1) % latencySamples
+	w.count = min(w.count+1, latencySamples)
+}
+
+// p50 returns median of recent latencies; zero if there are no samples yet.
+func (w *latencyWindow) p50() time.Duration {
+	if w.count == 0 {
+		return 0
+	}
+
+	sorted := make([]time.Duration, w.count)
+	copy(sorted, w.samples[:w.count])
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	return sorted[w.count/2]
+}
+
+// P50Latency returns median latency of recent successful requests.
+func (c *Connection) P50Latency() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.latency.p50()
+}
+
+// Outstanding returns number of requests in flight.
+func (c *Connection) Outstanding() int64 {
+	return c.outstanding.Load()
+}
+
+// pick chooses connection from candidates (indexes ordered from current round-robin position) according to strategy.
+// Caller has to hold pool lock.
+func (r *RPCPool) pick(candidates []int, strategy Strategy) int {
+	best := candidates[0]
+
+	switch strategy {
+	case StrategyWeighted:
+		// Smooth weighted round-robin: every candidate gains its weight and the winner loses sum of weights.
+		total := 0
+		for _, idx := range candidates {
+			conn := r.Connections[idx]
+			conn.currentWeight += conn.weight()
+			total += conn.weight()
+
+			if conn.currentWeight > r.Connections[best].currentWeight {
+				best = idx
+			}
+		}
+
+		r.Connections[best].currentWeight -= total
+	case StrategyLatency:
+		// Connections without samples have zero latency, so they are tried first.
+		for _, idx := range candidates[1:] {
+			if r.Connections[idx].P50Latency() < r.Connections[best].P50Latency() {
+				best = idx
+			}
+		}
+	case StrategyLeastOutstanding:
+		for _, idx := range candidates[1:] {
+			if r.Connections[idx].Outstanding() < r.Connections[best].Outstanding() {
+				best = idx
+			}
+		}
+	}
+
+	return best
+}
+
+func (c *Connection) weight() int {
+	return c.ConnectionInfo.EffectivePriority()
+}
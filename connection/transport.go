@@ -0,0 +1,167 @@
+package connection
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+
+	"github.com/gagliardetto/solana-go/rpc/ws"
+	"github.com/gorilla/websocket"
+	"github.com/klauspost/compress/gzhttp"
+	"github.com/patrulek/rayscan/config"
+	"github.com/patrulek/rayscan/geyser"
+)
+
+// newHTTPClient creates client with proxy, TLS and timeout settings of given node.
+func newHTTPClient(node config.RPCNode) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if node.Proxy != "" {
+		proxyURL, err := url.Parse(node.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy: %w", err)
+		}
+
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	tlsConfig, err := nodeTLSConfig(node)
+	if err != nil {
+		return nil, err
+	}
+	transport.TLSClientConfig = tlsConfig
+
+	return &http.Client{Transport: gzhttp.Transport(transport), Timeout: node.Timeout}, nil
+}
+
+// nodeTLSConfig returns TLS settings of given node; nil if there are none.
+func nodeTLSConfig(node config.RPCNode) (*tls.Config, error) {
+	if !node.TLSInsecureSkipVerify && node.TLSCAFile == "" && node.TLSCertFile == "" {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: node.TLSInsecureSkipVerify}
+
+	if node.TLSCAFile != "" {
+		pem, err := os.ReadFile(node.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading CA file: %w", err)
+		}
+
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA file: %s", node.TLSCAFile)
+		}
+
+		tlsConfig.RootCAs = pool
+	}
+
+	if node.TLSCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(node.TLSCertFile, node.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading client certificate: %w", err)
+		}
+
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// nodeHeaders returns custom headers of given node along with authorization header, if auth is configured.
+func nodeHeaders(node config.RPCNode) map[string]string {
+	headers := make(map[string]string, len(node.Headers)+1)
+	for k, v := range node.Headers {
+		headers[k] = v
+	}
+
+	switch {
+	case node.BearerToken != "":
+		headers["Authorization"] = "Bearer " + node.BearerToken
+	case node.Username != "":
+		headers["Authorization"] = "Basic " + base64.StdEncoding.EncodeToString([]byte(node.Username+":"+node.Password))
+	}
+
+	return headers
+}
+
+// newWSDialer creates websocket dialer with proxy, TLS and handshake timeout settings of given node;
+// environment proxy is used if node has none, like for rpc requests.
+func newWSDialer(node config.RPCNode) (*websocket.Dialer, error) {
+	dialer := &websocket.Dialer{
+		Proxy:             http.ProxyFromEnvironment,
+		HandshakeTimeout:  ws.DefaultHandshakeTimeout,
+		EnableCompression: true,
+	}
+
+	if node.Proxy != "" {
+		proxyURL, err := url.Parse(node.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy: %w", err)
+		}
+
+		dialer.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	tlsConfig, err := nodeTLSConfig(node)
+	if err != nil {
+		return nil, err
+	}
+	dialer.TLSClientConfig = tlsConfig
+
+	if node.Timeout > 0 {
+		dialer.HandshakeTimeout = node.Timeout
+	}
+
+	return dialer, nil
+}
+
+// DialWSConn connects to websocket endpoint of connection with its headers, auth, proxy, TLS and timeout settings.
+// Raw connection is returned, as websocket client can't be given a dialer.
+func (c *Connection) DialWSConn(ctx context.Context) (*websocket.Conn, error) {
+	dialer, err := newWSDialer(c.ConnectionInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, _, err := dialer.DialContext(ctx, c.ConnectionInfo.WSEndpoint, c.wsHeader())
+	return conn, err
+}
+
+func (c *Connection) wsHeader() http.Header {
+	header := make(http.Header)
+	for k, v := range nodeHeaders(c.ConnectionInfo) {
+		header.Set(k, v)
+	}
+
+	return header
+}
+
+// DialGeyser creates client of geyser endpoint of connection with its TLS settings, headers, auth and geyser token.
+// Client connects lazily; its streams fail if the endpoint is unreachable.
+func (c *Connection) DialGeyser() (*geyser.Client, error) {
+	if c.ConnectionInfo.Geyser == "" {
+		return nil, fmt.Errorf("no geyser endpoint configured for %s", c.ConnectionInfo.Name)
+	}
+
+	tlsConfig, err := nodeTLSConfig(c.ConnectionInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	headers := nodeHeaders(c.ConnectionInfo)
+	if c.ConnectionInfo.GeyserToken != "" {
+		headers["x-token"] = c.ConnectionInfo.GeyserToken
+	}
+
+	return geyser.Dial(c.ConnectionInfo.Geyser, tlsConfig, headers)
+}
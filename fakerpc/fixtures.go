@@ -0,0 +1,38 @@
+package fakerpc
+
+import (
+	"encoding/json"
+	"os"
+)
+
+// Fixtures holds data served by fake server. Results are raw JSON-RPC results, keyed by base58 signature or address.
+type Fixtures struct {
+	Health        string                     `json:"health"` // "ok" if empty; any other value is returned as node unhealthy error.
+	Slot          uint64                     `json:"slot"`
+	Transactions  map[string]json.RawMessage `json:"transactions"`  // getTransaction
+	Signatures    map[string]json.RawMessage `json:"signatures"`    // getSignaturesForAddress
+	TokenSupplies map[string]json.RawMessage `json:"tokenSupplies"` // getTokenSupply
+	Accounts      map[string]json.RawMessage `json:"accounts"`      // getAccountInfo
+	Logs          []LogFixture               `json:"logs"`          // logsSubscribe notifications
+}
+
+// LogFixture is a log notification sent to logsSubscribe subscribers of given program.
+type LogFixture struct {
+	Mentions string          `json:"mentions"` // Program address the subscription has to mention.
+	AfterMs  int64           `json:"afterMs"`  // Delay after subscription, in milliseconds.
+	Result   json.RawMessage `json:"result"`   // ws.LogResult
+}
+
+func LoadFixtures(path string) (Fixtures, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Fixtures{}, err
+	}
+
+	var fixtures Fixtures
+	if err := json.Unmarshal(data, &fixtures); err != nil {
+		return Fixtures{}, err
+	}
+
+	return fixtures, nil
+}
@@ -0,0 +1,211 @@
+package fakerpc
+
+import (
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/patrulek/rayscan/geyser"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Size of update buffer of every stream; updates published to slow streams are dropped.
+const geyserStreamBuffer = 1024
+
+type geyserStream struct {
+	mu      sync.Mutex
+	filters map[string]geyser.TransactionFilter
+
+	updateC chan *geyser.Update
+	dropC   chan struct{}
+}
+
+func (s *geyserStream) send(update *geyser.Update) {
+	select {
+	case s.updateC <- update:
+	default:
+	}
+}
+
+// GeyserServer is a fake Yellowstone geyser gRPC server; it serves Subscribe streams with published transactions.
+type GeyserServer struct {
+	server   *grpc.Server
+	listener net.Listener
+	token    string
+
+	mu       sync.Mutex
+	streams  map[*geyserStream]struct{}
+	requests []geyser.SubscribeRequest
+}
+
+// NewGeyserServer starts fake geyser server on local address; streams have to send given x-token, unless it's empty.
+func NewGeyserServer(token string) (*GeyserServer, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &GeyserServer{
+		server:   grpc.NewServer(grpc.ForceServerCodec(geyser.Codec{})),
+		listener: listener,
+		token:    token,
+		streams:  make(map[*geyserStream]struct{}),
+	}
+
+	s.server.RegisterService(&grpc.ServiceDesc{
+		ServiceName: "geyser.Geyser",
+		HandlerType: (*any)(nil),
+		Streams: []grpc.StreamDesc{{
+			StreamName:    "Subscribe",
+			Handler:       func(_ any, stream grpc.ServerStream) error { return s.subscribe(stream) },
+			ServerStreams: true,
+			ClientStreams: true,
+		}},
+	}, nil)
+
+	go s.server.Serve(listener)
+	return s, nil
+}
+
+// Endpoint returns plaintext endpoint of server, as expected by geyser.Dial.
+func (s *GeyserServer) Endpoint() string {
+	return "http://" + s.listener.Addr().String()
+}
+
+// PublishTransaction sends transaction to all streams with matching filters.
+func (s *GeyserServer) PublishTransaction(tx *geyser.TransactionUpdate) {
+	for _, stream := range s.activeStreams() {
+		stream.mu.Lock()
+		var filters []string
+		for name, filter := range stream.filters {
+			if filter.Matches(tx) {
+				filters = append(filters, name)
+			}
+		}
+		stream.mu.Unlock()
+
+		if len(filters) > 0 {
+			stream.send(&geyser.Update{Filters: filters, Transaction: tx, CreatedAt: time.Now()})
+		}
+	}
+}
+
+// Ping sends ping update to all streams, as real servers do periodically.
+func (s *GeyserServer) Ping() {
+	for _, stream := range s.activeStreams() {
+		stream.send(&geyser.Update{Ping: true, CreatedAt: time.Now()})
+	}
+}
+
+// Streams returns number of open streams.
+func (s *GeyserServer) Streams() int {
+	return len(s.activeStreams())
+}
+
+// Requests returns subscribe requests received on all streams.
+func (s *GeyserServer) Requests() []geyser.SubscribeRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]geyser.SubscribeRequest(nil), s.requests...)
+}
+
+// DropStreams ends all streams with Unavailable error.
+func (s *GeyserServer) DropStreams() {
+	s.mu.Lock()
+	streams := s.streams
+	s.streams = make(map[*geyserStream]struct{})
+	s.mu.Unlock()
+
+	for stream := range streams {
+		close(stream.dropC)
+	}
+}
+
+func (s *GeyserServer) Close() {
+	s.DropStreams()
+	s.server.Stop()
+}
+
+func (s *GeyserServer) activeStreams() []*geyserStream {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	streams := make([]*geyserStream, 0, len(s.streams))
+	for stream := range s.streams {
+		streams = append(streams, stream)
+	}
+
+	return streams
+}
+
+func (s *GeyserServer) subscribe(stream grpc.ServerStream) error {
+	if s.token != "" {
+		md, _ := metadata.FromIncomingContext(stream.Context())
+		if tokens := md.Get("x-token"); len(tokens) == 0 || tokens[0] != s.token {
+			return status.Error(codes.Unauthenticated, "invalid x-token")
+		}
+	}
+
+	gs := &geyserStream{
+		updateC: make(chan *geyser.Update, geyserStreamBuffer),
+		dropC:   make(chan struct{}),
+	}
+
+	s.mu.Lock()
+	s.streams[gs] = struct{}{}
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.streams, gs)
+		s.mu.Unlock()
+	}()
+
+	errC := make(chan error, 1)
+	go func() {
+		for {
+			req := &geyser.SubscribeRequest{}
+			if err := stream.RecvMsg(req); err != nil {
+				errC <- err
+				return
+			}
+
+			// Request with ping only keeps filters intact.
+			if req.Ping == nil || len(req.Transactions) > 0 {
+				gs.mu.Lock()
+				gs.filters = req.Transactions
+				gs.mu.Unlock()
+			}
+
+			// Recorded once applied, so transactions published after it shows up in Requests match new filters.
+			s.mu.Lock()
+			s.requests = append(s.requests, *req)
+			s.mu.Unlock()
+
+			if req.Ping != nil {
+				gs.send(&geyser.Update{Pong: req.Ping, CreatedAt: time.Now()})
+			}
+		}
+	}()
+
+	for {
+		select {
+		case update := <-gs.updateC:
+			if err := stream.SendMsg(update); err != nil {
+				return err
+			}
+		case err := <-errC:
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		case <-gs.dropC:
+			return status.Error(codes.Unavailable, "stream dropped")
+		}
+	}
+}
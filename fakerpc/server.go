@@ -0,0 +1,565 @@
+package fakerpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gagliardetto/solana-go/rpc/jsonrpc"
+	"github.com/gorilla/websocket"
+)
+
+// Fault is an error injected into responses of given method.
+type Fault struct {
+	HTTPStatus int               // Respond with given HTTP status (eg. 429) instead of JSON-RPC response.
+	RetryAfter time.Duration     // Value of Retry-After header sent with HTTPStatus.
+	RPCError   *jsonrpc.RPCError // Respond with given JSON-RPC error instead of result.
+	DropSocket bool              // Close websocket connection instead of responding (subscriptions only).
+	Times      int               // Number of calls fault applies to; zero means every call.
+}
+
+// Call is a request received by fake server.
+type Call struct {
+	Method string
+	Params json.RawMessage
+	Time   time.Time
+}
+
+type request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+}
+
+type response struct {
+	JSONRPC string            `json:"jsonrpc"`
+	ID      json.RawMessage   `json:"id"`
+	Result  interface{}       `json:"result,omitempty"`
+	Error   *jsonrpc.RPCError `json:"error,omitempty"`
+}
+
+type subscription struct {
+	id       uint64
+	method   string // logsSubscribe, blockSubscribe or transactionSubscribe.
+	mentions string
+	conn     *wsConn
+}
+
+type wsConn struct {
+	mu   sync.Mutex
+	conn *websocket.Conn
+}
+
+func (c *wsConn) write(v interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.conn.WriteJSON(v)
+}
+
+// Server is a fake Solana JSON-RPC and websocket server that serves responses from fixtures.
+// It supports getHealth, getSlot, getTransaction, getSignaturesForAddress, getTokenSupply, getAccountInfo,
+// logsSubscribe, blockSubscribe and transactionSubscribe.
+type Server struct {
+	server   *httptest.Server
+	upgrader websocket.Upgrader
+
+	mu            sync.Mutex
+	fixtures      Fixtures
+	latency       map[string]time.Duration // Method -> latency; empty method is default latency.
+	faults        map[string]*Fault
+	calls         []Call
+	conns         map[*wsConn]struct{}
+	subscriptions map[uint64]*subscription
+	nextSubID     uint64
+}
+
+// NewServer starts fake server on local address.
+func NewServer(fixtures Fixtures) *Server {
+	s := &Server{
+		fixtures:      fixtures,
+		latency:       make(map[string]time.Duration),
+		faults:        make(map[string]*Fault),
+		conns:         make(map[*wsConn]struct{}),
+		subscriptions: make(map[uint64]*subscription),
+		nextSubID:     1,
+	}
+
+	s.server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// RPCURL returns address of JSON-RPC endpoint.
+func (s *Server) RPCURL() string {
+	return s.server.URL
+}
+
+// WSURL returns address of websocket endpoint.
+func (s *Server) WSURL() string {
+	return "ws" + strings.TrimPrefix(s.server.URL, "http")
+}
+
+// SetLatency delays responses of given method; empty method sets default latency for all methods.
+func (s *Server) SetLatency(method string, latency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.latency[method] = latency
+}
+
+// InjectFault makes responses of given method fail; it replaces previously injected fault.
+func (s *Server) InjectFault(method string, fault Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.faults[method] = &fault
+}
+
+// ClearFaults removes all injected faults.
+func (s *Server) ClearFaults() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.faults = make(map[string]*Fault)
+}
+
+// Calls returns received requests of given method; empty method returns all requests.
+func (s *Server) Calls(method string) []Call {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var calls []Call
+	for _, c := range s.calls {
+		if method == "" || c.Method == method {
+			calls = append(calls, c)
+		}
+	}
+
+	return calls
+}
+
+// AssertCalled returns error if given method wasn't called exactly given number of times.
+func (s *Server) AssertCalled(method string, times int) error {
+	if calls := len(s.Calls(method)); calls != times {
+		return fmt.Errorf("%s called %d times, expected %d", method, calls, times)
+	}
+
+	return nil
+}
+
+// PublishLog sends log notification (ws.LogResult) to all logsSubscribe subscribers mentioning given program.
+func (s *Server) PublishLog(mentions string, result interface{}) {
+	s.publish("logsSubscribe", mentions, result)
+}
+
+// PublishBlock sends block notification ({"context": ..., "value": {"slot", "err", "block"}}) to all blockSubscribe subscribers
+// mentioning given program.
+func (s *Server) PublishBlock(mentions string, result interface{}) {
+	s.publish("blockSubscribe", mentions, result)
+}
+
+// PublishTransaction sends transaction notification ({"signature", "slot", "transaction"}) to all transactionSubscribe subscribers
+// mentioning given program.
+func (s *Server) PublishTransaction(mentions string, result interface{}) {
+	s.publish("transactionSubscribe", mentions, result)
+}
+
+func (s *Server) publish(method, mentions string, result interface{}) {
+	s.mu.Lock()
+	var subs []*subscription
+	for _, sub := range s.subscriptions {
+		if sub.method == method && sub.mentions == mentions {
+			subs = append(subs, sub)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, sub := range subs {
+		s.notify(sub, result)
+	}
+}
+
+// AddSignature adds signature (rpc.TransactionSignature) to getSignaturesForAddress results of given address,
+// as the newest one.
+func (s *Server) AddSignature(address string, signature interface{}) {
+	data, err := json.Marshal(signature)
+	if err != nil {
+		panic(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var sigs []json.RawMessage
+	json.Unmarshal(s.fixtures.Signatures[address], &sigs)
+	if s.fixtures.Signatures == nil {
+		s.fixtures.Signatures = make(map[string]json.RawMessage)
+	}
+	s.fixtures.Signatures[address], _ = json.Marshal(append([]json.RawMessage{data}, sigs...))
+}
+
+// SetTransaction sets getTransaction result of given signature.
+func (s *Server) SetTransaction(signature string, tx interface{}) {
+	data, err := json.Marshal(tx)
+	if err != nil {
+		panic(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.fixtures.Transactions == nil {
+		s.fixtures.Transactions = make(map[string]json.RawMessage)
+	}
+	s.fixtures.Transactions[signature] = data
+}
+
+// DropSockets closes all websocket connections.
+func (s *Server) DropSockets() {
+	s.mu.Lock()
+	conns := s.conns
+	s.conns = make(map[*wsConn]struct{})
+	s.subscriptions = make(map[uint64]*subscription)
+	s.mu.Unlock()
+
+	for c := range conns {
+		c.conn.Close()
+	}
+}
+
+func (s *Server) Close() {
+	s.DropSockets()
+	s.server.Close()
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	if websocket.IsWebSocketUpgrade(r) {
+		s.handleWebsocket(w, r)
+		return
+	}
+
+	var req request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	fault := s.begin(req)
+	if fault != nil && fault.HTTPStatus != 0 {
+		if fault.RetryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(fault.RetryAfter.Seconds())))
+		}
+
+		http.Error(w, http.StatusText(fault.HTTPStatus), fault.HTTPStatus)
+		return
+	}
+
+	resp := response{JSONRPC: "2.0", ID: req.ID}
+	if fault != nil && fault.RPCError != nil {
+		resp.Error = fault.RPCError
+	} else {
+		resp.Result, resp.Error = s.result(req)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// begin records call, waits configured latency and returns fault to apply, if any.
+func (s *Server) begin(req request) *Fault {
+	s.mu.Lock()
+	s.calls = append(s.calls, Call{Method: req.Method, Params: req.Params, Time: time.Now()})
+
+	latency, ok := s.latency[req.Method]
+	if !ok {
+		latency = s.latency[""]
+	}
+
+	var fault *Fault
+	if f, ok := s.faults[req.Method]; ok {
+		fault = f
+		if f.Times > 0 {
+			f.Times--
+			if f.Times == 0 {
+				delete(s.faults, req.Method)
+			}
+		}
+	}
+	s.mu.Unlock()
+
+	time.Sleep(latency)
+	return fault
+}
+
+func (s *Server) result(req request) (interface{}, *jsonrpc.RPCError) {
+	var params []json.RawMessage
+	json.Unmarshal(req.Params, &params)
+
+	// First param is a signature or an address for all supported methods, except getHealth and getSlot.
+	var key string
+	if len(params) > 0 {
+		json.Unmarshal(params[0], &key)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch req.Method {
+	case "getHealth":
+		if s.fixtures.Health != "" && s.fixtures.Health != "ok" {
+			return nil, &jsonrpc.RPCError{Code: -32005, Message: s.fixtures.Health}
+		}
+		return "ok", nil
+	case "getSlot":
+		return s.fixtures.Slot, nil
+	case "getTransaction":
+		if tx, ok := s.fixtures.Transactions[key]; ok {
+			return tx, nil
+		}
+		return json.RawMessage("null"), nil
+	case "getSignaturesForAddress":
+		var opts signaturesOpts
+		if len(params) > 1 {
+			json.Unmarshal(params[1], &opts)
+		}
+
+		if sigs, ok := s.fixtures.Signatures[key]; ok {
+			return opts.page(sigs), nil
+		}
+		return []interface{}{}, nil
+	case "getTokenSupply":
+		if supply, ok := s.fixtures.TokenSupplies[key]; ok {
+			return supply, nil
+		}
+		return nil, &jsonrpc.RPCError{Code: -32602, Message: "Invalid param: not a Token mint"}
+	case "getAccountInfo":
+		value := json.RawMessage("null")
+		if account, ok := s.fixtures.Accounts[key]; ok {
+			value = account
+		}
+		return map[string]interface{}{"context": map[string]interface{}{"slot": s.fixtures.Slot}, "value": value}, nil
+	default:
+		return nil, &jsonrpc.RPCError{Code: -32601, Message: "Method not found"}
+	}
+}
+
+func (s *Server) handleWebsocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+
+	c := &wsConn{conn: conn}
+
+	s.mu.Lock()
+	s.conns[c] = struct{}{}
+	s.mu.Unlock()
+
+	defer s.closeConn(c)
+
+	for {
+		var req request
+		if err := conn.ReadJSON(&req); err != nil {
+			return
+		}
+
+		fault := s.begin(req)
+		if fault != nil && fault.DropSocket {
+			return
+		}
+
+		resp := response{JSONRPC: "2.0", ID: req.ID}
+		var sub *subscription
+
+		switch {
+		case fault != nil && fault.RPCError != nil:
+			resp.Error = fault.RPCError
+		case req.Method == "logsSubscribe" || req.Method == "blockSubscribe" || req.Method == "transactionSubscribe":
+			sub = s.subscribe(c, req)
+			resp.Result = sub.id
+		case strings.HasSuffix(req.Method, "Unsubscribe"):
+			resp.Result = s.unsubscribe(req)
+		default:
+			resp.Error = &jsonrpc.RPCError{Code: -32601, Message: "Method not found"}
+		}
+
+		if err := c.write(resp); err != nil {
+			return
+		}
+
+		// Notifications can be sent only after client knows subscription id.
+		if sub != nil && s.activate(sub) {
+			s.scheduleLogs(sub)
+		}
+	}
+}
+
+func (s *Server) subscribe(c *wsConn, req request) *subscription {
+	var params []struct {
+		Mentions                 []string `json:"mentions"`                 // logsSubscribe
+		MentionsAccountOrProgram string   `json:"mentionsAccountOrProgram"` // blockSubscribe
+		AccountInclude           []string `json:"accountInclude"`           // transactionSubscribe
+	}
+	json.Unmarshal(req.Params, &params)
+
+	var mentions string
+	if len(params) > 0 {
+		switch {
+		case len(params[0].Mentions) > 0:
+			mentions = params[0].Mentions[0]
+		case params[0].MentionsAccountOrProgram != "":
+			mentions = params[0].MentionsAccountOrProgram
+		case len(params[0].AccountInclude) > 0:
+			mentions = params[0].AccountInclude[0]
+		}
+	}
+
+	s.mu.Lock()
+	sub := &subscription{id: s.nextSubID, method: req.Method, mentions: mentions, conn: c}
+	s.nextSubID++
+	s.mu.Unlock()
+
+	return sub
+}
+
+// activate makes subscription receive notifications; false is returned if its connection is already closed.
+func (s *Server) activate(sub *subscription) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.conns[sub.conn]; !ok {
+		return false
+	}
+
+	s.subscriptions[sub.id] = sub
+	return true
+}
+
+// Subscriptions returns number of active subscriptions of given method (eg. logsSubscribe); empty method counts all of them.
+func (s *Server) Subscriptions(method string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	count := 0
+	for _, sub := range s.subscriptions {
+		if method == "" || sub.method == method {
+			count++
+		}
+	}
+
+	return count
+}
+
+// scheduleLogs sends fixture logs mentioning subscribed program with their configured delays.
+func (s *Server) scheduleLogs(sub *subscription) {
+	s.mu.Lock()
+	logs := s.fixtures.Logs
+	s.mu.Unlock()
+
+	for _, l := range logs {
+		if sub.method != "logsSubscribe" || l.Mentions != sub.mentions {
+			continue
+		}
+
+		l := l
+		time.AfterFunc(time.Duration(l.AfterMs)*time.Millisecond, func() {
+			s.notify(sub, l.Result)
+		})
+	}
+}
+
+func (s *Server) unsubscribe(req request) bool {
+	var params []uint64
+	json.Unmarshal(req.Params, &params)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(params) == 0 {
+		return false
+	}
+
+	_, ok := s.subscriptions[params[0]]
+	delete(s.subscriptions, params[0])
+	return ok
+}
+
+func (s *Server) notify(sub *subscription, result interface{}) {
+	s.mu.Lock()
+	_, ok := s.subscriptions[sub.id]
+	s.mu.Unlock()
+
+	if !ok {
+		return // Unsubscribed or dropped.
+	}
+
+	sub.conn.write(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  strings.TrimSuffix(sub.method, "Subscribe") + "Notification",
+		"params": map[string]interface{}{
+			"subscription": sub.id,
+			"result":       result,
+		},
+	})
+}
+
+func (s *Server) closeConn(c *wsConn) {
+	s.mu.Lock()
+	delete(s.conns, c)
+	for id, sub := range s.subscriptions {
+		if sub.conn == c {
+			delete(s.subscriptions, id)
+		}
+	}
+	s.mu.Unlock()
+
+	c.conn.Close()
+}
+
+// signaturesOpts are options of getSignaturesForAddress request.
+type signaturesOpts struct {
+	Limit  int    `json:"limit"`
+	Before string `json:"before"`
+	Until  string `json:"until"`
+}
+
+// page returns signatures (newest first) older than before and newer than until, up to limit (1000 by default).
+func (o signaturesOpts) page(sigs json.RawMessage) interface{} {
+	var all []json.RawMessage
+	if err := json.Unmarshal(sigs, &all); err != nil {
+		return sigs // Not a list; returned as it is.
+	}
+
+	limit := o.Limit
+	if limit <= 0 {
+		limit = 1000
+	}
+
+	page := make([]json.RawMessage, 0)
+	started := o.Before == ""
+	for _, sig := range all {
+		var entry struct {
+			Signature string `json:"signature"`
+		}
+		json.Unmarshal(sig, &entry)
+
+		if !started {
+			started = entry.Signature == o.Before
+			continue
+		}
+
+		if entry.Signature == o.Until || len(page) == limit {
+			break
+		}
+
+		page = append(page, sig)
+	}
+
+	return page
+}
@@ -0,0 +1,142 @@
+package geyser
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/metadata"
+)
+
+// Full name of Subscribe method.
+const SubscribeMethod = "/geyser.Geyser/Subscribe"
+
+// Updates with full transactions can be large; default limit of 4 MiB isn't enough for some blocks.
+const maxMessageSize = 64 * 1024 * 1024
+
+// message is implemented by messages that can be sent with Codec.
+type message interface {
+	Marshal() []byte
+	Unmarshal(b []byte) error
+}
+
+// Codec encodes messages of this package; it's registered under "proto" name only for calls that force it.
+type Codec struct{}
+
+var _ encoding.Codec = Codec{}
+
+func (Codec) Marshal(v any) ([]byte, error) {
+	m, ok := v.(message)
+	if !ok {
+		return nil, fmt.Errorf("unsupported message type %T", v)
+	}
+
+	return m.Marshal(), nil
+}
+
+func (Codec) Unmarshal(data []byte, v any) error {
+	m, ok := v.(message)
+	if !ok {
+		return fmt.Errorf("unsupported message type %T", v)
+	}
+
+	return m.Unmarshal(data)
+}
+
+func (Codec) Name() string {
+	return "proto"
+}
+
+// Client is a connection to Yellowstone geyser gRPC endpoint.
+type Client struct {
+	conn    *grpc.ClientConn
+	headers metadata.MD
+}
+
+// Dial creates client of given endpoint (eg. https://host:443); connection is established lazily, by first call.
+// Endpoints with https scheme use TLS with given config (system roots if nil); http ones are plaintext.
+// Headers are sent as metadata of every call (eg. x-token).
+func Dial(endpoint string, tlsConfig *tls.Config, headers map[string]string) (*Client, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid endpoint: %w", err)
+	}
+
+	var creds credentials.TransportCredentials
+	switch u.Scheme {
+	case "https":
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{}
+		}
+		creds = credentials.NewTLS(tlsConfig)
+	case "http":
+		creds = insecure.NewCredentials()
+	default:
+		return nil, fmt.Errorf("invalid endpoint scheme %q; expected http or https", u.Scheme)
+	}
+
+	target := u.Host
+	if u.Port() == "" {
+		target += map[string]string{"https": ":443", "http": ":80"}[u.Scheme]
+	}
+
+	conn, err := grpc.NewClient(target,
+		grpc.WithTransportCredentials(creds),
+		grpc.WithKeepaliveParams(keepalive.ClientParameters{Time: 10 * time.Second, Timeout: 5 * time.Second, PermitWithoutStream: true}),
+		grpc.WithDefaultCallOptions(grpc.ForceCodec(Codec{}), grpc.MaxCallRecvMsgSize(maxMessageSize)),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	md := make(metadata.MD, len(headers))
+	for k, v := range headers {
+		md.Set(strings.ToLower(k), v)
+	}
+
+	return &Client{conn: conn, headers: md}, nil
+}
+
+// Subscribe opens Subscribe stream; it's closed when ctx is done. Filters are set by sending request on the stream.
+func (c *Client) Subscribe(ctx context.Context) (*Stream, error) {
+	ctx = metadata.NewOutgoingContext(ctx, c.headers.Copy())
+
+	stream, err := c.conn.NewStream(ctx, &grpc.StreamDesc{StreamName: "Subscribe", ServerStreams: true, ClientStreams: true}, SubscribeMethod)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Stream{stream: stream}, nil
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Stream is an open Subscribe stream. Send and Recv can be called concurrently with each other, but not with themselves.
+type Stream struct {
+	stream grpc.ClientStream
+}
+
+// Send sets filters of the stream or pings the server.
+func (s *Stream) Send(req *SubscribeRequest) error {
+	return s.stream.SendMsg(req)
+}
+
+// Recv waits for next update; returns io.EOF if server ended the stream.
+func (s *Stream) Recv() (*Update, error) {
+	update := &Update{}
+	if err := s.stream.RecvMsg(update); err != nil {
+		return nil, err
+	}
+
+	return update, nil
+}
@@ -0,0 +1,202 @@
+package geyser_test
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/patrulek/rayscan/fakerpc"
+	"github.com/patrulek/rayscan/geyser"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func testKey(seed byte) solana.PublicKey {
+	var key solana.PublicKey
+	for i := range key {
+		key[i] = seed
+	}
+
+	return key
+}
+
+// testTx returns successful transaction mentioning given accounts.
+func testTx(seed byte, accounts ...solana.PublicKey) *geyser.TransactionUpdate {
+	var sig solana.Signature
+	for i := range sig {
+		sig[i] = seed
+	}
+
+	tx := &solana.Transaction{Signatures: []solana.Signature{sig}}
+	tx.Message.Header.NumRequiredSignatures = 1
+	tx.Message.AccountKeys = append([]solana.PublicKey{testKey(seed)}, accounts...)
+
+	return &geyser.TransactionUpdate{
+		Slot:        100,
+		Signature:   sig,
+		Transaction: tx,
+		Meta:        &rpc.TransactionMeta{LogMessages: []string{"Program log: test"}},
+	}
+}
+
+func newServer(t *testing.T, token string) *fakerpc.GeyserServer {
+	t.Helper()
+
+	s, err := fakerpc.NewGeyserServer(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+// subscribe opens stream with given filters and waits until server applies them.
+func subscribe(t *testing.T, s *fakerpc.GeyserServer, token string, filters map[string]geyser.TransactionFilter) *geyser.Stream {
+	t.Helper()
+
+	client, err := geyser.Dial(s.Endpoint(), nil, map[string]string{"X-Token": token})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	stream, err := client.Subscribe(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	commitment := geyser.CommitmentProcessed
+	requests := len(s.Requests())
+	if err := stream.Send(&geyser.SubscribeRequest{Transactions: filters, Commitment: &commitment}); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(s.Requests()) == requests {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for subscribe request")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	return stream
+}
+
+// recv returns next update of stream, failing the test if none arrives in time.
+func recv(t *testing.T, stream *geyser.Stream) *geyser.Update {
+	t.Helper()
+
+	type result struct {
+		update *geyser.Update
+		err    error
+	}
+
+	resultC := make(chan result, 1)
+	go func() {
+		update, err := stream.Recv()
+		resultC <- result{update, err}
+	}()
+
+	select {
+	case res := <-resultC:
+		if res.err != nil {
+			t.Fatal(res.err)
+		}
+		return res.update
+	case <-time.After(2 * time.Second):
+		t.Fatalf("timed out waiting for update")
+		return nil
+	}
+}
+
+func TestSubscribeFilters(t *testing.T) {
+	s := newServer(t, "")
+
+	vote, failed := false, false
+	stream := subscribe(t, s, "", map[string]geyser.TransactionFilter{
+		"a": {Vote: &vote, Failed: &failed, AccountInclude: []string{testKey(101).String()}},
+		"b": {Vote: &vote, Failed: &failed, AccountInclude: []string{testKey(102).String()}},
+	})
+
+	req := s.Requests()[0]
+	if len(req.Transactions) != 2 || req.Transactions["a"].AccountInclude[0] != testKey(101).String() || *req.Commitment != geyser.CommitmentProcessed {
+		t.Fatalf("unexpected request: %+v", req)
+	}
+
+	voteTx := testTx(1, testKey(101))
+	voteTx.IsVote = true
+	failedTx := testTx(2, testKey(101))
+	failedTx.Meta.Err = geyser.TransactionError{1}
+
+	s.PublishTransaction(voteTx)
+	s.PublishTransaction(failedTx)
+	s.PublishTransaction(testTx(3, testKey(103)))
+	s.PublishTransaction(testTx(4, testKey(101), testKey(102)))
+
+	update := recv(t, stream)
+	sort.Strings(update.Filters)
+	if update.Transaction == nil || update.Transaction.Signature != testTx(4).Signature || len(update.Filters) != 2 || update.Filters[0] != "a" || update.Filters[1] != "b" {
+		t.Fatalf("unexpected update: %+v", update)
+	}
+
+	got := update.Transaction
+	if got.Slot != 100 || got.Transaction.Signatures[0] != got.Signature || len(got.Transaction.Message.AccountKeys) != 3 || got.Meta.LogMessages[0] != "Program log: test" {
+		t.Fatalf("unexpected transaction: %+v", got)
+	}
+}
+
+func TestSubscribePing(t *testing.T) {
+	s := newServer(t, "")
+	stream := subscribe(t, s, "", nil)
+
+	s.Ping()
+	if update := recv(t, stream); !update.Ping {
+		t.Fatalf("expected ping, got %+v", update)
+	}
+
+	id := int32(7)
+	if err := stream.Send(&geyser.SubscribeRequest{Ping: &id}); err != nil {
+		t.Fatal(err)
+	}
+
+	if update := recv(t, stream); update.Pong == nil || *update.Pong != id {
+		t.Fatalf("expected pong, got %+v", update)
+	}
+}
+
+func TestSubscribeToken(t *testing.T) {
+	s := newServer(t, "secret")
+	subscribe(t, s, "secret", nil)
+
+	client, err := geyser.Dial(s.Endpoint(), nil, map[string]string{"x-token": "wrong"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	stream, err := client.Subscribe(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := stream.Recv(); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("expected unauthenticated error, got %v", err)
+	}
+}
+
+func TestStreamDropped(t *testing.T) {
+	s := newServer(t, "")
+	stream := subscribe(t, s, "", nil)
+
+	s.DropStreams()
+	if _, err := stream.Recv(); status.Code(err) != codes.Unavailable {
+		t.Fatalf("expected unavailable error, got %v", err)
+	}
+}
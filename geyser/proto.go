@@ -0,0 +1,883 @@
+package geyser
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Messages below are the subset of Yellowstone geyser.proto and solana-storage.proto used by rayscan;
+// fields not listed here are skipped when decoding.
+
+// CommitmentLevel of Subscribe stream.
+type CommitmentLevel int32
+
+const (
+	CommitmentProcessed CommitmentLevel = 0
+	CommitmentConfirmed CommitmentLevel = 1
+	CommitmentFinalized CommitmentLevel = 2
+)
+
+// ParseCommitment converts RPC commitment name to CommitmentLevel.
+func ParseCommitment(commitment string) (CommitmentLevel, error) {
+	switch commitment {
+	case "processed":
+		return CommitmentProcessed, nil
+	case "confirmed":
+		return CommitmentConfirmed, nil
+	case "finalized":
+		return CommitmentFinalized, nil
+	default:
+		return 0, fmt.Errorf("unknown commitment %q", commitment)
+	}
+}
+
+// TransactionFilter selects transactions sent by Subscribe stream (SubscribeRequestFilterTransactions).
+type TransactionFilter struct {
+	Vote            *bool
+	Failed          *bool
+	AccountInclude  []string // Transaction has to mention any of these accounts.
+	AccountExclude  []string
+	AccountRequired []string // Transaction has to mention all of these accounts.
+}
+
+// SubscribeRequest sets filters of Subscribe stream; every request replaces previous filters.
+type SubscribeRequest struct {
+	Transactions map[string]TransactionFilter // Filter name -> filter; names are reported in updates.
+	Commitment   *CommitmentLevel
+	Ping         *int32 // Asks server for pong with given id; filters are left intact.
+}
+
+// Update is a single message of Subscribe stream (SubscribeUpdate); only one of Transaction, Ping and Pong is set.
+type Update struct {
+	Filters     []string // Names of filters matching the update.
+	Transaction *TransactionUpdate
+	Ping        bool
+	Pong        *int32
+	CreatedAt   time.Time
+}
+
+// TransactionUpdate is a transaction with its status meta, as sent by Subscribe stream.
+type TransactionUpdate struct {
+	Slot        uint64
+	Signature   solana.Signature
+	IsVote      bool
+	Index       uint64
+	Transaction *solana.Transaction
+	Meta        *rpc.TransactionMeta // Token balances and inner instructions are included; rewards aren't.
+}
+
+// TransactionError is raw (bincode encoded) error of failed transaction; set as rpc.TransactionMeta.Err.
+type TransactionError []byte
+
+func (e TransactionError) String() string {
+	return fmt.Sprintf("transaction error %x", []byte(e))
+}
+
+// Field numbers.
+const (
+	requestTransactions = 3
+	requestCommitment   = 6
+	requestPing         = 9
+
+	filterVote            = 1
+	filterFailed          = 2
+	filterAccountInclude  = 3
+	filterAccountExclude  = 4
+	filterAccountRequired = 6
+
+	updateFilters     = 1
+	updateTransaction = 4
+	updatePing        = 6
+	updatePong        = 9
+	updateCreatedAt   = 11
+
+	txUpdateInfo = 1
+	txUpdateSlot = 2
+
+	txInfoSignature   = 1
+	txInfoIsVote      = 2
+	txInfoTransaction = 3
+	txInfoMeta        = 4
+	txInfoIndex       = 5
+
+	txSignatures = 1
+	txMessage    = 2
+
+	msgHeader          = 1
+	msgAccountKeys     = 2
+	msgRecentBlockhash = 3
+	msgInstructions    = 4
+	msgVersioned       = 5
+	msgLookups         = 6
+
+	metaErr                = 1
+	metaFee                = 2
+	metaPreBalances        = 3
+	metaPostBalances       = 4
+	metaInnerInstructions  = 5
+	metaLogMessages        = 6
+	metaPreTokenBalances   = 7
+	metaPostTokenBalances  = 8
+	metaLoadedWritable     = 12
+	metaLoadedReadonly     = 13
+	tokenBalanceIndex      = 1
+	tokenBalanceMint       = 2
+	tokenBalanceAmount     = 3
+	tokenBalanceOwner      = 4
+	uiAmountValue          = 1
+	uiAmountDecimals       = 2
+	uiAmountAmount         = 3
+	uiAmountString         = 4
+	innerInstructionsIndex = 1
+	innerInstructionsList  = 2
+)
+
+// Marshal encodes request in protobuf wire format.
+func (r *SubscribeRequest) Marshal() []byte {
+	var b []byte
+
+	names := make([]string, 0, len(r.Transactions))
+	for name := range r.Transactions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		var entry []byte
+		entry = appendString(entry, 1, name)
+		entry = appendMessage(entry, 2, r.Transactions[name].marshal())
+		b = appendMessage(b, requestTransactions, entry)
+	}
+
+	if r.Commitment != nil {
+		b = protowire.AppendTag(b, requestCommitment, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(*r.Commitment))
+	}
+
+	if r.Ping != nil {
+		var ping []byte
+		ping = protowire.AppendTag(ping, 1, protowire.VarintType)
+		ping = protowire.AppendVarint(ping, uint64(int64(*r.Ping)))
+		b = appendMessage(b, requestPing, ping)
+	}
+
+	return b
+}
+
+// Unmarshal decodes request from protobuf wire format.
+func (r *SubscribeRequest) Unmarshal(b []byte) error {
+	*r = SubscribeRequest{}
+
+	return forEachField(b, func(num protowire.Number, typ protowire.Type, v []byte, x uint64) error {
+		switch num {
+		case requestTransactions:
+			var name string
+			var filter TransactionFilter
+			err := forEachField(v, func(num protowire.Number, typ protowire.Type, v []byte, x uint64) error {
+				switch num {
+				case 1:
+					name = string(v)
+				case 2:
+					return filter.unmarshal(v)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+
+			if r.Transactions == nil {
+				r.Transactions = make(map[string]TransactionFilter)
+			}
+			r.Transactions[name] = filter
+		case requestCommitment:
+			commitment := CommitmentLevel(x)
+			r.Commitment = &commitment
+		case requestPing:
+			var id int32
+			err := forEachField(v, func(num protowire.Number, typ protowire.Type, v []byte, x uint64) error {
+				if num == 1 {
+					id = int32(x)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			r.Ping = &id
+		}
+		return nil
+	})
+}
+
+func (f TransactionFilter) marshal() []byte {
+	var b []byte
+	if f.Vote != nil {
+		b = appendBool(b, filterVote, *f.Vote)
+	}
+
+	if f.Failed != nil {
+		b = appendBool(b, filterFailed, *f.Failed)
+	}
+
+	for _, account := range f.AccountInclude {
+		b = appendString(b, filterAccountInclude, account)
+	}
+
+	for _, account := range f.AccountExclude {
+		b = appendString(b, filterAccountExclude, account)
+	}
+
+	for _, account := range f.AccountRequired {
+		b = appendString(b, filterAccountRequired, account)
+	}
+
+	return b
+}
+
+func (f *TransactionFilter) unmarshal(b []byte) error {
+	return forEachField(b, func(num protowire.Number, typ protowire.Type, v []byte, x uint64) error {
+		switch num {
+		case filterVote:
+			vote := x != 0
+			f.Vote = &vote
+		case filterFailed:
+			failed := x != 0
+			f.Failed = &failed
+		case filterAccountInclude:
+			f.AccountInclude = append(f.AccountInclude, string(v))
+		case filterAccountExclude:
+			f.AccountExclude = append(f.AccountExclude, string(v))
+		case filterAccountRequired:
+			f.AccountRequired = append(f.AccountRequired, string(v))
+		}
+		return nil
+	})
+}
+
+// Matches tells if transaction mentioning given accounts passes the filter.
+func (f TransactionFilter) Matches(tx *TransactionUpdate) bool {
+	if f.Vote != nil && *f.Vote != tx.IsVote {
+		return false
+	}
+
+	failed := tx.Meta != nil && tx.Meta.Err != nil
+	if f.Failed != nil && *f.Failed != failed {
+		return false
+	}
+
+	mentioned := make(map[string]bool)
+	if tx.Transaction != nil {
+		for _, key := range tx.Transaction.Message.AccountKeys {
+			mentioned[key.String()] = true
+		}
+	}
+
+	if tx.Meta != nil {
+		for _, key := range append(tx.Meta.LoadedAddresses.Writable, tx.Meta.LoadedAddresses.ReadOnly...) {
+			mentioned[key.String()] = true
+		}
+	}
+
+	for _, account := range f.AccountExclude {
+		if mentioned[account] {
+			return false
+		}
+	}
+
+	for _, account := range f.AccountRequired {
+		if !mentioned[account] {
+			return false
+		}
+	}
+
+	if len(f.AccountInclude) == 0 {
+		return true
+	}
+
+	for _, account := range f.AccountInclude {
+		if mentioned[account] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Marshal encodes update in protobuf wire format.
+func (u *Update) Marshal() []byte {
+	var b []byte
+	for _, filter := range u.Filters {
+		b = appendString(b, updateFilters, filter)
+	}
+
+	switch {
+	case u.Transaction != nil:
+		b = appendMessage(b, updateTransaction, u.Transaction.marshal())
+	case u.Ping:
+		b = appendMessage(b, updatePing, nil)
+	case u.Pong != nil:
+		var pong []byte
+		pong = protowire.AppendTag(pong, 1, protowire.VarintType)
+		pong = protowire.AppendVarint(pong, uint64(int64(*u.Pong)))
+		b = appendMessage(b, updatePong, pong)
+	}
+
+	if !u.CreatedAt.IsZero() {
+		var ts []byte
+		ts = protowire.AppendTag(ts, 1, protowire.VarintType)
+		ts = protowire.AppendVarint(ts, uint64(u.CreatedAt.Unix()))
+		ts = protowire.AppendTag(ts, 2, protowire.VarintType)
+		ts = protowire.AppendVarint(ts, uint64(u.CreatedAt.Nanosecond()))
+		b = appendMessage(b, updateCreatedAt, ts)
+	}
+
+	return b
+}
+
+// Unmarshal decodes update from protobuf wire format.
+func (u *Update) Unmarshal(b []byte) error {
+	*u = Update{}
+
+	return forEachField(b, func(num protowire.Number, typ protowire.Type, v []byte, x uint64) error {
+		switch num {
+		case updateFilters:
+			u.Filters = append(u.Filters, string(v))
+		case updateTransaction:
+			u.Transaction = &TransactionUpdate{}
+			return u.Transaction.unmarshal(v)
+		case updatePing:
+			u.Ping = true
+		case updatePong:
+			var id int32
+			err := forEachField(v, func(num protowire.Number, typ protowire.Type, v []byte, x uint64) error {
+				if num == 1 {
+					id = int32(x)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			u.Pong = &id
+		case updateCreatedAt:
+			var seconds, nanos uint64
+			err := forEachField(v, func(num protowire.Number, typ protowire.Type, v []byte, x uint64) error {
+				switch num {
+				case 1:
+					seconds = x
+				case 2:
+					nanos = x
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			u.CreatedAt = time.Unix(int64(seconds), int64(nanos))
+		}
+		return nil
+	})
+}
+
+func (t *TransactionUpdate) marshal() []byte {
+	var info []byte
+	info = appendBytes(info, txInfoSignature, t.Signature[:])
+	info = appendBool(info, txInfoIsVote, t.IsVote)
+	if t.Transaction != nil {
+		info = appendMessage(info, txInfoTransaction, marshalTransaction(t.Transaction))
+	}
+	if t.Meta != nil {
+		info = appendMessage(info, txInfoMeta, marshalMeta(t.Meta))
+	}
+	info = protowire.AppendTag(info, txInfoIndex, protowire.VarintType)
+	info = protowire.AppendVarint(info, t.Index)
+
+	var b []byte
+	b = appendMessage(b, txUpdateInfo, info)
+	b = protowire.AppendTag(b, txUpdateSlot, protowire.VarintType)
+	b = protowire.AppendVarint(b, t.Slot)
+	return b
+}
+
+func (t *TransactionUpdate) unmarshal(b []byte) error {
+	return forEachField(b, func(num protowire.Number, typ protowire.Type, v []byte, x uint64) error {
+		switch num {
+		case txUpdateSlot:
+			t.Slot = x
+		case txUpdateInfo:
+			return forEachField(v, func(num protowire.Number, typ protowire.Type, v []byte, x uint64) error {
+				switch num {
+				case txInfoSignature:
+					if len(v) != solana.SignatureLength {
+						return fmt.Errorf("invalid signature length %d", len(v))
+					}
+					copy(t.Signature[:], v)
+				case txInfoIsVote:
+					t.IsVote = x != 0
+				case txInfoIndex:
+					t.Index = x
+				case txInfoTransaction:
+					tx, err := unmarshalTransaction(v)
+					if err != nil {
+						return fmt.Errorf("transaction: %w", err)
+					}
+					t.Transaction = tx
+				case txInfoMeta:
+					meta, err := unmarshalMeta(v)
+					if err != nil {
+						return fmt.Errorf("meta: %w", err)
+					}
+					t.Meta = meta
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+}
+
+func marshalTransaction(tx *solana.Transaction) []byte {
+	var b []byte
+	for _, signature := range tx.Signatures {
+		b = appendBytes(b, txSignatures, signature[:])
+	}
+
+	msg := tx.Message
+	var m []byte
+
+	var header []byte
+	for i, n := range []uint8{msg.Header.NumRequiredSignatures, msg.Header.NumReadonlySignedAccounts, msg.Header.NumReadonlyUnsignedAccounts} {
+		header = protowire.AppendTag(header, protowire.Number(i+1), protowire.VarintType)
+		header = protowire.AppendVarint(header, uint64(n))
+	}
+	m = appendMessage(m, msgHeader, header)
+
+	for _, key := range msg.AccountKeys {
+		m = appendBytes(m, msgAccountKeys, key[:])
+	}
+	m = appendBytes(m, msgRecentBlockhash, msg.RecentBlockhash[:])
+
+	for _, inst := range msg.Instructions {
+		m = appendMessage(m, msgInstructions, marshalInstruction(inst))
+	}
+
+	m = appendBool(m, msgVersioned, msg.IsVersioned())
+	for _, lookup := range msg.AddressTableLookups {
+		var l []byte
+		l = appendBytes(l, 1, lookup.AccountKey[:])
+		l = appendBytes(l, 2, lookup.WritableIndexes)
+		l = appendBytes(l, 3, lookup.ReadonlyIndexes)
+		m = appendMessage(m, msgLookups, l)
+	}
+
+	return appendMessage(b, txMessage, m)
+}
+
+func unmarshalTransaction(b []byte) (*solana.Transaction, error) {
+	tx := &solana.Transaction{}
+	versioned := false
+
+	err := forEachField(b, func(num protowire.Number, typ protowire.Type, v []byte, x uint64) error {
+		switch num {
+		case txSignatures:
+			if len(v) != solana.SignatureLength {
+				return fmt.Errorf("invalid signature length %d", len(v))
+			}
+			tx.Signatures = append(tx.Signatures, solana.SignatureFromBytes(v))
+		case txMessage:
+			return forEachField(v, func(num protowire.Number, typ protowire.Type, v []byte, x uint64) error {
+				msg := &tx.Message
+				switch num {
+				case msgHeader:
+					return forEachField(v, func(num protowire.Number, typ protowire.Type, v []byte, x uint64) error {
+						switch num {
+						case 1:
+							msg.Header.NumRequiredSignatures = uint8(x)
+						case 2:
+							msg.Header.NumReadonlySignedAccounts = uint8(x)
+						case 3:
+							msg.Header.NumReadonlyUnsignedAccounts = uint8(x)
+						}
+						return nil
+					})
+				case msgAccountKeys:
+					key, err := publicKey(v)
+					if err != nil {
+						return err
+					}
+					msg.AccountKeys = append(msg.AccountKeys, key)
+				case msgRecentBlockhash:
+					if len(v) != 32 {
+						return fmt.Errorf("invalid blockhash length %d", len(v))
+					}
+					copy(msg.RecentBlockhash[:], v)
+				case msgInstructions:
+					inst, err := unmarshalInstruction(v)
+					if err != nil {
+						return err
+					}
+					msg.Instructions = append(msg.Instructions, inst)
+				case msgVersioned:
+					versioned = x != 0
+				case msgLookups:
+					var lookup solana.MessageAddressTableLookup
+					err := forEachField(v, func(num protowire.Number, typ protowire.Type, v []byte, x uint64) error {
+						var err error
+						switch num {
+						case 1:
+							lookup.AccountKey, err = publicKey(v)
+						case 2:
+							lookup.WritableIndexes = append(solana.Uint8SliceAsNum(nil), v...)
+						case 3:
+							lookup.ReadonlyIndexes = append(solana.Uint8SliceAsNum(nil), v...)
+						}
+						return err
+					})
+					if err != nil {
+						return err
+					}
+					msg.AddressTableLookups = append(msg.AddressTableLookups, lookup)
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if versioned {
+		tx.Message.SetVersion(solana.MessageVersionV0)
+	}
+
+	return tx, nil
+}
+
+func marshalInstruction(inst solana.CompiledInstruction) []byte {
+	accounts := make([]byte, len(inst.Accounts))
+	for i, account := range inst.Accounts {
+		accounts[i] = byte(account)
+	}
+
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.VarintType)
+	b = protowire.AppendVarint(b, uint64(inst.ProgramIDIndex))
+	b = appendBytes(b, 2, accounts)
+	b = appendBytes(b, 3, inst.Data)
+	return b
+}
+
+func unmarshalInstruction(b []byte) (solana.CompiledInstruction, error) {
+	var inst solana.CompiledInstruction
+	err := forEachField(b, func(num protowire.Number, typ protowire.Type, v []byte, x uint64) error {
+		switch num {
+		case 1:
+			inst.ProgramIDIndex = uint16(x)
+		case 2:
+			inst.Accounts = make([]uint16, len(v))
+			for i, account := range v {
+				inst.Accounts[i] = uint16(account)
+			}
+		case 3:
+			inst.Data = append(solana.Base58(nil), v...)
+		}
+		return nil
+	})
+
+	return inst, err
+}
+
+func marshalMeta(meta *rpc.TransactionMeta) []byte {
+	var b []byte
+	if meta.Err != nil {
+		var raw []byte
+		if txErr, ok := meta.Err.(TransactionError); ok {
+			raw = txErr
+		} else {
+			raw = []byte(fmt.Sprint(meta.Err))
+		}
+		b = appendMessage(b, metaErr, appendBytes(nil, 1, raw))
+	}
+
+	b = protowire.AppendTag(b, metaFee, protowire.VarintType)
+	b = protowire.AppendVarint(b, meta.Fee)
+	b = appendPacked(b, metaPreBalances, meta.PreBalances)
+	b = appendPacked(b, metaPostBalances, meta.PostBalances)
+
+	for _, inner := range meta.InnerInstructions {
+		var m []byte
+		m = protowire.AppendTag(m, innerInstructionsIndex, protowire.VarintType)
+		m = protowire.AppendVarint(m, uint64(inner.Index))
+		for _, inst := range inner.Instructions {
+			m = appendMessage(m, innerInstructionsList, marshalInstruction(inst))
+		}
+		b = appendMessage(b, metaInnerInstructions, m)
+	}
+
+	for _, log := range meta.LogMessages {
+		b = appendString(b, metaLogMessages, log)
+	}
+
+	for _, balance := range meta.PreTokenBalances {
+		b = appendMessage(b, metaPreTokenBalances, marshalTokenBalance(balance))
+	}
+
+	for _, balance := range meta.PostTokenBalances {
+		b = appendMessage(b, metaPostTokenBalances, marshalTokenBalance(balance))
+	}
+
+	for _, key := range meta.LoadedAddresses.Writable {
+		b = appendBytes(b, metaLoadedWritable, key[:])
+	}
+
+	for _, key := range meta.LoadedAddresses.ReadOnly {
+		b = appendBytes(b, metaLoadedReadonly, key[:])
+	}
+
+	return b
+}
+
+func unmarshalMeta(b []byte) (*rpc.TransactionMeta, error) {
+	meta := &rpc.TransactionMeta{}
+	err := forEachField(b, func(num protowire.Number, typ protowire.Type, v []byte, x uint64) error {
+		switch num {
+		case metaErr:
+			var raw []byte
+			err := forEachField(v, func(num protowire.Number, typ protowire.Type, v []byte, x uint64) error {
+				if num == 1 {
+					raw = append(raw, v...)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			meta.Err = TransactionError(raw)
+		case metaFee:
+			meta.Fee = x
+		case metaPreBalances:
+			return appendUint64s(&meta.PreBalances, typ, v, x)
+		case metaPostBalances:
+			return appendUint64s(&meta.PostBalances, typ, v, x)
+		case metaInnerInstructions:
+			var inner rpc.InnerInstruction
+			err := forEachField(v, func(num protowire.Number, typ protowire.Type, v []byte, x uint64) error {
+				switch num {
+				case innerInstructionsIndex:
+					inner.Index = uint16(x)
+				case innerInstructionsList:
+					inst, err := unmarshalInstruction(v)
+					if err != nil {
+						return err
+					}
+					inner.Instructions = append(inner.Instructions, inst)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			meta.InnerInstructions = append(meta.InnerInstructions, inner)
+		case metaLogMessages:
+			meta.LogMessages = append(meta.LogMessages, string(v))
+		case metaPreTokenBalances, metaPostTokenBalances:
+			balance, err := unmarshalTokenBalance(v)
+			if err != nil {
+				return err
+			}
+
+			if num == metaPreTokenBalances {
+				meta.PreTokenBalances = append(meta.PreTokenBalances, balance)
+			} else {
+				meta.PostTokenBalances = append(meta.PostTokenBalances, balance)
+			}
+		case metaLoadedWritable, metaLoadedReadonly:
+			key, err := publicKey(v)
+			if err != nil {
+				return err
+			}
+
+			if num == metaLoadedWritable {
+				meta.LoadedAddresses.Writable = append(meta.LoadedAddresses.Writable, key)
+			} else {
+				meta.LoadedAddresses.ReadOnly = append(meta.LoadedAddresses.ReadOnly, key)
+			}
+		}
+		return nil
+	})
+
+	return meta, err
+}
+
+func marshalTokenBalance(balance rpc.TokenBalance) []byte {
+	var b []byte
+	b = protowire.AppendTag(b, tokenBalanceIndex, protowire.VarintType)
+	b = protowire.AppendVarint(b, uint64(balance.AccountIndex))
+	b = appendString(b, tokenBalanceMint, balance.Mint.String())
+
+	if amount := balance.UiTokenAmount; amount != nil {
+		var m []byte
+		if amount.UiAmount != nil {
+			m = protowire.AppendTag(m, uiAmountValue, protowire.Fixed64Type)
+			m = protowire.AppendFixed64(m, math.Float64bits(*amount.UiAmount))
+		}
+		m = protowire.AppendTag(m, uiAmountDecimals, protowire.VarintType)
+		m = protowire.AppendVarint(m, uint64(amount.Decimals))
+		m = appendString(m, uiAmountAmount, amount.Amount)
+		m = appendString(m, uiAmountString, amount.UiAmountString)
+		b = appendMessage(b, tokenBalanceAmount, m)
+	}
+
+	if balance.Owner != nil {
+		b = appendString(b, tokenBalanceOwner, balance.Owner.String())
+	}
+
+	return b
+}
+
+func unmarshalTokenBalance(b []byte) (rpc.TokenBalance, error) {
+	var balance rpc.TokenBalance
+	err := forEachField(b, func(num protowire.Number, typ protowire.Type, v []byte, x uint64) error {
+		var err error
+		switch num {
+		case tokenBalanceIndex:
+			balance.AccountIndex = uint16(x)
+		case tokenBalanceMint:
+			balance.Mint, err = solana.PublicKeyFromBase58(string(v))
+		case tokenBalanceOwner:
+			if len(v) > 0 {
+				var owner solana.PublicKey
+				owner, err = solana.PublicKeyFromBase58(string(v))
+				balance.Owner = &owner
+			}
+		case tokenBalanceAmount:
+			amount := &rpc.UiTokenAmount{}
+			err = forEachField(v, func(num protowire.Number, typ protowire.Type, v []byte, x uint64) error {
+				switch num {
+				case uiAmountValue:
+					value := math.Float64frombits(x)
+					amount.UiAmount = &value
+				case uiAmountDecimals:
+					amount.Decimals = uint8(x)
+				case uiAmountAmount:
+					amount.Amount = string(v)
+				case uiAmountString:
+					amount.UiAmountString = string(v)
+				}
+				return nil
+			})
+			balance.UiTokenAmount = amount
+		}
+		return err
+	})
+
+	return balance, err
+}
+
+// forEachField calls fn for every field of message; v is set for length-delimited fields and x for the others.
+func forEachField(b []byte, fn func(num protowire.Number, typ protowire.Type, v []byte, x uint64) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		var v []byte
+		var x uint64
+		switch typ {
+		case protowire.VarintType:
+			x, n = protowire.ConsumeVarint(b)
+		case protowire.Fixed32Type:
+			var x32 uint32
+			x32, n = protowire.ConsumeFixed32(b)
+			x = uint64(x32)
+		case protowire.Fixed64Type:
+			x, n = protowire.ConsumeFixed64(b)
+		case protowire.BytesType:
+			v, n = protowire.ConsumeBytes(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+
+		if n < 0 {
+			return fmt.Errorf("field %d: %w", num, protowire.ParseError(n))
+		}
+		b = b[n:]
+
+		if err := fn(num, typ, v, x); err != nil {
+			return fmt.Errorf("field %d: %w", num, err)
+		}
+	}
+
+	return nil
+}
+
+// appendUint64s appends value of repeated uint64 field, which can be packed or not.
+func appendUint64s(values *[]uint64, typ protowire.Type, v []byte, x uint64) error {
+	if typ != protowire.BytesType {
+		*values = append(*values, x)
+		return nil
+	}
+
+	for len(v) > 0 {
+		x, n := protowire.ConsumeVarint(v)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		*values = append(*values, x)
+		v = v[n:]
+	}
+
+	return nil
+}
+
+func publicKey(v []byte) (solana.PublicKey, error) {
+	if len(v) != solana.PublicKeyLength {
+		return solana.PublicKey{}, errors.New("invalid public key length " + strconv.Itoa(len(v)))
+	}
+
+	return solana.PublicKeyFromBytes(v), nil
+}
+
+func appendMessage(b []byte, num protowire.Number, m []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, m)
+}
+
+func appendBytes(b []byte, num protowire.Number, v []byte) []byte {
+	return appendMessage(b, num, v)
+}
+
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+func appendBool(b []byte, num protowire.Number, v bool) []byte {
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, protowire.EncodeBool(v))
+}
+
+func appendPacked(b []byte, num protowire.Number, values []uint64) []byte {
+	if len(values) == 0 {
+		return b
+	}
+
+	var packed []byte
+	for _, v := range values {
+		packed = protowire.AppendVarint(packed, v)
+	}
+
+	return appendMessage(b, num, packed)
+}
@@ -2,53 +2,203 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"os"
 	"os/signal"
+	"runtime"
 	"syscall"
 	"time"
 
+	"github.com/patrulek/rayscan/backtest"
+	"github.com/patrulek/rayscan/cache"
 	"github.com/patrulek/rayscan/config"
 	"github.com/patrulek/rayscan/connection"
 	"github.com/patrulek/rayscan/onchain"
+	"github.com/patrulek/rayscan/replay"
+	"github.com/patrulek/rayscan/trading"
+	"github.com/pelletier/go-toml"
+)
+
+var (
+	configPath  = flag.String("config", config.DefaultConfigPath, "path to config file")
+	recordPath  = flag.String("record", "", "record observed logs and RPC responses to given file")
+	replayPath  = flag.String("replay", "", "replay logs and RPC responses from given file instead of connecting to nodes")
+	replaySpeed = flag.Float64("replay-speed", 1, "replay speed multiplier; 0 replays without delays")
+
+	backtestFrom   = flag.String("backtest-from", "", "backtest only pairs seen at or after given time (RFC3339)")
+	backtestTo     = flag.String("backtest-to", "", "backtest only pairs seen before given time (RFC3339)")
+	backtestReport = flag.String("backtest-report", "backtest.json", "write backtest report to given file; empty disables")
 )
 
 func main() {
-	cfg, err := config.LoadConfig(config.DefaultConfigPath)
-	if err != nil {
-		fmt.Printf("Error loading config: %s\n", err)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [config check | backtest <recording>]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() > 0 {
+		switch {
+		case flag.NArg() == 2 && flag.Arg(0) == "config" && flag.Arg(1) == "check":
+			checkConfig()
+		case flag.NArg() == 2 && flag.Arg(0) == "backtest":
+			runBacktest(flag.Arg(1))
+		default:
+			flag.Usage()
+			os.Exit(2)
+		}
+		return
+	}
+
+	if *recordPath != "" && *replayPath != "" {
+		fmt.Printf("Error: -record and -replay cannot be used together\n")
 		os.Exit(1)
 	}
 
-	rpcPool, err := connection.NewRPCClientPool(cfg.Nodes)
+	cfg, err := loadConfig()
 	if err != nil {
-		fmt.Printf("Error creating rpc pool: %s\n", err)
+		fmt.Printf("Error loading config: %s\n", err)
 		os.Exit(1)
 	}
+
+	var rpcPool *connection.RPCPool
+	var player *replay.Player
+
+	if *replayPath != "" {
+		player, err = replay.LoadPlayer(*replayPath)
+		if err != nil {
+			fmt.Printf("Error loading replay: %s\n", err)
+			os.Exit(1)
+		}
+
+		rpcPool = player.RPCPool()
+	} else {
+		rpcPool, err = connection.NewRPCClientPool(cfg.Nodes, cfg.Pool)
+		if err != nil {
+			fmt.Printf("Error creating rpc pool: %s\n", err)
+			os.Exit(1)
+		}
+	}
 	defer rpcPool.Close()
 
-	pairCollector := onchain.NewPairCollector()
-	pairCollector.Start(nil)
+	var healthChecker *connection.HealthChecker
+	healthC := make(chan connection.HealthEvent, cfg.Pipeline.ChannelSize) // Consumed once observers are started.
+	if player == nil && cfg.Pool.HealthInterval > 0 {
+		healthChecker = connection.NewHealthChecker(rpcPool, cfg.Pool)
+
+		if err := healthChecker.Start(healthC); err != nil {
+			fmt.Printf("Error starting health checker: %s\n", err)
+			os.Exit(1)
+		}
+	}
+
+	var recorder *replay.Recorder
+	if *recordPath != "" {
+		recorder, err = replay.NewRecorder(*recordPath)
+		if err != nil {
+			fmt.Printf("Error creating recorder: %s\n", err)
+			os.Exit(1)
+		}
+		defer recorder.Close()
+
+		recorder.Wrap(rpcPool)
+	}
+
+	var positionManager *trading.PositionManager
+	var paperEngine *trading.PaperEngine
+	var pairPublishC []chan<- *onchain.PairInfo
+
+	if cfg.Trading.Enabled {
+		positionManager, err = trading.NewPositionManager(rpcPool, cfg.Trading)
+		if err != nil {
+			fmt.Printf("Error creating position manager: %s\n", err)
+			os.Exit(1)
+		}
+
+		intentC := make(chan trading.SwapIntent, cfg.Pipeline.ChannelSize)
+		go func() {
+			for intent := range intentC {
+				fmt.Printf("[%v] Sell intent (paper: %v, ammid: %s, token: %s, amount: %d, min out: %d, reason: %s)\n", time.Now().Format("2006-01-02 15:04:05.000"), intent.Paper, intent.AmmID, intent.InputMint, intent.AmountIn, intent.MinAmountOut, intent.Reason)
+			}
+		}()
 
-	txAnalyzer := onchain.NewTxAnalyzer(rpcPool)
+		if err := positionManager.Start(intentC); err != nil {
+			fmt.Printf("Error starting position manager: %s\n", err)
+			os.Exit(1)
+		}
+
+		paperEngine = trading.NewPaperEngine(rpcPool, positionManager, cfg.Trading)
+		paperEngine.Start()
+		pairPublishC = append(pairPublishC, paperEngine.Channel())
+	}
+
+	expiredC := make(chan onchain.ExpiredMarket, cfg.Pipeline.ChannelSize)
+	go func() {
+		for event := range expiredC {
+			fmt.Printf("[%v] Market dropped without pool (token: %s, tx time: %v, reason: %s)\n", event.Time.Format("2006-01-02 15:04:05.000"), event.Pair.MarketInfo.TokenAddress(), event.Pair.MarketInfo.TxTime.Format("2006-01-02 15:04:05.000"), event.Reason)
+		}
+	}()
+
+	pairCollector := onchain.NewPairCollector(cfg.Pipeline)
+	pairCollector.Start(pairPublishC, expiredC)
+
+	txAnalyzer := onchain.NewTxAnalyzer(rpcPool, cfg.Pipeline)
 	txAnalyzer.Start(pairCollector.Channel())
 
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	dedup := onchain.NewSignatureDedup(cfg.Pipeline)
+	if cfg.Pipeline.MemoryStatsInterval > 0 {
+		go printMemoryStats(cfg.Pipeline.MemoryStatsInterval, dedup, pairCollector)
+	}
+
+	if cfg.Pipeline.RaceSummaryInterval > 0 {
+		go func() {
+			for range time.Tick(cfg.Pipeline.RaceSummaryInterval) {
+				reportLeaderboard(dedup, cfg.Pipeline.RaceFile)
+			}
+		}()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Pipeline.StartTimeout)
 	defer cancel()
 
-	var observers []*onchain.LogObserver
-	for _, v := range rpcPool.Connections {
-		if !v.ConnectionInfo.Observer {
+	observers := newObserverSet(rpcPool, cfg.Pipeline, recorder, dedup, txAnalyzer.Channel())
+
+	for _, v := range rpcPool.ConnectionList() {
+		if player != nil {
+			if v.HasRole(connection.RoleObserver) {
+				observer := onchain.NewLogObserver(rpcPool, v.ConnectionInfo.Name, cfg.Pipeline, dedup, onchain.DefaultSubscriptions()) // Fed by player instead of subscriptions.
+				if err := observers.add(ctx, player.Source(observer, dedup, *replaySpeed)); err != nil {
+					fmt.Printf("Error starting %s replay: %s\n", v.ConnectionInfo.Name, err)
+					os.Exit(1)
+				}
+			}
 			continue
 		}
 
-		obs := onchain.NewLogObserver(rpcPool, v.ConnectionInfo.Name)
-		if err := obs.Start(ctx, txAnalyzer.Channel()); err != nil {
+		if err := observers.start(ctx, v); err != nil {
 			fmt.Printf("Error starting %s log observer: %s\n", v.ConnectionInfo.Name, err)
 			os.Exit(1)
 		}
+	}
+
+	// Connections skipped as unhealthy are observed once they're back in rotation.
+	go func() {
+		for event := range healthC {
+			if event.Healthy {
+				fmt.Printf("[%v] Connection %s is back in rotation (slot: %d, lag: %d, latency: %v)\n", event.Time.Format("2006-01-02 15:04:05.000"), event.Connection, event.Slot, event.SlotLag, event.Latency)
+			} else {
+				fmt.Printf("[%v] Connection %s is out of rotation (reason: %s)\n", event.Time.Format("2006-01-02 15:04:05.000"), event.Connection, event.Reason)
+			}
+
+			observers.handleHealth(event)
+		}
+	}()
 
-		observers = append(observers, obs)
+	var configReloader *reloader
+	if player == nil {
+		configReloader = newReloader(*configPath, cfg, rpcPool, observers, paperEngine, positionManager)
+		configReloader.Start()
 	}
 
 	var stopChan = make(chan os.Signal, 1)
@@ -56,15 +206,22 @@ func main() {
 	<-stopChan // wait for SIGINT
 
 	fmt.Printf("Interrupted; stopping...\n")
-	ctx, cancel = context.WithTimeout(context.Background(), 15*time.Second)
+	ctx, cancel = context.WithTimeout(context.Background(), cfg.Pipeline.ShutdownTimeout)
 	defer cancel()
 
-	for _, obs := range observers {
-		if err := obs.Stop(ctx); err != nil {
-			fmt.Printf("Error stopping %s log observer: %s\n", obs.ConnectionName(), err)
+	if configReloader != nil {
+		configReloader.Stop()
+	}
+
+	// Stopped before observers, so none is started by health event.
+	if healthChecker != nil {
+		if err := healthChecker.Stop(ctx); err != nil {
+			fmt.Printf("Error stopping health checker: %s\n", err)
 		}
 	}
 
+	observers.stopAll(ctx)
+
 	if err := txAnalyzer.Stop(ctx); err != nil {
 		fmt.Printf("Error stopping tx analyzer: %s\n", err)
 	}
@@ -72,4 +229,169 @@ func main() {
 	if err := pairCollector.Stop(ctx); err != nil {
 		fmt.Printf("Error stopping pair collector: %s\n", err)
 	}
+
+	if paperEngine != nil {
+		if err := paperEngine.Stop(ctx); err != nil {
+			fmt.Printf("Error stopping paper engine: %s\n", err)
+		}
+	}
+
+	if positionManager != nil {
+		if err := positionManager.Stop(ctx); err != nil {
+			fmt.Printf("Error stopping position manager: %s\n", err)
+		}
+	}
+
+	for name, stats := range rpcPool.Stats() {
+		fmt.Printf("Connection %s stats: requests: %d, errors: %d, rate limited: %d, timeouts: %d, node behind: %d, cooldowns: %d, throttled: %d, p50 latency: %v, hedge wins: %d/%d\n",
+			name, stats.Requests, stats.Errors, stats.RateLimited, stats.Timeouts, stats.NodeBehind, stats.Cooldowns, stats.Throttled, stats.P50Latency, stats.HedgeWins, stats.Hedged)
+	}
+
+	reportLeaderboard(dedup, cfg.Pipeline.RaceFile)
+}
+
+// printMemoryStats periodically prints memory usage and sizes of dedup caches.
+func printMemoryStats(interval time.Duration, dedup *onchain.SignatureDedup, pairCollector *onchain.PairCollector) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		var mem runtime.MemStats
+		runtime.ReadMemStats(&mem)
+
+		fmt.Printf("[%v] Memory: heap: %d KiB, sys: %d KiB, goroutines: %d, gc cycles: %d\n", time.Now().Format("2006-01-02 15:04:05.000"), mem.HeapAlloc/1024, mem.Sys/1024, runtime.NumGoroutine(), mem.NumGC)
+
+		pending, created := pairCollector.CacheStats()
+		for _, c := range []struct {
+			name  string
+			stats cache.Stats
+		}{
+			{"signatures", dedup.CacheStats()},
+			{"pending markets", pending},
+			{"created pairs", created},
+		} {
+			fmt.Printf("[%v] Memory: %s cache: %d/%d entries, expired: %d, evicted: %d\n", time.Now().Format("2006-01-02 15:04:05.000"), c.name, c.stats.Len, c.stats.Size, c.stats.Expired, c.stats.Evicted)
+		}
+	}
+}
+
+// reportLeaderboard prints observer leaderboard and exports it to files with given base name, if not empty.
+func reportLeaderboard(dedup *onchain.SignatureDedup, path string) {
+	leaderboard := onchain.NewLeaderboard(dedup.Stats())
+
+	fmt.Printf("[%v] Observer leaderboard (signatures: %d):\n", leaderboard.Time.Format("2006-01-02 15:04:05.000"), leaderboard.Signatures)
+	for i, e := range leaderboard.Entries {
+		fmt.Printf("  %d. %s: first: %d (%.1f%%), seen: %d, missed: %d (%.1f%%), delay p50: %v, p90: %v, p99: %v, max: %v\n",
+			i+1, e.Node, e.First, e.FirstShare*100, e.Seen, e.Missed, e.MissRate*100, e.P50Delay, e.P90Delay, e.P99Delay, e.MaxDelay)
+	}
+
+	if path == "" {
+		return
+	}
+
+	if err := leaderboard.ExportJSON(path + ".json"); err != nil {
+		fmt.Printf("Error exporting observer leaderboard: %s\n", err)
+	}
+
+	if err := leaderboard.ExportCSV(path + ".csv"); err != nil {
+		fmt.Printf("Error exporting observer leaderboard: %s\n", err)
+	}
+}
+
+// loadConfig loads and validates config file given by flag.
+func loadConfig() (config.Config, error) {
+	cfg, err := config.LoadConfig(*configPath)
+	if err != nil {
+		return config.Config{}, err
+	}
+
+	if err := connection.ValidateConfig(cfg); err != nil {
+		return config.Config{}, err
+	}
+
+	return cfg, nil
+}
+
+// checkConfig validates config file and prints effective configuration with secrets redacted.
+func checkConfig() {
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Printf("Config is invalid: %s\n", err)
+		os.Exit(1)
+	}
+
+	data, err := toml.Marshal(cfg.Redacted())
+	if err != nil {
+		fmt.Printf("Error printing config: %s\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("# Effective configuration of %s\n%s", *configPath, data)
+}
+
+// runBacktest runs strategy from trading config over pairs and reserves recorded in given file and prints its report.
+func runBacktest(path string) {
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Printf("Error loading config: %s\n", err)
+		os.Exit(1)
+	}
+
+	var from, to time.Time
+	for _, f := range []struct {
+		value string
+		t     *time.Time
+	}{{*backtestFrom, &from}, {*backtestTo, &to}} {
+		if f.value == "" {
+			continue
+		}
+
+		if *f.t, err = time.Parse(time.RFC3339, f.value); err != nil {
+			fmt.Printf("Error parsing backtest range: %s\n", err)
+			os.Exit(2)
+		}
+	}
+
+	player, err := replay.LoadPlayer(path)
+	if err != nil {
+		fmt.Printf("Error loading recording: %s\n", err)
+		os.Exit(1)
+	}
+
+	history, err := backtest.HistoryFromPlayer(player)
+	if err != nil {
+		fmt.Printf("Error loading reserves: %s\n", err)
+		os.Exit(1)
+	}
+
+	pairs, err := backtest.Pairs(player, cfg.Pipeline)
+	if err != nil {
+		fmt.Printf("Error finding pairs: %s\n", err)
+		os.Exit(1)
+	}
+
+	report := backtest.Run(pairs, history, backtest.StrategyFromConfig(cfg.Trading), from, to)
+
+	fmt.Printf("Backtest of %s (pairs: %d, unsimulated: %d, entered: %d, fills: %d)\n", path, report.Pairs, report.Unsimulated, len(report.Trades), report.Fills)
+	fmt.Printf("  closed: %d, win rate: %.2f, pnl: %.0f, max drawdown: %.0f\n", report.Closed, report.WinRate, report.TotalPnL, report.MaxDrawdown)
+	fmt.Printf("  slippage: mean: %.2f%%, max: %.2f%%\n", report.MeanSlippage*100, report.MaxSlippage*100)
+	fmt.Printf("  returns: p10: %.2f%%, p50: %.2f%%, p90: %.2f%%\n", report.Returns.P10*100, report.Returns.P50*100, report.Returns.P90*100)
+	for _, b := range report.Returns.Buckets {
+		fmt.Printf("    %s: %d\n", b.Range, b.Count)
+	}
+
+	for _, r := range report.EntryRules {
+		fmt.Printf("  entry rule %s: rejected: %d\n", r.Rule, r.Rejected)
+	}
+
+	for _, r := range report.ExitRules {
+		fmt.Printf("  exit rule %s: trades: %d, wins: %d, pnl: %.0f\n", r.Rule, r.Trades, r.Wins, r.PnL)
+	}
+
+	if *backtestReport != "" {
+		if err := report.ExportJSON(*backtestReport); err != nil {
+			fmt.Printf("Error exporting backtest report: %s\n", err)
+			os.Exit(1)
+		}
+	}
 }
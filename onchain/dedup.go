@@ -0,0 +1,240 @@
+package onchain
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/patrulek/rayscan/cache"
+	"github.com/patrulek/rayscan/config"
+)
+
+// Upper bounds of delay histogram buckets; the last bucket of histogram has no bound.
+var DelayBuckets = []time.Duration{
+	0, time.Millisecond, 5 * time.Millisecond, 10 * time.Millisecond, 25 * time.Millisecond, 50 * time.Millisecond,
+	100 * time.Millisecond, 250 * time.Millisecond, 500 * time.Millisecond, time.Second, 5 * time.Second,
+}
+
+// FirstSeenStats tell how often observer of given connection saw signature before other observers and how late it was otherwise.
+type FirstSeenStats struct {
+	Seen       uint64        // Signatures seen by observer.
+	First      uint64        // Signatures seen by observer before any other.
+	Late       uint64        // Signatures already seen by other observer.
+	Raced      uint64        // Settled races observer took part in.
+	Missed     uint64        // Raced signatures observer didn't see within race window.
+	TotalDelay time.Duration // Sum of delays behind the first observer of late signatures.
+	MaxDelay   time.Duration
+	Histogram  []uint64 // Number of seen signatures by delay behind the first observer; buckets are given by DelayBuckets.
+}
+
+// AvgDelay returns average delay behind the first observer of late signatures.
+func (s FirstSeenStats) AvgDelay() time.Duration {
+	if s.Late == 0 {
+		return 0
+	}
+
+	return s.TotalDelay / time.Duration(s.Late)
+}
+
+// Percentile returns upper bound of delay behind the first observer of q (within [0, 1]) of seen signatures.
+func (s FirstSeenStats) Percentile(q float64) time.Duration {
+	target := uint64(q*float64(s.Seen) + 0.5)
+	var count uint64
+
+	for i, n := range s.Histogram {
+		count += n
+		if count >= max(target, 1) && i < len(DelayBuckets) {
+			return min(DelayBuckets[i], s.MaxDelay)
+		}
+	}
+
+	return s.MaxDelay
+}
+
+func (s *FirstSeenStats) record(delay time.Duration) {
+	if s.Histogram == nil {
+		s.Histogram = make([]uint64, len(DelayBuckets)+1)
+	}
+
+	i := 0
+	for i < len(DelayBuckets) && delay > DelayBuckets[i] {
+		i++
+	}
+
+	s.Histogram[i]++
+	s.MaxDelay = max(s.MaxDelay, delay)
+}
+
+// race tracks observers that saw given signature; first is empty if signature was backfilled.
+type race struct {
+	first  string
+	time   time.Time
+	seenBy map[string]struct{}
+}
+
+// claimKey is a signature observed for given program. Transaction mentioning several observed programs (eg. Raydium pool
+// initialization mentions OpenBook too) is claimed for every one of them, as every program finds its own candidates in it.
+type claimKey struct {
+	program   solana.PublicKey
+	signature solana.Signature
+}
+
+// SignatureDedup is a set of signatures seen by log observers. It's shared by all observers, so every signature
+// is analyzed only once per program, by the observer that claimed it first. Signatures are raced between observers,
+// once per signature whatever programs it was seen for: a race is settled after race window, and observers
+// that didn't see signature till then count it as missed.
+type SignatureDedup struct {
+	claims     *cache.LRU[claimKey, struct{}]
+	races      *cache.LRU[solana.Signature, *race]
+	raceWindow time.Duration
+
+	mu        sync.Mutex
+	pending   []*race              // Unsettled races in order of first sighting.
+	observers map[string]time.Time // Connection name -> registration time
+	refs      map[string]int       // Connection name -> number of registered sources
+	stats     map[string]*FirstSeenStats
+}
+
+func NewSignatureDedup(cfg config.Pipeline) *SignatureDedup {
+	return &SignatureDedup{
+		claims:     cache.New[claimKey, struct{}](cfg.DedupSize, cfg.DedupTTL, nil),
+		races:      cache.New[solana.Signature, *race](cfg.DedupSize, cfg.DedupTTL, nil),
+		raceWindow: cfg.RaceWindow,
+		observers:  make(map[string]time.Time),
+		refs:       make(map[string]int),
+		stats:      make(map[string]*FirstSeenStats),
+	}
+}
+
+// Register adds observer of given connection to the races started from now on; only registered observers miss signatures.
+// Every source of connection registers it, so it stays registered until all of them unregister.
+func (d *SignatureDedup) Register(connName string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.refs[connName]++
+	if _, ok := d.observers[connName]; !ok {
+		d.observers[connName] = time.Now()
+	}
+
+	if _, ok := d.stats[connName]; !ok {
+		d.stats[connName] = &FirstSeenStats{}
+	}
+}
+
+// Unregister removes observer of given connection from unsettled and future races.
+func (d *SignatureDedup) Unregister(connName string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.refs[connName]--; d.refs[connName] > 0 {
+		return // Other source of connection is still running.
+	}
+
+	delete(d.refs, connName)
+	delete(d.observers, connName)
+}
+
+// Claim marks signature as seen for given program by observer of given connection at given time and returns true
+// if nobody saw it for that program before.
+func (d *SignatureDedup) Claim(program solana.PublicKey, signature solana.Signature, connName string, seenAt time.Time) bool {
+	claimed := d.claims.Add(claimKey{program, signature}, struct{}{})
+	r, started := d.races.GetOrAdd(signature, &race{first: connName, time: seenAt, seenBy: make(map[string]struct{})})
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.settle(seenAt)
+	if r.first == "" {
+		return claimed // Backfilled; not a race.
+	}
+
+	if _, ok := r.seenBy[connName]; ok {
+		return claimed // Seen again by the same observer (eg. for other program or by its fallback source); not a race.
+	}
+
+	stats, ok := d.stats[connName]
+	if !ok {
+		stats = &FirstSeenStats{}
+		d.stats[connName] = stats
+	}
+
+	stats.Seen++
+
+	r.seenBy[connName] = struct{}{}
+	if started {
+		d.pending = append(d.pending, r)
+
+		stats.First++
+		stats.record(0)
+		return claimed
+	}
+
+	delay := max(seenAt.Sub(r.time), 0)
+	stats.Late++
+	stats.TotalDelay += delay
+	stats.record(delay)
+
+	return claimed
+}
+
+// Backfill marks signature of given program found by other means than observing (eg. by filling gap after reconnect)
+// as seen and returns true if nobody saw it for that program before. Backfilled signatures don't take part in races.
+func (d *SignatureDedup) Backfill(program solana.PublicKey, signature solana.Signature) bool {
+	d.races.GetOrAdd(signature, &race{time: time.Now(), seenBy: make(map[string]struct{})})
+	return d.claims.Add(claimKey{program, signature}, struct{}{})
+}
+
+// Release forgets claim of signature for given program (eg. as its transaction couldn't be fetched), so it can be claimed again.
+// Race of signature isn't affected.
+func (d *SignatureDedup) Release(program solana.PublicKey, signature solana.Signature) {
+	d.claims.Delete(claimKey{program, signature})
+}
+
+// Stats returns first-seen stats of every observer that took part in any race.
+func (d *SignatureDedup) Stats() map[string]FirstSeenStats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.settle(time.Now())
+
+	stats := make(map[string]FirstSeenStats, len(d.stats))
+	for connName, s := range d.stats {
+		s := *s
+		s.Histogram = append([]uint64(nil), s.Histogram...)
+		stats[connName] = s
+	}
+
+	return stats
+}
+
+// CacheStats returns stats of set of claimed signatures.
+func (d *SignatureDedup) CacheStats() cache.Stats {
+	return d.claims.Stats()
+}
+
+// settle settles races older than race window, counting missed signatures. Caller has to hold the lock.
+func (d *SignatureDedup) settle(now time.Time) {
+	settled := 0
+	for _, r := range d.pending {
+		if now.Sub(r.time) < d.raceWindow {
+			break
+		}
+
+		for connName, since := range d.observers {
+			if since.After(r.time) {
+				continue // Registered after race started.
+			}
+
+			d.stats[connName].Raced++
+			if _, ok := r.seenBy[connName]; !ok {
+				d.stats[connName].Missed++
+			}
+		}
+
+		settled++
+	}
+
+	clear(d.pending[:settled])
+	d.pending = d.pending[settled:]
+}
@@ -0,0 +1,63 @@
+package onchain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/patrulek/rayscan/onchain/raydium"
+	"github.com/patrulek/rayscan/onchain/serum"
+)
+
+func TestDedupRacesSignatureOnceForAllPrograms(t *testing.T) {
+	cfg, _ := testDefaults(t)
+	cfg.RaceWindow = time.Second
+	d := NewSignatureDedup(cfg)
+	d.Register("a")
+	d.Register("b")
+
+	// Raydium pool initialization is seen for both programs by both observers.
+	now := time.Now()
+	sig := testSignature(1)
+	claims := []bool{
+		d.Claim(raydium.Raydium_Liquidity_Program_V4, sig, "a", now),
+		d.Claim(serum.OpenBookDex, sig, "a", now),
+		d.Claim(raydium.Raydium_Liquidity_Program_V4, sig, "b", now.Add(10*time.Millisecond)),
+		d.Claim(serum.OpenBookDex, sig, "b", now.Add(20*time.Millisecond)),
+	}
+
+	if !claims[0] || !claims[1] || claims[2] || claims[3] {
+		t.Fatalf("expected signature claimed once per program by the first observer, got %v", claims)
+	}
+
+	// Settle the race.
+	d.Claim(serum.OpenBookDex, testSignature(2), "a", now.Add(2*time.Second))
+
+	stats := d.Stats()
+	if a := stats["a"]; a.Seen != 2 || a.First != 2 || a.Late != 0 || a.Raced != 1 || a.Missed != 0 {
+		t.Fatalf("unexpected stats of a: %+v", a)
+	}
+
+	if b := stats["b"]; b.Seen != 1 || b.First != 0 || b.Late != 1 || b.Raced != 1 || b.Missed != 0 || b.MaxDelay != 10*time.Millisecond {
+		t.Fatalf("unexpected stats of b: %+v", b)
+	}
+}
+
+func TestDedupDoesntRaceBackfilledSignature(t *testing.T) {
+	cfg, _ := testDefaults(t)
+	d := NewSignatureDedup(cfg)
+	d.Register("a")
+
+	sig := testSignature(1)
+	if !d.Backfill(serum.OpenBookDex, sig) {
+		t.Fatalf("expected backfilled signature to be claimed")
+	}
+
+	// Still claimed for other program, but not raced.
+	if d.Claim(serum.OpenBookDex, sig, "a", time.Now()) || !d.Claim(raydium.Raydium_Liquidity_Program_V4, sig, "a", time.Now()) {
+		t.Fatalf("expected backfilled signature claimed for other program only")
+	}
+
+	if a := d.Stats()["a"]; a.Seen != 0 {
+		t.Fatalf("expected backfilled signature not to be raced: %+v", a)
+	}
+}
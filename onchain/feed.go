@@ -0,0 +1,258 @@
+package onchain
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// SourceKind tells how observer receives messages of observed programs.
+type SourceKind string
+
+const (
+	SourceLogs         SourceKind = "logs"         // Websocket logsSubscribe; transactions are fetched by TxAnalyzer.
+	SourceBlocks       SourceKind = "blocks"       // Websocket blockSubscribe with full transactions.
+	SourceTransactions SourceKind = "transactions" // Websocket transactionSubscribe with full transactions (provider extension).
+	SourceGeyser       SourceKind = "geyser"       // Yellowstone gRPC stream with full transactions.
+	SourcePolling      SourceKind = "polling"      // Polling getSignaturesForAddress; transactions are fetched to get their logs.
+	SourceReplay       SourceKind = "replay"       // Logs recorded earlier (see replay package).
+)
+
+// messages returns description of messages received from source, for log output.
+func (k SourceKind) messages() string {
+	switch k {
+	case SourceGeyser:
+		return "transactions (geyser)"
+	case SourcePolling:
+		return "signatures (polling)"
+	default:
+		return string(k)
+	}
+}
+
+// feed is an open stream of messages of observed programs.
+type feed interface {
+	// recv waits for next message and handles it; false is returned for keepalive messages, which don't prove that feed works.
+	recv(txCandidatePublishC chan<- TxCandidate) (bool, error)
+	// close ends the feed, making recv fail; it can be called many times.
+	close()
+}
+
+// feedGroup is a set of subscriptions served by single feed, which is reopened whenever it breaks.
+type feedGroup struct {
+	subs   []*subscription
+	kind   SourceKind
+	policy ReconnectPolicy
+
+	mu   sync.Mutex
+	feed feed // Closed on reconnect and on stop.
+
+	degradedSince atomic.Int64 // Unix nanoseconds of the first failure since feed last worked; 0 if it works.
+}
+
+func (g *feedGroup) String() string {
+	names := make([]string, len(g.subs))
+	for i, sub := range g.subs {
+		names[i] = sub.Name
+	}
+
+	return strings.Join(names, ", ") + " program " + g.kind.messages()
+}
+
+// feedGroups returns groups of subscriptions of observer using given source; geyser stream is shared by all subscriptions
+// and uses reconnect policy of pipeline config, other sources open feed per subscription.
+func (o *LogObserver) feedGroups(kind SourceKind) []*feedGroup {
+	if kind == SourceGeyser {
+		return []*feedGroup{{
+			subs: o.subscriptions,
+			kind: kind,
+			policy: ReconnectPolicy{
+				Timeout:     o.cfg.SubscribeTimeout,
+				Delay:       o.cfg.ResubscribeDelay,
+				MaxDelay:    max(o.cfg.ResubscribeMaxDelay, o.cfg.ResubscribeDelay),
+				IdleTimeout: o.cfg.SubscriptionIdleTimeout,
+			},
+		}}
+	}
+
+	groups := make([]*feedGroup, len(o.subscriptions))
+	for i, sub := range o.subscriptions {
+		groups[i] = &feedGroup{subs: []*subscription{sub}, kind: kind, policy: sub.Reconnect}
+	}
+
+	return groups
+}
+
+// openFeed opens new feed of given group, closing its previous one. Feed is closed when observer stops.
+func (o *LogObserver) openFeed(ctx context.Context, group *feedGroup) (feed, error) {
+	fmt.Printf("[%v] LogObserver: Subscribe for %s on %s...\n", time.Now().Format("2006-01-02 15:04:05.000"), group, o.connName)
+
+	conn, err := o.rpcPool.NamedConnection(o.connName)
+	if err != nil {
+		return nil, err
+	}
+
+	var f feed
+	switch group.kind {
+	case SourceGeyser:
+		f, err = o.openGeyser(ctx, conn)
+	case SourceBlocks, SourceTransactions:
+		f, err = o.openTxStream(ctx, conn, group.kind, group.subs[0])
+	case SourcePolling:
+		f, err = o.openPoll(ctx, conn, group.subs[0])
+	default:
+		f, err = o.openLogs(ctx, conn, group.subs[0])
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if !o.running.Load() {
+		f.close()
+		return nil, fmt.Errorf("LogObserver is not running")
+	}
+
+	group.mu.Lock()
+	prev := group.feed
+	group.feed = f
+	group.mu.Unlock()
+
+	if prev != nil {
+		prev.close()
+	}
+
+	return f, nil
+}
+
+// closeFeed closes given feed of group, forgetting it if it's still the current one; nil closes the current feed.
+func (o *LogObserver) closeFeed(group *feedGroup, f feed) {
+	group.mu.Lock()
+	if f == nil {
+		f = group.feed
+	}
+
+	if group.feed == f {
+		group.feed = nil
+	}
+	group.mu.Unlock()
+
+	if f != nil {
+		f.close()
+	}
+}
+
+// consumeFeed handles messages of feed of given group until observer stops, then closes doneC.
+func (o *LogObserver) consumeFeed(group *feedGroup, f feed, doneC chan<- struct{}, txCandidatePublishC chan<- TxCandidate) {
+	defer close(doneC)
+
+	// Feeds are pinged, but some nodes keep answering while subscription stalls; closing feed makes recv fail.
+	var idleTimer *time.Timer
+	if group.policy.IdleTimeout > 0 {
+		idleTimer = time.AfterFunc(group.policy.IdleTimeout, func() {
+			fmt.Printf("[%v] LogObserver: No %s on %s for %v; closing connection...\n", time.Now().Format("2006-01-02 15:04:05.000"), group, o.connName, group.policy.IdleTimeout)
+			for _, sub := range group.subs {
+				sub.stats.idleTimeout.Add(1)
+			}
+			o.closeFeed(group, nil)
+		})
+		defer idleTimer.Stop()
+	}
+
+	var delay time.Duration // Backoff of last reconnect; kept while new feeds break without delivering anything.
+	delivered := false
+
+	for o.running.Load() {
+		active, err := f.recv(txCandidatePublishC)
+		if err == nil {
+			delivered = true
+			group.degradedSince.Store(0)
+			if !active {
+				continue // Keepalive doesn't reset idle timer.
+			}
+		} else {
+			if !o.running.Load() {
+				return // Stopped; feed closed.
+			}
+
+			group.degradedSince.CompareAndSwap(0, time.Now().UnixNano())
+
+			if idleTimer != nil {
+				idleTimer.Stop() // Don't close feed being opened.
+			}
+
+			if delivered {
+				delay = 0
+			} else {
+				delay = group.policy.backoff(delay)
+			}
+
+			f, delay = o.reconnect(group, f, delay, err, txCandidatePublishC)
+			if f == nil {
+				return // Stopped while reconnecting.
+			}
+			delivered = false
+		}
+
+		if idleTimer != nil {
+			idleTimer.Reset(group.policy.IdleTimeout)
+		}
+	}
+}
+
+// reconnect replaces broken feed with a new one, retrying with jittered exponential backoff until it succeeds
+// or observer stops (then nil is returned). Feed can be opened fine and then rejected (eg. due to invalid token),
+// so non-zero delay is waited before the first attempt; delay of the successful attempt is returned.
+// Messages missed in the meantime are searched for in background, unless feed polls them itself.
+func (o *LogObserver) reconnect(group *feedGroup, f feed, delay time.Duration, reason error, txCandidatePublishC chan<- TxCandidate) (feed, time.Duration) {
+	wait := jitter(delay)
+	fmt.Printf("[%v] LogObserver: Reconnecting subscription for %s on %s in %v due to: %v...\n", time.Now().Format("2006-01-02 15:04:05.000"), group, o.connName, wait.Round(time.Millisecond), reason)
+	o.closeFeed(group, f)
+
+	lastSignatures := make([]solana.Signature, len(group.subs))
+	for i, sub := range group.subs {
+		sub.stats.reconnects.Add(1)
+
+		sub.mu.Lock()
+		lastSignatures[i] = sub.lastSignature
+		sub.mu.Unlock()
+	}
+
+	for o.running.Load() {
+		select {
+		case <-o.stopC:
+			return nil, 0
+		case <-time.After(wait):
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), group.policy.Timeout)
+		newFeed, err := o.openFeed(ctx, group)
+		cancel()
+
+		if err == nil {
+			if group.kind != SourcePolling { // Polling feed continues from the last signature itself.
+				for i, sub := range group.subs {
+					o.background.Add(1)
+					go func(sub *subscription, until solana.Signature) {
+						defer o.background.Done()
+						o.fillGap(sub, until, txCandidatePublishC)
+					}(sub, lastSignatures[i])
+				}
+			}
+			return newFeed, delay
+		}
+
+		delay = group.policy.backoff(delay)
+		wait = jitter(delay)
+		fmt.Printf("[%v] LogObserver: Error reconnecting subscription for %s on %s: %v; trying again in %v...\n", time.Now().Format("2006-01-02 15:04:05.000"), group, o.connName, err, wait.Round(time.Millisecond))
+	}
+
+	return nil, 0
+}
@@ -0,0 +1,117 @@
+package onchain
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/patrulek/rayscan/connection"
+	"github.com/patrulek/rayscan/geyser"
+)
+
+// geyserFeed is a Subscribe stream of observer whose node has geyser endpoint; it's shared by all program subscriptions.
+type geyserFeed struct {
+	observer *LogObserver
+	client   *geyser.Client
+	stream   *geyser.Stream
+	cancel   context.CancelFunc // Ends the stream.
+	once     sync.Once
+}
+
+// geyserRequest returns request for successful non-vote transactions mentioning observed programs,
+// with one filter per subscription, named after it. Streams have single commitment, so logs_commitment is used.
+func (o *LogObserver) geyserRequest() (*geyser.SubscribeRequest, error) {
+	commitment, err := geyser.ParseCommitment(o.cfg.LogsCommitment)
+	if err != nil {
+		return nil, err
+	}
+
+	vote, failed := false, false
+	req := &geyser.SubscribeRequest{
+		Transactions: make(map[string]geyser.TransactionFilter, len(o.subscriptions)),
+		Commitment:   &commitment,
+	}
+
+	for _, sub := range o.subscriptions {
+		req.Transactions[sub.Name] = geyser.TransactionFilter{
+			Vote:           &vote,
+			Failed:         &failed,
+			AccountInclude: []string{sub.ProgramID.String()},
+		}
+	}
+
+	return req, nil
+}
+
+// openGeyser opens new Subscribe stream; ctx bounds opening only, not the stream itself.
+func (o *LogObserver) openGeyser(ctx context.Context, conn *connection.Connection) (feed, error) {
+	req, err := o.geyserRequest()
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := conn.DialGeyser()
+	if err != nil {
+		return nil, err
+	}
+
+	streamCtx, cancel := context.WithCancel(context.Background())
+	stopCancel := context.AfterFunc(ctx, cancel)
+
+	stream, err := client.Subscribe(streamCtx)
+	if err == nil {
+		err = stream.Send(req)
+	}
+
+	if !stopCancel() && err == nil {
+		err = ctx.Err() // Stream was canceled while opening.
+	}
+
+	if err != nil {
+		cancel()
+		client.Close()
+		return nil, err
+	}
+
+	return &geyserFeed{observer: o, client: client, stream: stream, cancel: cancel}, nil
+}
+
+func (f *geyserFeed) recv(txCandidatePublishC chan<- TxCandidate) (bool, error) {
+	update, err := f.stream.Recv()
+	if err != nil {
+		return false, err
+	}
+
+	switch {
+	case update.Ping:
+		// Answering keeps stream alive behind load balancers that close idle connections.
+		id := int32(1)
+		return false, f.stream.Send(&geyser.SubscribeRequest{Ping: &id})
+	case update.Transaction != nil:
+		tx := update.Transaction
+		if tx.Transaction == nil || tx.Meta == nil {
+			return true, nil
+		}
+
+		// Updates don't carry block time; time of receipt is close enough for processed transactions.
+		blockTime := solana.UnixTimeSeconds(time.Now().Unix())
+		streamed := &StreamedTx{
+			Result:      &rpc.GetTransactionResult{Slot: tx.Slot, BlockTime: &blockTime, Meta: tx.Meta},
+			Transaction: tx.Transaction,
+		}
+
+		f.observer.handleStreamedTx(update.Filters, streamed, txCandidatePublishC)
+		return true, nil
+	default:
+		return false, nil // Pong.
+	}
+}
+
+func (f *geyserFeed) close() {
+	f.once.Do(func() {
+		f.cancel()
+		f.client.Close()
+	})
+}
@@ -0,0 +1,168 @@
+package onchain
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/patrulek/rayscan/config"
+	"github.com/patrulek/rayscan/connection"
+	"github.com/patrulek/rayscan/fakerpc"
+	"github.com/patrulek/rayscan/geyser"
+	"github.com/patrulek/rayscan/onchain/raydium"
+)
+
+// startGeyserObserver starts observer of default programs on node with geyser endpoint of given server
+// and waits until stream is opened; it's stopped with the test.
+func startGeyserObserver(t *testing.T, g *fakerpc.GeyserServer, token string, candidateC chan<- TxCandidate) {
+	t.Helper()
+
+	cfg, poolCfg := testDefaults(t)
+	s := fakerpc.NewServer(fakerpc.Fixtures{})
+	t.Cleanup(s.Close)
+
+	nodes := map[string]config.RPCNode{
+		"node": {RPCEndpoint: s.RPCURL(), Geyser: g.Endpoint(), GeyserToken: token, Observer: true},
+	}
+
+	pool, err := connection.NewRPCClientPool(nodes, poolCfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+
+	o := NewLogObserver(pool, "node", cfg, NewSignatureDedup(cfg), DefaultSubscriptions())
+	if err := o.Start(context.Background(), candidateC); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		o.Stop(ctx)
+	})
+
+	waitFor(t, "geyser stream", func() bool { return g.Streams() == 1 && len(g.Requests()) == 1 })
+}
+
+// streamedTxUpdate returns successful transaction update mentioning Raydium program, with given logs.
+func streamedTxUpdate(sig solana.Signature, logs []string) *geyser.TransactionUpdate {
+	tx := &solana.Transaction{Signatures: []solana.Signature{sig}}
+	tx.Message.Header.NumRequiredSignatures = 1
+	tx.Message.AccountKeys = []solana.PublicKey{testKey(1), raydium.Raydium_Liquidity_Program_V4}
+
+	return &geyser.TransactionUpdate{
+		Slot:        100,
+		Signature:   sig,
+		Transaction: tx,
+		Meta:        &rpc.TransactionMeta{LogMessages: logs},
+	}
+}
+
+func TestGeyserObserverSubscribesPrograms(t *testing.T) {
+	g, err := fakerpc.NewGeyserServer("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(g.Close)
+
+	startGeyserObserver(t, g, "secret", make(chan TxCandidate, 8))
+
+	req := g.Requests()[0]
+	if req.Commitment == nil || *req.Commitment != geyser.CommitmentProcessed {
+		t.Fatalf("unexpected commitment: %v", req.Commitment)
+	}
+
+	for name, program := range map[string]string{ProgramOpenBook: openBookProgram, ProgramRaydium: raydiumProgram} {
+		filter, ok := req.Transactions[name]
+		if !ok || len(filter.AccountInclude) != 1 || filter.AccountInclude[0] != program {
+			t.Fatalf("unexpected filter of %s: %+v", name, filter)
+		}
+
+		if filter.Vote == nil || *filter.Vote || filter.Failed == nil || *filter.Failed {
+			t.Fatalf("expected filter of %s to exclude vote and failed transactions", name)
+		}
+	}
+}
+
+func TestGeyserObserverPublishesStreamedTx(t *testing.T) {
+	g, err := fakerpc.NewGeyserServer("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(g.Close)
+
+	candidateC := make(chan TxCandidate, 8)
+	startGeyserObserver(t, g, "secret", candidateC)
+
+	g.PublishTransaction(streamedTxUpdate(testSignature(1), raydiumLogs))
+	candidate := expectCandidate(t, candidateC)
+	if candidate.Signature != testSignature(1) || candidate.Metadata == nil || candidate.Tx == nil || candidate.Tx.Result.Meta == nil {
+		t.Fatalf("unexpected candidate: %+v", candidate)
+	}
+
+	// Transactions without candidates in logs are skipped.
+	g.PublishTransaction(streamedTxUpdate(testSignature(2), raydiumLogs[:1]))
+	expectNoCandidate(t, candidateC)
+}
+
+func TestGeyserObserverReconnects(t *testing.T) {
+	g, err := fakerpc.NewGeyserServer("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(g.Close)
+
+	candidateC := make(chan TxCandidate, 8)
+	startGeyserObserver(t, g, "", candidateC)
+
+	g.DropStreams()
+	waitFor(t, "geyser stream reopened", func() bool { return g.Streams() == 1 && len(g.Requests()) == 2 })
+
+	if len(g.Requests()[1].Transactions) != len(DefaultSubscriptions()) {
+		t.Fatalf("expected reopened stream to subscribe all programs: %+v", g.Requests()[1])
+	}
+
+	g.PublishTransaction(streamedTxUpdate(testSignature(1), raydiumLogs))
+	if candidate := expectCandidate(t, candidateC); candidate.Signature != testSignature(1) {
+		t.Fatalf("unexpected candidate: %+v", candidate)
+	}
+}
+
+func TestGeyserObserverSendsToken(t *testing.T) {
+	g, err := fakerpc.NewGeyserServer("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(g.Close)
+
+	cfg, poolCfg := testDefaults(t)
+	s := fakerpc.NewServer(fakerpc.Fixtures{})
+	t.Cleanup(s.Close)
+
+	nodes := map[string]config.RPCNode{
+		"node": {RPCEndpoint: s.RPCURL(), Geyser: g.Endpoint(), GeyserToken: "wrong", Observer: true},
+	}
+
+	pool, err := connection.NewRPCClientPool(nodes, poolCfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+
+	o := NewLogObserver(pool, "node", cfg, NewSignatureDedup(cfg), DefaultSubscriptions())
+	o.Start(context.Background(), make(chan TxCandidate, 8))
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		o.Stop(ctx)
+	}()
+
+	// Server rejects stream of wrong token before reading any request.
+	time.Sleep(200 * time.Millisecond)
+	if requests := len(g.Requests()); requests != 0 {
+		t.Fatalf("expected no request accepted with wrong token, got %d", requests)
+	}
+}
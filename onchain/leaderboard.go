@@ -0,0 +1,139 @@
+package onchain
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// LeaderboardEntry summarizes how well observer of single node does in signature races.
+type LeaderboardEntry struct {
+	Node       string
+	Seen       uint64
+	First      uint64
+	Late       uint64
+	Raced      uint64
+	Missed     uint64
+	FirstShare float64 // Fraction of all raced signatures node saw first.
+	MissRate   float64 // Fraction of settled races node missed.
+	AvgDelay   time.Duration
+	P50Delay   time.Duration
+	P90Delay   time.Duration
+	P99Delay   time.Duration
+	MaxDelay   time.Duration
+	Histogram  []uint64 // Seen signatures by delay behind the first observer; buckets are given by DelayBuckets.
+}
+
+// Leaderboard ranks nodes by share of signatures they saw first, then by their median delay.
+type Leaderboard struct {
+	Time       time.Time
+	Signatures uint64 // Number of raced signatures.
+	Buckets    []time.Duration
+	Entries    []LeaderboardEntry
+}
+
+func NewLeaderboard(stats map[string]FirstSeenStats) Leaderboard {
+	leaderboard := Leaderboard{
+		Time:    time.Now(),
+		Buckets: DelayBuckets,
+	}
+
+	for _, s := range stats {
+		leaderboard.Signatures += s.First
+	}
+
+	for node, s := range stats {
+		entry := LeaderboardEntry{
+			Node:      node,
+			Seen:      s.Seen,
+			First:     s.First,
+			Late:      s.Late,
+			Raced:     s.Raced,
+			Missed:    s.Missed,
+			AvgDelay:  s.AvgDelay(),
+			P50Delay:  s.Percentile(0.5),
+			P90Delay:  s.Percentile(0.9),
+			P99Delay:  s.Percentile(0.99),
+			MaxDelay:  s.MaxDelay,
+			Histogram: s.Histogram,
+		}
+
+		if leaderboard.Signatures > 0 {
+			entry.FirstShare = float64(s.First) / float64(leaderboard.Signatures)
+		}
+
+		if s.Raced > 0 {
+			entry.MissRate = float64(s.Missed) / float64(s.Raced)
+		}
+
+		leaderboard.Entries = append(leaderboard.Entries, entry)
+	}
+
+	sort.Slice(leaderboard.Entries, func(i, j int) bool {
+		a, b := leaderboard.Entries[i], leaderboard.Entries[j]
+		if a.First != b.First {
+			return a.First > b.First
+		}
+		if a.P50Delay != b.P50Delay {
+			return a.P50Delay < b.P50Delay
+		}
+		return a.Node < b.Node
+	})
+
+	return leaderboard
+}
+
+func (l Leaderboard) ExportJSON(path string) error {
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, 0644)
+}
+
+// ExportCSV writes leaderboard entries, one row per node, with one column per histogram bucket.
+func (l Leaderboard) ExportCSV(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+
+	header := []string{"rank", "node", "seen", "first", "late", "raced", "missed", "first_share", "miss_rate", "avg_delay", "p50_delay", "p90_delay", "p99_delay", "max_delay"}
+	for _, bucket := range l.Buckets {
+		header = append(header, "le_"+bucket.String())
+	}
+	w.Write(append(header, "gt_"+l.Buckets[len(l.Buckets)-1].String()))
+
+	formatUint := func(n uint64) string {
+		return strconv.FormatUint(n, 10)
+	}
+
+	formatFloat := func(f float64) string {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+
+	for i, e := range l.Entries {
+		row := []string{strconv.Itoa(i + 1), e.Node, formatUint(e.Seen), formatUint(e.First), formatUint(e.Late), formatUint(e.Raced), formatUint(e.Missed),
+			formatFloat(e.FirstShare), formatFloat(e.MissRate), e.AvgDelay.String(), e.P50Delay.String(), e.P90Delay.String(), e.P99Delay.String(), e.MaxDelay.String()}
+
+		for j := 0; j <= len(l.Buckets); j++ {
+			var n uint64
+			if j < len(e.Histogram) {
+				n = e.Histogram[j]
+			}
+			row = append(row, formatUint(n))
+		}
+
+		w.Write(row)
+	}
+
+	w.Flush()
+	return w.Error()
+}
@@ -4,7 +4,6 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -12,250 +11,480 @@ import (
 	"github.com/gagliardetto/solana-go"
 	"github.com/gagliardetto/solana-go/rpc"
 	"github.com/gagliardetto/solana-go/rpc/ws"
+	"github.com/gorilla/websocket"
+	"github.com/patrulek/rayscan/config"
 	"github.com/patrulek/rayscan/connection"
-	"github.com/patrulek/rayscan/onchain/raydium"
-	"github.com/patrulek/rayscan/onchain/serum"
 )
 
-type LogSet struct {
-	logs map[solana.Signature]struct{} // Tx signature -> empty struct
-	mu   sync.RWMutex
+// Attempts to get transaction of signature that wasn't delivered with its logs (eg. found by gap fill) before it's given up.
+const fetchAttempts = 3
+
+// LogRecorder receives every log message observed by LogObserver (eg. to replay it later).
+type LogRecorder interface {
+	RecordLog(connName, program string, log *ws.LogResult)
 }
 
-var logset *LogSet = &LogSet{
-	logs: make(map[solana.Signature]struct{}),
+// subscription is a running program subscription of observer.
+type subscription struct {
+	ProgramSubscription
+	stats subscriptionStats
+
+	mu            sync.Mutex
+	lastSignature solana.Signature // Last signature received; gap after reconnect is filled from it.
+}
+
+// logsFeed is a logsSubscribe subscription of single program on its own websocket connection. Raw connection is used,
+// so it's dialed with proxy and TLS settings of node, like transaction streams.
+type logsFeed struct {
+	observer *LogObserver
+	sub      *subscription
+	conn     *websocket.Conn
+
+	once  sync.Once
+	stopC chan struct{}
+}
+
+func (f *logsFeed) recv(txCandidatePublishC chan<- TxCandidate) (bool, error) {
+	var msg wsMessage
+	if err := f.conn.ReadJSON(&msg); err != nil {
+		return false, err
+	}
+
+	if msg.Method != "logsNotification" {
+		return false, nil // Not a notification.
+	}
+
+	var log ws.LogResult
+	if err := json.Unmarshal(msg.Params.Result, &log); err != nil {
+		fmt.Printf("[%v] LogObserver: Error decoding %s of %s program on %s: %v\n", time.Now().Format("2006-01-02 15:04:05.000"), msg.Method, f.sub.Name, f.observer.connName, err)
+		return true, nil
+	}
+
+	f.observer.handleLog(f.sub.Name, &log, nil, txCandidatePublishC)
+	return true, nil
+}
+
+func (f *logsFeed) close() {
+	f.once.Do(func() {
+		close(f.stopC)
+		f.conn.Close()
+	})
 }
 
 type LogObserver struct {
 	rpcPool *connection.RPCPool
+	cfg     config.Pipeline
+	dedup   *SignatureDedup
 
-	stopC chan struct{}
-	doneC []chan struct{}
+	subscriptions []*subscription
+	byName        map[string]*subscription
+	groups        []*feedGroup // Set by Start.
+
+	stopC      chan struct{}
+	doneC      []chan struct{}
+	background sync.WaitGroup // Gap fills, analyses and polled transaction fetches; Stop waits for them, so nothing is sent after observer stops.
 
 	running atomic.Bool
 
 	mu       sync.RWMutex
 	connName string
+	kind     SourceKind // Source of observed node, if empty; set by Start.
+	recorder LogRecorder
 }
 
-func NewLogObserver(rpcPool *connection.RPCPool, connName string) *LogObserver {
-	return &LogObserver{
+// NewLogObserver creates observer of logs of given programs from given connection; dedup should be shared by all observers.
+func NewLogObserver(rpcPool *connection.RPCPool, connName string, cfg config.Pipeline, dedup *SignatureDedup, programs []ProgramSubscription) *LogObserver {
+	o := &LogObserver{
 		rpcPool:  rpcPool,
+		cfg:      cfg,
+		dedup:    dedup,
+		byName:   make(map[string]*subscription),
 		stopC:    make(chan struct{}),
 		doneC:    make([]chan struct{}, 0),
 		running:  atomic.Bool{},
 		connName: connName,
 	}
+
+	for _, program := range programs {
+		if program.Commitment == "" {
+			program.Commitment = rpc.CommitmentType(cfg.LogsCommitment)
+		}
+
+		if program.Reconnect.Timeout <= 0 {
+			program.Reconnect.Timeout = cfg.SubscribeTimeout
+		}
+
+		if program.Reconnect.Delay <= 0 {
+			program.Reconnect.Delay = cfg.ResubscribeDelay
+		}
+
+		if program.Reconnect.MaxDelay <= 0 {
+			program.Reconnect.MaxDelay = max(cfg.ResubscribeMaxDelay, program.Reconnect.Delay)
+		}
+
+		if program.Reconnect.IdleTimeout == 0 {
+			program.Reconnect.IdleTimeout = cfg.SubscriptionIdleTimeout
+		}
+
+		sub := &subscription{ProgramSubscription: program}
+		o.subscriptions = append(o.subscriptions, sub)
+		o.byName[program.Name] = sub
+	}
+
+	return o
 }
 
 func (o *LogObserver) ConnectionName() string {
 	return o.connName
 }
 
-func (o *LogObserver) Start(ctx context.Context, txCandidatePublishC chan<- TxCandidate) error {
-	if !o.running.CompareAndSwap(false, true) {
-		return fmt.Errorf("LogObserver is already running")
-	}
+// Kind returns kind of source observer subscribes for; it's known after Start, unless it was set by NewNodeSource.
+func (o *LogObserver) Kind() SourceKind {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
 
-	openBookSubID, err := o.subscribeForOpenBookLogs(ctx)
-	if err != nil {
-		return err
-	}
+	return o.kind
+}
 
-	raydiumSubID, err := o.subscribeForRaydiumLogs(ctx)
-	if err != nil {
-		openBookSubID.Unsubscribe()
-		return err
+// DegradedSince returns time of the first failure of subscription that hasn't received anything since, or zero time
+// if all subscriptions work.
+func (o *LogObserver) DegradedSince() time.Time {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	var degraded time.Time
+	for _, group := range o.groups {
+		if since := group.degradedSince.Load(); since > 0 && (degraded.IsZero() || since < degraded.UnixNano()) {
+			degraded = time.Unix(0, since)
+		}
 	}
 
-	go o.consumeOpenBookLogs(openBookSubID, txCandidatePublishC)
-	go o.consumeRaydiumLogs(raydiumSubID, txCandidatePublishC)
+	return degraded
+}
 
-	return nil
+// SetRecorder sets recorder for all log messages received after this call. Should be called before Start.
+func (o *LogObserver) SetRecorder(recorder LogRecorder) {
+	o.recorder = recorder
 }
 
-func (o *LogObserver) subscribeForOpenBookLogs(ctx context.Context) (*ws.LogSubscription, error) {
-	fmt.Printf("[%v] LogObserver: Subscribe for OpenBook program logs on %s...\n", time.Now().Format("2006-01-02 15:04:05.000"), o.connName)
-	conn := o.rpcPool.NamedConnection(o.connName)
-	wsClient, err := ws.Connect(ctx, conn.ConnectionInfo.WSEndpoint)
-	if err != nil {
-		return nil, err
+// Stats returns stats of every program subscription by its name.
+func (o *LogObserver) Stats() map[string]SubscriptionStats {
+	stats := make(map[string]SubscriptionStats, len(o.subscriptions))
+	for _, sub := range o.subscriptions {
+		stats[sub.Name] = sub.stats.snapshot()
 	}
 
-	return wsClient.LogsSubscribeMentions(serum.OpenBookDex, rpc.CommitmentProcessed)
+	return stats
 }
 
-func (o *LogObserver) consumeOpenBookLogs(openBookSubID *ws.LogSubscription, txCandidatePublishC chan<- TxCandidate) {
-	o.mu.Lock()
-	doneCIdx := len(o.doneC)
-	o.doneC = append(o.doneC, make(chan struct{}))
-	o.mu.Unlock()
+// HandleLog analyzes single log message of given program and publishes found tx candidate before returning,
+// so logs fed one by one (eg. recorded ones) produce candidates in the same order.
+func (o *LogObserver) HandleLog(program string, log *ws.LogResult, txCandidatePublishC chan<- TxCandidate) {
+	if sub, ok := o.claimLog(program, log); ok {
+		o.analyzeLogs(sub, log, nil, txCandidatePublishC)
+	}
+}
 
-	defer close(o.doneC[doneCIdx])
+// handleLog analyzes log message of given program in background, so subscription isn't blocked by full channel;
+// streamed transaction, if given, is passed with found candidate.
+func (o *LogObserver) handleLog(program string, log *ws.LogResult, streamed *StreamedTx, txCandidatePublishC chan<- TxCandidate) {
+	if sub, ok := o.claimLog(program, log); ok {
+		o.background.Add(1)
+		go func() {
+			defer o.background.Done()
+			o.analyzeLogs(sub, log, streamed, txCandidatePublishC)
+		}()
+	}
+}
 
-	for o.running.Load() {
-		log, err := openBookSubID.Recv()
-		if err != nil {
-			o.reconnectOpenBookSubscription(openBookSubID, err)
-			continue
-		}
+// claimLog records log message of given program and updates its subscription stats; subscription is returned
+// if the message should be analyzed, ie. it's of successful transaction no other observer has claimed yet.
+func (o *LogObserver) claimLog(program string, log *ws.LogResult) (*subscription, bool) {
+	if o.recorder != nil {
+		o.recorder.RecordLog(o.connName, program, log)
+	}
 
-		if log.Value.Logs == nil || log.Value.Err != nil {
-			continue // Skip this message.
-		}
+	sub, ok := o.byName[program]
+	if !ok {
+		return nil, false // Not observed program.
+	}
 
-		logset.mu.RLock()
-		_, ok := logset.logs[log.Value.Signature]
-		logset.mu.RUnlock()
+	sub.stats.received.Add(1)
+	sub.stats.lastMessage.Store(time.Now().UnixNano())
 
-		if ok {
-			continue // Already processed.
-		}
+	sub.mu.Lock()
+	sub.lastSignature = log.Value.Signature
+	sub.mu.Unlock()
 
-		go o.analyzeOpenBookLogs(log, txCandidatePublishC)
+	if log.Value.Logs == nil || log.Value.Err != nil {
+		return nil, false // Skip this message.
 	}
+
+	if !o.dedup.Claim(sub.ProgramID, log.Value.Signature, o.connName, time.Now()) {
+		return nil, false // Already processed.
+	}
+
+	return sub, true
 }
 
-func (o *LogObserver) reconnectOpenBookSubscription(subID *ws.LogSubscription, reason error) {
-	fmt.Printf("[%v] LogObserver: Reconnecting subscription for OpenBook program logs on %s due to: %v...\n", time.Now().Format("2006-01-02 15:04:05.000"), o.connName, reason)
-	subID.Unsubscribe()
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
-	defer cancel()
+// handleStreamedTx analyzes logs of streamed transaction as log message of every given program;
+// found candidate carries the transaction, so it isn't fetched again.
+func (o *LogObserver) handleStreamedTx(programs []string, tx *StreamedTx, txCandidatePublishC chan<- TxCandidate) {
+	if len(tx.Transaction.Signatures) == 0 {
+		return
+	}
 
-	openBookSubID, err := o.subscribeForOpenBookLogs(ctx)
-	for err != nil {
-		fmt.Printf("[%v] LogObserver: Error reconnecting subscription for OpenBook program logs on %s: %v; trying again...\n", time.Now().Format("2006-01-02 15:04:05.000"), o.connName, err)
-		time.Sleep(5 * time.Second)
-		ctx, cancel = context.WithTimeout(context.Background(), 15*time.Second)
-		openBookSubID, err = o.subscribeForOpenBookLogs(ctx)
-		cancel()
+	log := streamedLog(tx)
+	for _, program := range programs {
+		o.handleLog(program, log, tx, txCandidatePublishC)
 	}
+}
+
+// streamedLog returns log message of given transaction, as sent by logsSubscribe.
+func streamedLog(tx *StreamedTx) *ws.LogResult {
+	log := &ws.LogResult{}
+	log.Context.Slot = tx.Result.Slot
+	log.Value.Signature = tx.Transaction.Signatures[0]
+	log.Value.Err = tx.Result.Meta.Err
+	log.Value.Logs = tx.Result.Meta.LogMessages
 
-	*subID = *openBookSubID
+	return log
 }
 
-func (o *LogObserver) analyzeOpenBookLogs(log *ws.LogResult, txCandidatePublishC chan<- TxCandidate) {
-	// Find possible InitMarket instruction logs:
-	for i := range log.Value.Logs {
-		curLog := log.Value.Logs[i]
-		if !strings.Contains(curLog, "Program 11111111111111111111111111111111 success") {
-			continue // Search further.
-		}
+// Start subscribes for messages of observed programs using its source, or source of observed node (see config.RPCNode.Source).
+func (o *LogObserver) Start(ctx context.Context, txCandidatePublishC chan<- TxCandidate) error {
+	if !o.running.CompareAndSwap(false, true) {
+		return fmt.Errorf("LogObserver is already running")
+	}
 
-		if i+1 >= len(log.Value.Logs) {
-			break // No more logs.
-		}
+	conn, err := o.rpcPool.NamedConnection(o.connName)
+	if err != nil {
+		return err
+	}
+
+	o.mu.Lock()
+	if o.kind == "" {
+		o.kind = SourceKind(conn.ConnectionInfo.ObserverSource())
+	}
 
-		nextLog := log.Value.Logs[i+1]
-		if !strings.Contains(nextLog, "Program srmqPvymJeFKQ4zGQed1GFppgkRHL9kaELCbyksJtPX invoke [1]") {
-			continue // Search further.
+	groups := o.feedGroups(o.kind)
+	o.groups = groups
+	o.mu.Unlock()
+
+	feeds := make([]feed, 0, len(groups))
+	for _, group := range groups {
+		f, err := o.openFeed(ctx, group)
+		if err != nil {
+			for _, group := range groups {
+				o.closeFeed(group, nil)
+			}
+			return err
 		}
 
-		// Found it: send signature with no metadata
-		txCandidate := TxCandidate{log.Value.Signature, o.connName, nil}
-		txCandidatePublishC <- txCandidate
-		break
+		feeds = append(feeds, f)
 	}
 
-	logset.mu.Lock()
-	logset.logs[log.Value.Signature] = struct{}{}
-	logset.mu.Unlock()
+	o.dedup.Register(o.connName)
+
+	for i, group := range groups {
+		doneC := make(chan struct{})
+		o.mu.Lock()
+		o.doneC = append(o.doneC, doneC)
+		o.mu.Unlock()
+
+		go o.consumeFeed(group, feeds[i], doneC, txCandidatePublishC)
+	}
+
+	return nil
 }
 
-func (o *LogObserver) subscribeForRaydiumLogs(ctx context.Context) (*ws.LogSubscription, error) {
-	fmt.Printf("[%v] LogObserver: Subscribe for Raydium Liquidity program logs on %s...\n", time.Now().Format("2006-01-02 15:04:05.000"), o.connName)
-	conn := o.rpcPool.NamedConnection(o.connName)
-	wsClient, err := ws.Connect(ctx, conn.ConnectionInfo.WSEndpoint)
+// openLogs subscribes for logs of given program on new websocket connection.
+func (o *LogObserver) openLogs(ctx context.Context, conn *connection.Connection, sub *subscription) (feed, error) {
+	wsConn, err := conn.DialWSConn(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	return wsClient.LogsSubscribeMentions(raydium.Raydium_Liquidity_Program_V4, rpc.CommitmentProcessed)
+	params := []interface{}{map[string]interface{}{"mentions": []solana.PublicKey{sub.ProgramID}}, map[string]interface{}{"commitment": sub.Commitment}}
+	if err := subscribeWS(ctx, wsConn, "logsSubscribe", params); err != nil {
+		wsConn.Close()
+		return nil, err
+	}
+
+	f := &logsFeed{observer: o, sub: sub, conn: wsConn, stopC: make(chan struct{})}
+	go keepAlive(wsConn, f.stopC)
+
+	return f, nil
 }
 
-func (o *LogObserver) consumeRaydiumLogs(raydiumSubID *ws.LogSubscription, txCandidatePublishC chan<- TxCandidate) {
-	o.mu.Lock()
-	doneCIdx := len(o.doneC)
-	o.doneC = append(o.doneC, make(chan struct{}))
-	o.mu.Unlock()
+// fillGap analyzes logs of program transactions newer than given signature that no observer has seen,
+// so candidates sent while subscription was broken aren't missed.
+func (o *LogObserver) fillGap(sub *subscription, until solana.Signature, txCandidatePublishC chan<- TxCandidate) {
+	if until.IsZero() || o.cfg.GapFillLimit == 0 {
+		return // Nothing received yet or disabled.
+	}
+
+	ctx, cancel := o.stopContext(o.cfg.GapFillTimeout)
+	defer cancel()
+
+	backfillClient := func() (*rpc.Client, error) {
+		return o.rpcPool.RoleClientForMethod(ctx, connection.RoleBackfill, "getSignaturesForAddress")
+	}
+
+	signatures, err := o.programSignatures(ctx, backfillClient, sub.ProgramID, until, o.cfg.GapFillLimit)
+	if err != nil {
+		fmt.Printf("[%v] LogObserver: Error filling gap of %s program logs on %s: %v\n", time.Now().Format("2006-01-02 15:04:05.000"), sub.Name, o.connName, err)
+		return
+	}
 
-	defer close(o.doneC[doneCIdx])
+	txFetchClient := func() (*rpc.Client, error) {
+		return o.rpcPool.RoleClientForMethod(ctx, connection.RoleTxFetch, "getTransaction")
+	}
+
+	missed, found := 0, 0
+	for i := len(signatures) - 1; i >= 0 && o.running.Load(); i-- { // Oldest first.
+		signature := signatures[i]
+		if signature.Err != nil || !o.dedup.Backfill(sub.ProgramID, signature.Signature) {
+			continue // Failed or already seen.
+		}
 
-	for o.running.Load() {
-		log, err := raydiumSubID.Recv()
+		missed++
+		tx, err := o.fetchTransaction(ctx, signature.Signature, txFetchClient)
 		if err != nil {
-			o.reconnecRaydiumSubscription(raydiumSubID, err)
+			o.dedup.Release(sub.ProgramID, signature.Signature) // Left for other observers and next gap fills.
+			fmt.Printf("[%v] LogObserver: Error getting transaction while filling gap of %s program logs on %s (tx: %s): %v\n", time.Now().Format("2006-01-02 15:04:05.000"), sub.Name, o.connName, signature.Signature, err)
 			continue
 		}
 
-		if log.Value.Logs == nil || log.Value.Err != nil {
-			continue // Skip this message.
+		metadata, ok := sub.candidate(tx.Meta.LogMessages)
+		if !ok {
+			continue
 		}
 
-		logset.mu.RLock()
-		_, ok := logset.logs[log.Value.Signature]
-		logset.mu.RUnlock()
+		found++
+		sub.stats.candidates.Add(1)
+		sub.stats.gapFilled.Add(1)
 
-		if ok {
-			continue // Already processed.
+		select {
+		case <-o.stopC:
+			return
+		case txCandidatePublishC <- TxCandidate{signature.Signature, o.connName, metadata, nil}:
 		}
-
-		go o.analyzeRaydiumLogs(log, txCandidatePublishC)
 	}
+
+	fmt.Printf("[%v] LogObserver: Filled gap of %s program logs on %s (signatures: %d, missed: %d, candidates: %d)\n", time.Now().Format("2006-01-02 15:04:05.000"), sub.Name, o.connName, len(signatures), missed, found)
 }
 
-func (o *LogObserver) reconnecRaydiumSubscription(subID *ws.LogSubscription, reason error) {
-	fmt.Printf("[%v] LogObserver: Reconnecting subscription for Raydium program logs on %s due to: %v...\n", time.Now().Format("2006-01-02 15:04:05.000"), o.connName, reason)
-	subID.Unsubscribe()
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
-	defer cancel()
+// fetchTransaction gets transaction of given signature from clients returned by given functions in turn. Failed attempt
+// is retried with exponential backoff until fetchAttempts run out, error is permanent, ctx is done or observer stops.
+func (o *LogObserver) fetchTransaction(ctx context.Context, signature solana.Signature, clients ...func() (*rpc.Client, error)) (*rpc.GetTransactionResult, error) {
+	opts := &rpc.GetTransactionOpts{
+		MaxSupportedTransactionVersion: &o.cfg.MaxTransactionVersion,
+		Commitment:                     rpc.CommitmentType(o.cfg.TxCommitment),
+	}
 
-	raydiumSubID, err := o.subscribeForRaydiumLogs(ctx)
-	if err != nil {
-		fmt.Printf("[%v] LogObserver: Error reconnecting subscription for Raydium program logs on %s: %v; trying again...\n", time.Now().Format("2006-01-02 15:04:05.000"), o.connName, err)
-		time.Sleep(5 * time.Second)
-		ctx, cancel = context.WithTimeout(context.Background(), 15*time.Second)
-		raydiumSubID, err = o.subscribeForRaydiumLogs(ctx)
-		cancel()
+	delay := o.cfg.NotFoundRetryDelay
+	for attempt := 1; ; attempt++ {
+		var err error
+		for _, client := range clients {
+			var c *rpc.Client
+			if c, err = client(); err != nil {
+				continue
+			}
+
+			rctx, rcancel := context.WithTimeout(ctx, o.cfg.GetTransactionTimeout)
+			tx, txErr := c.GetTransaction(rctx, signature, opts)
+			rcancel()
+
+			if txErr == nil && tx.Meta != nil {
+				return tx, nil
+			}
+
+			if err = txErr; err == nil {
+				err = fmt.Errorf("transaction has no meta")
+			}
+
+			if connection.IsPermanentError(err) {
+				return nil, err
+			}
+		}
+
+		if attempt >= fetchAttempts {
+			return nil, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-o.stopC:
+			return nil, err
+		case <-time.After(delay):
+		}
+
+		delay = min(delay*2, maxErrorRetryDelay)
 	}
+}
 
-	*subID = *raydiumSubID
+// stopContext returns context canceled after given timeout or when observer stops.
+func (o *LogObserver) stopContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	go func() {
+		select {
+		case <-o.stopC:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, cancel
 }
 
-func (o *LogObserver) analyzeRaydiumLogs(log *ws.LogResult, txCandidatePublishC chan<- TxCandidate) {
-	// Raw input data; bytes[2:6] -> possible timestamp for ido openning; bytes[7:15] -> possible pc amount, last 8 bytes, possible coin amount
-	// Find possible Purchase IDO instruction logs:
-	for i := range log.Value.Logs {
-		curLog := log.Value.Logs[i]
+// programSignatures returns up to limit signatures of transactions of given program newer than given one, newest first.
+// Signatures are paged with before cursor; client is asked for every page.
+func (o *LogObserver) programSignatures(ctx context.Context, client func() (*rpc.Client, error), program solana.PublicKey, until solana.Signature, limit int) ([]*rpc.TransactionSignature, error) {
+	var signatures []*rpc.TransactionSignature
+	var before solana.Signature
 
-		// Parse IDO info from log
-		_, after, found := strings.Cut(curLog, " InitializeInstruction2 ")
-		if !found {
-			continue // Search further, not IDO log.
+	for len(signatures) < limit {
+		c, err := client()
+		if err != nil {
+			return nil, err
 		}
 
-		// Add quotes to keys.
-		splitted := strings.Split(after, " ")
-		for i, s := range splitted {
-			if strings.Contains(s, ":") {
-				splitted[i] = "\"" + s[:len(s)-1] + "\":"
-			}
+		pageLimit := min(limit-len(signatures), 1000)
+		page, err := c.GetSignaturesForAddressWithOpts(ctx, program, &rpc.GetSignaturesForAddressOpts{
+			Limit:      &pageLimit,
+			Before:     before,
+			Until:      until,
+			Commitment: rpc.CommitmentType(o.cfg.TxCommitment),
+		})
+		if err != nil {
+			return nil, err
 		}
 
-		metadata := json.RawMessage(strings.Join(splitted, " "))
-		if !json.Valid(metadata) {
-			continue // Search further, invalid JSON.
+		signatures = append(signatures, page...)
+		if len(page) < pageLimit {
+			break // Reached until signature.
 		}
 
-		// Found it: send signature with metadata
-		txCandidate := TxCandidate{log.Value.Signature, o.connName, &metadata}
-		txCandidatePublishC <- txCandidate
-		break
+		before = page[len(page)-1].Signature
+	}
+
+	return signatures, nil
+}
+
+func (o *LogObserver) analyzeLogs(sub *subscription, log *ws.LogResult, streamed *StreamedTx, txCandidatePublishC chan<- TxCandidate) {
+	metadata, ok := sub.candidate(log.Value.Logs)
+	if !ok {
+		return
 	}
 
-	logset.mu.Lock()
-	logset.logs[log.Value.Signature] = struct{}{}
-	logset.mu.Unlock()
+	// Found it: send signature with metadata, if any.
+	sub.stats.candidates.Add(1)
+	select {
+	case <-o.stopC:
+	case txCandidatePublishC <- TxCandidate{log.Value.Signature, o.connName, metadata, streamed}:
+	}
 }
 
 func (o *LogObserver) Stop(ctx context.Context) error {
@@ -264,17 +493,40 @@ func (o *LogObserver) Stop(ctx context.Context) error {
 	}
 
 	close(o.stopC)
+	o.dedup.Unregister(o.connName)
+
+	o.mu.Lock()
+	for _, group := range o.groups {
+		o.closeFeed(group, nil)
+	}
+	doneC := o.doneC
+	o.mu.Unlock()
+
 	doneCount := 0
 
-	for doneCount < len(o.doneC) {
+	for doneCount < len(doneC) {
 		select {
 		case <-ctx.Done():
 			fmt.Printf("Err: LogObserver: forced shutdown\n")
 			return ctx.Err()
-		case <-o.doneC[doneCount]:
+		case <-doneC[doneCount]:
 			doneCount++
 		}
 	}
 
+	// Feeds are done, so no more background work is started.
+	backgroundC := make(chan struct{})
+	go func() {
+		o.background.Wait()
+		close(backgroundC)
+	}()
+
+	select {
+	case <-ctx.Done():
+		fmt.Printf("Err: LogObserver: forced shutdown\n")
+		return ctx.Err()
+	case <-backgroundC:
+	}
+
 	return nil
 }
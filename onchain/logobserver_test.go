@@ -0,0 +1,356 @@
+package onchain
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/gagliardetto/solana-go/rpc/jsonrpc"
+	"github.com/patrulek/rayscan/config"
+	"github.com/patrulek/rayscan/connection"
+	"github.com/patrulek/rayscan/fakerpc"
+	"github.com/patrulek/rayscan/onchain/raydium"
+	"github.com/patrulek/rayscan/onchain/serum"
+	"github.com/pelletier/go-toml"
+)
+
+var (
+	openBookProgram = serum.OpenBookDex.String()
+	raydiumProgram  = raydium.Raydium_Liquidity_Program_V4.String()
+
+	openBookLogs = []string{
+		"Program 11111111111111111111111111111111 invoke [1]",
+		"Program 11111111111111111111111111111111 success",
+		"Program srmqPvymJeFKQ4zGQed1GFppgkRHL9kaELCbyksJtPX invoke [1]",
+		"Program srmqPvymJeFKQ4zGQed1GFppgkRHL9kaELCbyksJtPX success",
+	}
+	raydiumLogs = []string{
+		"Program 675kPX9MHTjS2zt1qfr1NYHuzeLXfQM9H24wFSUt1Mp8 invoke [1]",
+		"Program log: initialize2: InitializeInstruction2 { nonce: 254, open_time: 1700000000, init_pc_amount: 100, init_coin_amount: 200 }",
+		"Program 675kPX9MHTjS2zt1qfr1NYHuzeLXfQM9H24wFSUt1Mp8 success",
+	}
+)
+
+// testDefaults returns pipeline and pool configs with default values; pool doesn't check health in background
+// and observers reconnect at once.
+func testDefaults(t *testing.T) (config.Pipeline, config.Pool) {
+	t.Helper()
+
+	var pipeline config.Pipeline
+	var pool config.Pool
+	if err := toml.Unmarshal(nil, &pipeline); err != nil {
+		t.Fatal(err)
+	}
+	if err := toml.Unmarshal(nil, &pool); err != nil {
+		t.Fatal(err)
+	}
+
+	pipeline.ResubscribeDelay = 10 * time.Millisecond
+	pool.HealthInterval = 0
+	return pipeline, pool
+}
+
+// newFakePool starts fake observer node for every given name and returns pool of them.
+func newFakePool(t *testing.T, poolCfg config.Pool, names ...string) (*connection.RPCPool, map[string]*fakerpc.Server) {
+	t.Helper()
+
+	servers := make(map[string]*fakerpc.Server)
+	nodes := make(map[string]config.RPCNode)
+	for _, name := range names {
+		s := fakerpc.NewServer(fakerpc.Fixtures{})
+		t.Cleanup(s.Close)
+
+		servers[name] = s
+		nodes[name] = config.RPCNode{RPCEndpoint: s.RPCURL(), WSEndpoint: s.WSURL(), Observer: true}
+	}
+
+	pool, err := connection.NewRPCClientPool(nodes, poolCfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+
+	return pool, servers
+}
+
+// startObserver starts observer of default programs on given node and waits until it's subscribed; it's stopped with the test.
+func startObserver(t *testing.T, pool *connection.RPCPool, s *fakerpc.Server, name string, cfg config.Pipeline, dedup *SignatureDedup, candidateC chan<- TxCandidate) *LogObserver {
+	t.Helper()
+
+	o := NewLogObserver(pool, name, cfg, dedup, DefaultSubscriptions())
+	if err := o.Start(context.Background(), candidateC); err != nil {
+		t.Fatal(err)
+	}
+
+	waitSubscribed(t, s)
+
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		o.Stop(ctx)
+	})
+
+	return o
+}
+
+// logResult returns logsSubscribe notification of transaction with given signature and logs.
+func logResult(sig solana.Signature, err interface{}, logs []string) map[string]interface{} {
+	return map[string]interface{}{
+		"context": map[string]interface{}{"slot": 100},
+		"value":   map[string]interface{}{"signature": sig.String(), "err": err, "logs": logs},
+	}
+}
+
+// txResult returns getTransaction result of transaction with given signature and logs.
+func txResult(t *testing.T, sig solana.Signature, logs []string) map[string]interface{} {
+	t.Helper()
+
+	tx := solana.Transaction{Signatures: []solana.Signature{sig}}
+	tx.Message.Header.NumRequiredSignatures = 1
+	tx.Message.AccountKeys = []solana.PublicKey{testKey(1)}
+
+	data, err := tx.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return map[string]interface{}{
+		"slot":        100,
+		"blockTime":   time.Now().Unix(),
+		"transaction": []string{base64.StdEncoding.EncodeToString(data), "base64"},
+		"meta":        map[string]interface{}{"err": nil, "logMessages": logs},
+	}
+}
+
+func expectCandidate(t *testing.T, candidateC <-chan TxCandidate) TxCandidate {
+	t.Helper()
+
+	select {
+	case candidate := <-candidateC:
+		return candidate
+	case <-time.After(2 * time.Second):
+		t.Fatalf("expected tx candidate")
+		return TxCandidate{}
+	}
+}
+
+func expectNoCandidate(t *testing.T, candidateC <-chan TxCandidate) {
+	t.Helper()
+
+	select {
+	case candidate := <-candidateC:
+		t.Fatalf("unexpected tx candidate: %s", candidate.Signature)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+// waitSubscribed waits until observer of default programs is subscribed on given server.
+func waitSubscribed(t *testing.T, s *fakerpc.Server) {
+	t.Helper()
+
+	waitFor(t, "subscriptions", func() bool { return s.Subscriptions("logsSubscribe") == len(DefaultSubscriptions()) })
+}
+
+// waitFor polls condition until it's met or the test times out.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestLogObserverPublishesCandidates(t *testing.T) {
+	cfg, poolCfg := testDefaults(t)
+	pool, servers := newFakePool(t, poolCfg, "node")
+	candidateC := make(chan TxCandidate, 8)
+	o := startObserver(t, pool, servers["node"], "node", cfg, NewSignatureDedup(cfg), candidateC)
+
+	servers["node"].PublishLog(openBookProgram, logResult(testSignature(1), nil, openBookLogs))
+	market := expectCandidate(t, candidateC)
+	if market.Signature != testSignature(1) || market.clientName != "node" || market.Metadata != nil {
+		t.Fatalf("unexpected market candidate: %+v", market)
+	}
+
+	servers["node"].PublishLog(raydiumProgram, logResult(testSignature(2), nil, raydiumLogs))
+	amm := expectCandidate(t, candidateC)
+	if amm.Signature != testSignature(2) || amm.Metadata == nil {
+		t.Fatalf("unexpected amm candidate: %+v", amm)
+	}
+
+	// Failed transactions and logs without candidates are skipped.
+	servers["node"].PublishLog(raydiumProgram, logResult(testSignature(3), map[string]interface{}{"InstructionError": []interface{}{0, "Custom"}}, raydiumLogs))
+	servers["node"].PublishLog(openBookProgram, logResult(testSignature(4), nil, openBookLogs[:2]))
+	expectNoCandidate(t, candidateC)
+
+	stats := o.Stats()
+	if stats[ProgramOpenBook].Received != 2 || stats[ProgramOpenBook].Candidates != 1 || stats[ProgramRaydium].Received != 2 || stats[ProgramRaydium].Candidates != 1 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestLogObserversDeduplicateSignatures(t *testing.T) {
+	cfg, poolCfg := testDefaults(t)
+	pool, servers := newFakePool(t, poolCfg, "a", "b")
+	dedup := NewSignatureDedup(cfg)
+	candidateC := make(chan TxCandidate, 8)
+	startObserver(t, pool, servers["a"], "a", cfg, dedup, candidateC)
+	startObserver(t, pool, servers["b"], "b", cfg, dedup, candidateC)
+
+	servers["b"].PublishLog(openBookProgram, logResult(testSignature(1), nil, openBookLogs))
+	if candidate := expectCandidate(t, candidateC); candidate.clientName != "b" {
+		t.Fatalf("expected candidate of the first observer, got %s", candidate.clientName)
+	}
+
+	servers["a"].PublishLog(openBookProgram, logResult(testSignature(1), nil, openBookLogs))
+	expectNoCandidate(t, candidateC)
+}
+
+func TestLogObserverFillsGapAfterReconnect(t *testing.T) {
+	cfg, poolCfg := testDefaults(t)
+	pool, servers := newFakePool(t, poolCfg, "node")
+	s := servers["node"]
+	candidateC := make(chan TxCandidate, 8)
+	o := startObserver(t, pool, servers["node"], "node", cfg, NewSignatureDedup(cfg), candidateC)
+
+	s.AddSignature(openBookProgram, map[string]interface{}{"signature": testSignature(1).String(), "slot": 100})
+	s.PublishLog(openBookProgram, logResult(testSignature(1), nil, openBookLogs))
+	expectCandidate(t, candidateC)
+
+	// Transaction sent while subscription is broken is found by gap fill.
+	s.DropSockets()
+	s.AddSignature(openBookProgram, map[string]interface{}{"signature": testSignature(2).String(), "slot": 101})
+	s.SetTransaction(testSignature(2).String(), txResult(t, testSignature(2), openBookLogs))
+
+	if candidate := expectCandidate(t, candidateC); candidate.Signature != testSignature(2) {
+		t.Fatalf("expected missed candidate, got %s", candidate.Signature)
+	}
+
+	waitSubscribed(t, s)
+
+	s.PublishLog(openBookProgram, logResult(testSignature(3), nil, openBookLogs))
+	if candidate := expectCandidate(t, candidateC); candidate.Signature != testSignature(3) {
+		t.Fatalf("expected candidate after reconnect, got %s", candidate.Signature)
+	}
+
+	if stats := o.Stats()[ProgramOpenBook]; stats.Reconnects != 1 || stats.GapFilled != 1 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
+
+// Raydium pool initialization mentions OpenBook too; OpenBook subscription receiving it first mustn't hide the pool.
+func TestLogObserverClaimsSignaturePerProgram(t *testing.T) {
+	cfg, poolCfg := testDefaults(t)
+	pool, servers := newFakePool(t, poolCfg, "a", "b")
+	dedup := NewSignatureDedup(cfg)
+	candidateC := make(chan TxCandidate, 8)
+	startObserver(t, pool, servers["a"], "a", cfg, dedup, candidateC)
+	startObserver(t, pool, servers["b"], "b", cfg, dedup, candidateC)
+
+	servers["a"].PublishLog(openBookProgram, logResult(testSignature(1), nil, raydiumLogs))
+	expectNoCandidate(t, candidateC)
+
+	servers["b"].PublishLog(raydiumProgram, logResult(testSignature(1), nil, raydiumLogs))
+	if candidate := expectCandidate(t, candidateC); candidate.Metadata == nil || candidate.clientName != "b" {
+		t.Fatalf("expected amm candidate of b, got %+v", candidate)
+	}
+}
+
+func TestStreamedTxClaimedPerProgram(t *testing.T) {
+	cfg, poolCfg := testDefaults(t)
+	pool, _ := newFakePool(t, poolCfg, "node")
+	o := NewLogObserver(pool, "node", cfg, NewSignatureDedup(cfg), DefaultSubscriptions())
+	candidateC := make(chan TxCandidate, 8)
+
+	tx := &StreamedTx{
+		Result:      &rpc.GetTransactionResult{Slot: 100, Meta: &rpc.TransactionMeta{LogMessages: raydiumLogs}},
+		Transaction: &solana.Transaction{Signatures: []solana.Signature{testSignature(1)}},
+	}
+	o.handleStreamedTx([]string{ProgramOpenBook, ProgramRaydium}, tx, candidateC)
+
+	if candidate := expectCandidate(t, candidateC); candidate.Metadata == nil || candidate.Tx != tx {
+		t.Fatalf("expected amm candidate with streamed tx, got %+v", candidate)
+	}
+}
+
+func TestGapFillClaimsSignaturePerProgram(t *testing.T) {
+	cfg, poolCfg := testDefaults(t)
+	pool, servers := newFakePool(t, poolCfg, "node")
+	s := servers["node"]
+	candidateC := make(chan TxCandidate, 8)
+	o := startObserver(t, pool, s, "node", cfg, NewSignatureDedup(cfg), candidateC)
+
+	for _, program := range []string{openBookProgram, raydiumProgram} {
+		s.AddSignature(program, map[string]interface{}{"signature": testSignature(1).String(), "slot": 100})
+		s.AddSignature(program, map[string]interface{}{"signature": testSignature(2).String(), "slot": 101})
+	}
+	s.SetTransaction(testSignature(2).String(), txResult(t, testSignature(2), raydiumLogs))
+
+	o.fillGap(o.byName[ProgramOpenBook], testSignature(1), candidateC)
+	o.fillGap(o.byName[ProgramRaydium], testSignature(1), candidateC)
+
+	if candidate := expectCandidate(t, candidateC); candidate.Signature != testSignature(2) || candidate.Metadata == nil {
+		t.Fatalf("expected gap filled amm candidate, got %+v", candidate)
+	}
+}
+
+func TestGapFillRetriesUnfetchedSignature(t *testing.T) {
+	cfg, poolCfg := testDefaults(t)
+	cfg.NotFoundRetryDelay = time.Millisecond
+	pool, servers := newFakePool(t, poolCfg, "node")
+	s := servers["node"]
+	candidateC := make(chan TxCandidate, 8)
+	o := startObserver(t, pool, s, "node", cfg, NewSignatureDedup(cfg), candidateC)
+
+	s.AddSignature(openBookProgram, map[string]interface{}{"signature": testSignature(1).String(), "slot": 100})
+	s.AddSignature(openBookProgram, map[string]interface{}{"signature": testSignature(2).String(), "slot": 101})
+	s.SetTransaction(testSignature(2).String(), txResult(t, testSignature(2), openBookLogs))
+	s.InjectFault("getTransaction", fakerpc.Fault{RPCError: &jsonrpc.RPCError{Code: -32603, Message: "internal error"}, Times: fetchAttempts + 1})
+
+	// Failed attempt is retried.
+	o.fillGap(o.byName[ProgramOpenBook], testSignature(1), candidateC)
+	expectNoCandidate(t, candidateC)
+	if err := s.AssertCalled("getTransaction", fetchAttempts); err != nil {
+		t.Fatal(err)
+	}
+
+	// Signature isn't lost after all attempts fail.
+	o.fillGap(o.byName[ProgramOpenBook], testSignature(1), candidateC)
+	if candidate := expectCandidate(t, candidateC); candidate.Signature != testSignature(2) {
+		t.Fatalf("expected gap filled candidate, got %s", candidate.Signature)
+	}
+}
+
+func TestLogObserverStopsGapFill(t *testing.T) {
+	cfg, poolCfg := testDefaults(t)
+	pool, servers := newFakePool(t, poolCfg, "node")
+	s := servers["node"]
+	candidateC := make(chan TxCandidate) // Nobody receives.
+	o := startObserver(t, pool, s, "node", cfg, NewSignatureDedup(cfg), candidateC)
+
+	s.AddSignature(openBookProgram, map[string]interface{}{"signature": testSignature(1).String(), "slot": 100})
+	s.AddSignature(openBookProgram, map[string]interface{}{"signature": testSignature(2).String(), "slot": 101})
+	s.SetTransaction(testSignature(2).String(), txResult(t, testSignature(2), openBookLogs))
+
+	s.PublishLog(openBookProgram, logResult(testSignature(1), nil, nil))
+	waitFor(t, "first signature", func() bool { return o.Stats()[ProgramOpenBook].Received == 1 })
+	s.DropSockets()
+	waitFor(t, "gap fill", func() bool { return s.AssertCalled("getTransaction", 1) == nil })
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := o.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	close(candidateC) // Gap fill mustn't send anything now.
+	time.Sleep(50 * time.Millisecond)
+}
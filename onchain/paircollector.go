@@ -3,9 +3,12 @@ package onchain
 import (
 	"context"
 	"fmt"
+	"sync/atomic"
 	"time"
 
 	"github.com/gagliardetto/solana-go"
+	"github.com/patrulek/rayscan/cache"
+	"github.com/patrulek/rayscan/config"
 	"github.com/patrulek/rayscan/onchain/raydium"
 	"github.com/patrulek/rayscan/onchain/serum"
 )
@@ -16,42 +19,84 @@ type Info interface {
 	TokenAddress() solana.PublicKey
 }
 
+// ExpiredMarket is published when pending market is dropped before its pool arrived.
+type ExpiredMarket struct {
+	Pair   *PairInfo
+	Reason cache.Reason // Expired if market waited too long, evicted if there were too many pending markets.
+	Time   time.Time
+}
+
 type PairCollector struct {
 	infoC chan Info
 	doneC chan struct{}
 
+	sweepInterval   time.Duration
+	expiredPublishC chan<- ExpiredMarket
+
 	// Key is BaseMint (Token) address as it exists in both MarketInfo and raydium.AmmInfo.
-	pairs        map[solana.PublicKey]*PairInfo
-	createdPairs map[solana.PublicKey]struct{}
+	pairs        *cache.LRU[solana.PublicKey, *PairInfo]
+	createdPairs *cache.LRU[solana.PublicKey, struct{}]
 
 	dropAmmWithoutMarket bool
 	dropLowLiquidity     bool
+
+	dropped atomic.Uint64 // Pairs and expired markets not delivered to slow consumers.
 }
 
-func NewPairCollector() *PairCollector {
-	return &PairCollector{
-		infoC:                make(chan Info, 32),
+func NewPairCollector(cfg config.Pipeline) *PairCollector {
+	c := &PairCollector{
+		infoC:                make(chan Info, cfg.ChannelSize),
 		doneC:                make(chan struct{}),
-		pairs:                make(map[solana.PublicKey]*PairInfo),
-		createdPairs:         make(map[solana.PublicKey]struct{}),
+		sweepInterval:        max(cfg.PendingMarketTTL/10, time.Second),
+		createdPairs:         cache.New[solana.PublicKey, struct{}](cfg.DedupSize, cfg.DedupTTL, nil),
 		dropAmmWithoutMarket: true,
 	}
+
+	c.pairs = cache.New(cfg.PendingMarketLimit, cfg.PendingMarketTTL, c.marketExpired)
+	return c
 }
 
 func (c *PairCollector) Channel() chan<- Info {
 	return c.infoC
 }
 
-func (c *PairCollector) Start(pairPublishC []chan<- *PairInfo) {
+// CacheStats returns stats of pending markets and created pairs caches.
+func (c *PairCollector) CacheStats() (pending, created cache.Stats) {
+	return c.pairs.Stats(), c.createdPairs.Stats()
+}
+
+// Dropped returns number of pairs and expired markets that were dropped, because their consumer's channel was full.
+func (c *PairCollector) Dropped() uint64 {
+	return c.dropped.Load()
+}
+
+// Start starts collecting infos into pairs; ready pairs are published to pairPublishC and dropped markets to expiredPublishC, if not nil.
+// Consumers are never waited for, so they should keep their channels drained; whatever doesn't fit is dropped.
+func (c *PairCollector) Start(pairPublishC []chan<- *PairInfo, expiredPublishC chan<- ExpiredMarket) {
 	fmt.Printf("[%v] PairCollector: starting...\n", time.Now().Format("2006-01-02 15:04:05.000"))
+	c.expiredPublishC = expiredPublishC
 
 	go func() {
 		defer close(c.doneC)
 
-		for genericInfo := range c.infoC {
+		sweepTicker := time.NewTicker(c.sweepInterval)
+		defer sweepTicker.Stop()
+
+		for {
+			var genericInfo Info
+			select {
+			case <-sweepTicker.C:
+				c.pairs.Sweep()
+				continue
+			case info, ok := <-c.infoC:
+				if !ok {
+					return
+				}
+				genericInfo = info
+			}
+
 			tokenAddress := genericInfo.TokenAddress()
-			_, cOk := c.createdPairs[tokenAddress]
-			if cOk {
+			if c.createdPairs.Contains(tokenAddress) {
 				fmt.Printf("[%v] PairCollector: already created pair for token: %s\n", time.Now().Format("2006-01-02 15:04:05.000"), tokenAddress)
 				continue
 			}
@@ -66,9 +111,11 @@ func (c *PairCollector) Start(pairPublishC []chan<- *PairInfo) {
 				continue // Wait until amm info arrive
 			}
 
+			tokenAddress = pair.TokenAddress() // Swapped amm info is published with WSOL as token.
+
 			if !pair.Ready() {
 				fmt.Printf("[%v] PairCollector: pair got all info but not ready; drop it (token: %s, ammid: %s)\n", time.Now().Format("2006-01-02 15:04:05.000"), tokenAddress, pair.AmmInfo.AmmID)
-				delete(c.pairs, tokenAddress)
+				c.pairs.Delete(tokenAddress)
 				continue
 			}
 
@@ -76,14 +123,36 @@ func (c *PairCollector) Start(pairPublishC []chan<- *PairInfo) {
 
 			// Update pair status.
 			if tokenAddress != solana.WrappedSol {
-				c.createdPairs[tokenAddress] = struct{}{}
+				c.createdPairs.Add(tokenAddress, struct{}{})
 				fmt.Printf("[%v] PairCollector: new pair found (token: %s, ammid: %s, opentime: %s)\n", time.Now().Format("2006-01-02 15:04:05.000"), tokenAddress, pair.AmmInfo.AmmID, pair.AmmInfo.InitialLiveInfo.UpdateTime.Format("2006-01-02 15:04:05.000"))
-				delete(c.pairs, tokenAddress)
+				c.pairs.Delete(tokenAddress)
+
+				for i, publishC := range pairPublishC {
+					select {
+					case publishC <- pair:
+					default:
+						fmt.Printf("[%v] PairCollector: pair consumer %d too slow; pair dropped (token: %s, ammid: %s, dropped: %d)\n", time.Now().Format("2006-01-02 15:04:05.000"), i, tokenAddress, pair.AmmInfo.AmmID, c.dropped.Add(1))
+					}
+				}
 			}
 		}
 	}()
 }
 
+// marketExpired is called by pending markets cache for every dropped market.
+func (c *PairCollector) marketExpired(tokenAddress solana.PublicKey, pair *PairInfo, reason cache.Reason) {
+	if c.expiredPublishC == nil {
+		return
+	}
+
+	// Called by cache within collecting loop, so it must not wait either.
+	select {
+	case c.expiredPublishC <- ExpiredMarket{Pair: pair, Reason: reason, Time: time.Now()}:
+	default:
+		fmt.Printf("[%v] PairCollector: expired market consumer too slow; event dropped (token: %s, reason: %s, dropped: %d)\n", time.Now().Format("2006-01-02 15:04:05.000"), tokenAddress, reason, c.dropped.Add(1))
+	}
+}
+
 func (c *PairCollector) handleInfo(genericInfo Info, pairPublishC []chan<- *PairInfo) (*PairInfo, error) {
 	switch info := genericInfo.(type) {
 	case *serum.MarketInfo:
@@ -99,26 +168,29 @@ func (c *PairCollector) handleInfo(genericInfo Info, pairPublishC []chan<- *Pair
 
 func (c *PairCollector) handleMarketInfo(market *serum.MarketInfo) (*PairInfo, error) {
 	tokenAddress := market.TokenAddress()
-	_, ok := c.pairs[tokenAddress]
-	if ok {
-		return nil, fmt.Errorf("pair already exists for token: %s", tokenAddress)
+	pair := &PairInfo{
+		MarketInfo: *market,
 	}
 
-	c.pairs[tokenAddress] = &PairInfo{
-		MarketInfo: *market,
+	if !c.pairs.Add(tokenAddress, pair) {
+		return nil, fmt.Errorf("pair already exists for token: %s", tokenAddress)
 	}
 
 	fmt.Printf("[%v] PairCollector: new market discovered for (token: %s, tx time: %v)\n", time.Now().Format("2006-01-02 15:04:05.000"), tokenAddress, market.TxTime.Format("2006-01-02 15:04:05.000"))
-	return c.pairs[tokenAddress], nil
+	return pair, nil
 }
 
 func (c *PairCollector) handleAmmInfo(amm *raydium.AmmInfo) (*PairInfo, error) {
 	tokenAddress := amm.TokenAddress()
-	pair, ok := c.pairs[tokenAddress]
+	pair, ok := c.pairs.Get(tokenAddress)
 	ammSwapped := false
 
 	// Derived amm info should always be right so just assign.
 	if amm.Calculated {
+		if !ok {
+			return nil, fmt.Errorf("calculated amm, no pair for token: %s", tokenAddress)
+		}
+
 		pair.CalculatedAmmInfo = *amm
 		return pair, nil
 	}
@@ -126,7 +198,7 @@ func (c *PairCollector) handleAmmInfo(amm *raydium.AmmInfo) (*PairInfo, error) {
 	// In case token address is swapped, swap it back.
 	if tokenAddress == solana.WrappedSol {
 		tokenAddress = amm.CurrencyAddress // Addresses are swapped but we dont know it yet, because didnt sync with market info. Lets swap it manually.
-		pair, ok = c.pairs[tokenAddress]
+		pair, ok = c.pairs.Get(tokenAddress)
 		ammSwapped = true
 	}
 
@@ -150,7 +222,7 @@ func (c *PairCollector) handleAmmInfo(amm *raydium.AmmInfo) (*PairInfo, error) {
 
 func (c *PairCollector) handleTokenInfo(token *TokenInfo) (*PairInfo, error) {
 	tokenAddress := token.TokenAddress()
-	pair, ok := c.pairs[tokenAddress]
+	pair, ok := c.pairs.Get(tokenAddress)
 	if !ok {
 		return nil, fmt.Errorf("token, no pair for token: %s", tokenAddress)
 	}
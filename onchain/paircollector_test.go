@@ -0,0 +1,215 @@
+package onchain
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/patrulek/rayscan/config"
+	"github.com/patrulek/rayscan/onchain/raydium"
+	"github.com/patrulek/rayscan/onchain/serum"
+)
+
+var testPipeline = config.Pipeline{
+	ChannelSize:        32,
+	DedupSize:          100,
+	DedupTTL:           time.Hour,
+	PendingMarketLimit: 100,
+	PendingMarketTTL:   time.Hour,
+}
+
+// testKey returns deterministic public key; keys of different seeds differ.
+func testKey(seed byte) solana.PublicKey {
+	var key solana.PublicKey
+	for i := range key {
+		key[i] = seed
+	}
+
+	return key
+}
+
+func testSignature(seed byte) solana.Signature {
+	var sig solana.Signature
+	for i := range sig {
+		sig[i] = seed
+	}
+
+	return sig
+}
+
+// testPairInfos returns ready infos of a single pair of given token, as published by TxAnalyzer.
+func testPairInfos(token solana.PublicKey) (*serum.MarketInfo, *raydium.AmmInfo, *raydium.AmmInfo, *TokenInfo) {
+	now := time.Now()
+
+	market := serum.NewMarketInfo()
+	market.Market, market.EventQueue, market.Bids, market.Asks = testKey(1), testKey(2), testKey(3), testKey(4)
+	market.BaseMint, market.QuoteMint = token, solana.WrappedSol
+	market.BaseVault, market.QuoteVault, market.VaultSigner, market.Caller = testKey(5), testKey(6), testKey(7), testKey(8)
+	market.TxID, market.Slot, market.TxTime, market.Timestamp = testSignature(1), 100, now, now
+
+	amm := raydium.NewAmmInfo()
+	amm.AmmID, amm.AmmOpenOrders, amm.LPTokenAddress = testKey(11), testKey(12), testKey(13)
+	amm.TokenMintAddress, amm.PoolCoinTokenAccount, amm.PoolPcTokenAccount = token, testKey(14), testKey(15)
+	amm.AmmTargetOrders, amm.AmmLiquidityCreator, amm.Caller = testKey(16), testKey(17), testKey(18)
+	amm.TxID, amm.Slot, amm.TxTime, amm.Timestamp = testSignature(2), 200, now, now
+	amm.InitialLiveInfo = raydium.AmmLiveInfo{UpdateTime: now, PooledLamports: 1e9, PooledToken: 1e6, Price: 1e-3}
+
+	calculated := *amm
+	calculated.Calculated = true
+
+	info := &TokenInfo{Address: token, TimeToSerumMarket: time.Hour, TxID: testSignature(3), TxTime: now}
+	return market, &calculated, amm, info
+}
+
+// collect passes infos to new collector in given order and returns published pairs.
+func collect(t *testing.T, infos ...Info) []*PairInfo {
+	t.Helper()
+
+	pairC := make(chan *PairInfo, len(infos))
+	c := NewPairCollector(testPipeline)
+	c.Start([]chan<- *PairInfo{pairC}, nil)
+
+	for _, info := range infos {
+		c.Channel() <- info
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := c.Stop(ctx); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+
+	close(pairC)
+
+	var pairs []*PairInfo
+	for pair := range pairC {
+		pairs = append(pairs, pair)
+	}
+
+	return pairs
+}
+
+func TestPairCollectorPublishesPairInOrder(t *testing.T) {
+	token := testKey(100)
+	market, calculated, amm, tokenInfo := testPairInfos(token)
+
+	pairs := collect(t, market, calculated, tokenInfo, amm)
+	if len(pairs) != 1 {
+		t.Fatalf("expected 1 pair, got %d", len(pairs))
+	}
+
+	pair := pairs[0]
+	if pair.TokenAddress() != token || pair.AmmInfo.AmmID != amm.AmmID {
+		t.Fatalf("unexpected pair (token: %s, ammid: %s)", pair.TokenAddress(), pair.AmmInfo.AmmID)
+	}
+
+	if !pair.Ready() || pair.Readiness.IsZero() {
+		t.Fatalf("published pair is not ready")
+	}
+}
+
+func TestPairCollectorPublishesPairOnce(t *testing.T) {
+	market, calculated, amm, tokenInfo := testPairInfos(testKey(100))
+	second := *amm
+	second.TxID = testSignature(4)
+
+	if pairs := collect(t, market, calculated, tokenInfo, amm, market, &second); len(pairs) != 1 {
+		t.Fatalf("expected 1 pair, got %d", len(pairs))
+	}
+}
+
+func TestPairCollectorDropsAmmBeforeMarket(t *testing.T) {
+	market, calculated, amm, tokenInfo := testPairInfos(testKey(100))
+
+	if pairs := collect(t, amm, market, calculated, tokenInfo); len(pairs) != 0 {
+		t.Fatalf("expected no pairs, got %d", len(pairs))
+	}
+}
+
+func TestPairCollectorDropsPairCompletedBeforeTokenInfo(t *testing.T) {
+	market, calculated, amm, tokenInfo := testPairInfos(testKey(100))
+
+	if pairs := collect(t, market, calculated, amm, tokenInfo); len(pairs) != 0 {
+		t.Fatalf("expected no pairs, got %d", len(pairs))
+	}
+}
+
+func TestPairCollectorUsesCalculatedVaults(t *testing.T) {
+	market, calculated, amm, tokenInfo := testPairInfos(testKey(100))
+	amm.PoolCoinTokenAccount = testKey(99) // Wrong vault parsed from transaction.
+
+	pairs := collect(t, market, calculated, tokenInfo, amm)
+	if len(pairs) != 1 {
+		t.Fatalf("expected 1 pair, got %d", len(pairs))
+	}
+
+	if got := pairs[0].AmmInfo.PoolCoinTokenAccount; got != calculated.PoolCoinTokenAccount {
+		t.Fatalf("expected calculated coin vault %s, got %s", calculated.PoolCoinTokenAccount, got)
+	}
+}
+
+func TestPairCollectorSwapsReversedAmm(t *testing.T) {
+	token := testKey(100)
+	market, calculated, amm, tokenInfo := testPairInfos(token)
+
+	// Pool created with token as currency.
+	amm.TokenMintAddress, amm.CurrencyAddress = solana.WrappedSol, token
+	amm.PoolCoinTokenAccount, amm.PoolPcTokenAccount = amm.PoolPcTokenAccount, amm.PoolCoinTokenAccount
+	amm.InitialLiveInfo.PooledToken, amm.InitialLiveInfo.PooledLamports = amm.InitialLiveInfo.PooledLamports, amm.InitialLiveInfo.PooledToken
+	amm.InitialLiveInfo.Price = 1 / amm.InitialLiveInfo.Price
+
+	pairs := collect(t, market, calculated, tokenInfo, amm)
+	if len(pairs) != 1 {
+		t.Fatalf("expected 1 pair, got %d", len(pairs))
+	}
+
+	if got := pairs[0].AmmInfo.TokenMintAddress; got != token {
+		t.Fatalf("expected swapped token %s, got %s", token, got)
+	}
+
+	if got := pairs[0].AmmInfo.InitialLiveInfo.PooledLamports; got != 1e9 {
+		t.Fatalf("expected swapped pooled lamports 1e9, got %v", got)
+	}
+}
+
+func TestPairCollectorDoesntWaitForSlowConsumer(t *testing.T) {
+	cfg := testPipeline
+	cfg.PendingMarketLimit = 1
+
+	stuckC := make(chan *PairInfo) // Never read.
+	pairC := make(chan *PairInfo, 2)
+	expiredC := make(chan ExpiredMarket) // Never read.
+
+	c := NewPairCollector(cfg)
+	c.Start([]chan<- *PairInfo{stuckC, pairC}, expiredC)
+
+	for _, token := range []solana.PublicKey{testKey(100), testKey(101)} {
+		market, calculated, amm, tokenInfo := testPairInfos(token)
+		for _, info := range []Info{market, calculated, tokenInfo, amm} {
+			c.Channel() <- info
+		}
+	}
+
+	// Evicts pending market of the third token.
+	market, _, _, _ := testPairInfos(testKey(102))
+	c.Channel() <- market
+	market, _, _, _ = testPairInfos(testKey(103))
+	c.Channel() <- market
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := c.Stop(ctx); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+
+	if len(pairC) != 2 {
+		t.Fatalf("expected 2 pairs published to ready consumer, got %d", len(pairC))
+	}
+
+	if got := c.Dropped(); got != 3 {
+		t.Fatalf("expected 2 pairs and 1 expired market dropped, got %d", got)
+	}
+}
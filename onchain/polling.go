@@ -0,0 +1,232 @@
+package onchain
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/patrulek/rayscan/connection"
+)
+
+const (
+	pollFetchConcurrency = 8  // Maximal number of transactions of polled signatures fetched at once by single feed.
+	pollBacklog          = 10 // Polls worth of new signatures (poll_limit each) feed may fall behind; older ones are skipped.
+)
+
+// pollFeed polls getSignaturesForAddress of single program (or its poll address) on observed node, for nodes without websocket support.
+// New signatures are claimed in dedup first, so only transactions no other observer has seen are fetched to get their logs.
+type pollFeed struct {
+	observer *LogObserver
+	sub      *subscription
+	address  solana.PublicKey // Polled address.
+	client   *rpc.Client
+
+	cursor   solana.Signature            // The newest handled signature; next poll returns signatures newer than that.
+	pending  []*rpc.TransactionSignature // Polled signatures newer than cursor, over poll_limit; newest first.
+	nextPoll time.Time
+	fetchC   chan struct{} // Limits number of fetched transactions.
+
+	ctx    context.Context // Canceled when feed is closed.
+	cancel context.CancelFunc
+	once   sync.Once
+}
+
+// openPoll creates polling feed of given program. Polling continues from the last signature received by subscription,
+// so reopened feed doesn't miss anything; otherwise it starts from the newest signature, which is fetched within ctx.
+func (o *LogObserver) openPoll(ctx context.Context, conn *connection.Connection, sub *subscription) (feed, error) {
+	feedCtx, cancel := context.WithCancel(context.Background())
+	f := &pollFeed{
+		observer: o,
+		sub:      sub,
+		address:  sub.ProgramID,
+		client:   conn.RPCClient,
+		fetchC:   make(chan struct{}, pollFetchConcurrency),
+		ctx:      feedCtx,
+		cancel:   cancel,
+	}
+
+	if !sub.PollAddress.IsZero() {
+		f.address = sub.PollAddress
+	}
+
+	sub.mu.Lock()
+	f.cursor = sub.lastSignature
+	sub.mu.Unlock()
+
+	if f.cursor.IsZero() {
+		if err := f.initCursor(ctx); err != nil {
+			cancel()
+			return nil, err
+		}
+	}
+
+	f.nextPoll = time.Now().Add(o.cfg.PollInterval)
+	return f, nil
+}
+
+// initCursor sets cursor to the newest signature of polled address, if it has any. It's kept as the last signature of subscription,
+// so feed reopened before anything new is polled continues from it.
+func (f *pollFeed) initCursor(ctx context.Context) error {
+	limit := 1
+	signatures, err := f.client.GetSignaturesForAddressWithOpts(ctx, f.address, &rpc.GetSignaturesForAddressOpts{
+		Limit:      &limit,
+		Commitment: rpc.CommitmentType(f.observer.cfg.TxCommitment),
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(signatures) > 0 {
+		f.cursor = signatures[0].Signature
+
+		f.sub.mu.Lock()
+		if f.sub.lastSignature.IsZero() {
+			f.sub.lastSignature = f.cursor
+		}
+		f.sub.mu.Unlock()
+	}
+
+	return nil
+}
+
+func (f *pollFeed) recv(txCandidatePublishC chan<- TxCandidate) (bool, error) {
+	select {
+	case <-f.ctx.Done():
+		return false, fmt.Errorf("feed closed")
+	case <-time.After(time.Until(f.nextPoll)):
+	}
+
+	o := f.observer
+	f.nextPoll = time.Now().Add(o.cfg.PollInterval)
+
+	ctx, cancel := context.WithTimeout(f.ctx, f.sub.Reconnect.Timeout)
+	defer cancel()
+
+	if f.cursor.IsZero() {
+		return false, f.initCursor(ctx) // Program had no signatures yet.
+	}
+
+	// Signatures are paged back to the newest one polled, so none is skipped.
+	until := f.cursor
+	if len(f.pending) > 0 {
+		until = f.pending[0].Signature
+	}
+
+	client := func() (*rpc.Client, error) { return f.client, nil }
+	limit := pollBacklog * o.cfg.PollLimit
+	signatures, err := o.programSignatures(ctx, client, f.address, until, limit)
+	if err != nil {
+		return false, err
+	}
+
+	if len(signatures) == limit {
+		// Too far behind to catch up; only the newest signatures are handled, so cursor skips the older ones.
+		fmt.Printf("[%v] LogObserver: Polled %d new signatures of %s program on %s; skipping older ones (pending: %d)\n", time.Now().Format("2006-01-02 15:04:05.000"), limit, f.sub.Name, o.connName, len(f.pending))
+		f.pending = nil
+	}
+
+	f.pending = append(signatures, f.pending...)
+	if len(f.pending) == 0 {
+		return false, nil
+	}
+
+	// Only the oldest ones are handled, so cursor doesn't pass signatures left for next polls.
+	n := min(len(f.pending), o.cfg.PollLimit)
+	batch := f.pending[len(f.pending)-n:]
+	f.pending = f.pending[:len(f.pending)-n]
+
+	if len(f.pending) > 0 {
+		fmt.Printf("[%v] LogObserver: Polled more than %d new signatures of %s program on %s; %d left for next polls\n", time.Now().Format("2006-01-02 15:04:05.000"), o.cfg.PollLimit, f.sub.Name, o.connName, len(f.pending))
+	}
+
+	for i := len(batch) - 1; i >= 0; i-- { // Oldest first.
+		if !f.handle(batch[i], txCandidatePublishC) {
+			break // Closed.
+		}
+		f.cursor = batch[i].Signature
+	}
+
+	return true, nil
+}
+
+// handle claims polled signature and fetches its transaction in background, if no other observer has seen it;
+// false is returned if feed was closed meanwhile. Signature is kept as the last one of subscription once it's handled,
+// so reopened feed continues from it.
+func (f *pollFeed) handle(signature *rpc.TransactionSignature, txCandidatePublishC chan<- TxCandidate) bool {
+	o, sub := f.observer, f.sub
+
+	sub.stats.received.Add(1)
+	sub.stats.lastMessage.Store(time.Now().UnixNano())
+
+	if signature.Err == nil { // Otherwise failed transaction.
+		// Claimed only once it can be fetched, so signature left by closed feed isn't lost for reopened one.
+		select {
+		case <-f.ctx.Done():
+			return false
+		case f.fetchC <- struct{}{}:
+		}
+
+		if o.dedup.Claim(sub.ProgramID, signature.Signature, o.connName, time.Now()) {
+			o.background.Add(1)
+			go func() {
+				defer o.background.Done()
+				defer func() { <-f.fetchC }()
+				f.fetch(signature.Signature, txCandidatePublishC)
+			}()
+		} else {
+			<-f.fetchC // Already processed.
+		}
+	}
+
+	sub.mu.Lock()
+	sub.lastSignature = signature.Signature
+	sub.mu.Unlock()
+
+	return true
+}
+
+// fetch gets transaction of polled signature, from observed node or any tx-fetch node if it fails, and analyzes its logs.
+// Transaction is passed with found candidate, so it isn't fetched again; signature that can't be fetched is released.
+func (f *pollFeed) fetch(signature solana.Signature, txCandidatePublishC chan<- TxCandidate) {
+	o, sub := f.observer, f.sub
+
+	ctx, cancel := context.WithTimeout(f.ctx, o.cfg.AnalyzeTimeout)
+	defer cancel()
+
+	nodeClient := func() (*rpc.Client, error) { return f.client, nil }
+	txFetchClient := func() (*rpc.Client, error) {
+		return o.rpcPool.RoleClientForMethod(ctx, connection.RoleTxFetch, "getTransaction")
+	}
+
+	rpcTx, err := o.fetchTransaction(ctx, signature, nodeClient, txFetchClient)
+	if err != nil {
+		o.dedup.Release(sub.ProgramID, signature) // Left for other observers and their gap fills.
+		fmt.Printf("[%v] LogObserver: Error getting polled transaction of %s program on %s (tx: %s): %v\n", time.Now().Format("2006-01-02 15:04:05.000"), sub.Name, o.connName, signature, err)
+		return
+	}
+
+	tx, err := rpcTx.Transaction.GetTransaction()
+	if err != nil {
+		fmt.Printf("[%v] LogObserver: Error decoding polled transaction of %s program on %s (tx: %s): %v\n", time.Now().Format("2006-01-02 15:04:05.000"), sub.Name, o.connName, signature, err)
+		return
+	}
+
+	streamed := &StreamedTx{Result: rpcTx, Transaction: tx}
+	log := streamedLog(streamed)
+	if o.recorder != nil {
+		o.recorder.RecordLog(o.connName, sub.Name, log)
+	}
+
+	if log.Value.Logs == nil || log.Value.Err != nil {
+		return
+	}
+
+	o.analyzeLogs(sub, log, streamed, txCandidatePublishC)
+}
+
+func (f *pollFeed) close() {
+	f.once.Do(f.cancel)
+}
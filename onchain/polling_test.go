@@ -0,0 +1,206 @@
+package onchain
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc/jsonrpc"
+	"github.com/patrulek/rayscan/config"
+	"github.com/patrulek/rayscan/connection"
+	"github.com/patrulek/rayscan/fakerpc"
+	"github.com/patrulek/rayscan/onchain/raydium"
+)
+
+var raydiumPollAddress = raydium.Raydium_Create_Pool_Fee_V4.String()
+
+// startPolling starts polling observer of default programs on given node; it's stopped with the test.
+func startPolling(t *testing.T, s *fakerpc.Server, name string, candidateC chan<- TxCandidate, limit int) {
+	t.Helper()
+
+	o := newPolling(t, s, name, limit)
+	if err := o.Start(context.Background(), candidateC); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		o.Stop(ctx)
+	})
+}
+
+// newPolling creates polling observer of default programs on given node.
+func newPolling(t *testing.T, s *fakerpc.Server, name string, limit int) *LogObserver {
+	t.Helper()
+
+	cfg, poolCfg := testDefaults(t)
+	cfg.PollInterval = 20 * time.Millisecond
+	cfg.PollLimit = limit
+
+	// Node without websocket endpoint.
+	pool, err := connection.NewRPCClientPool(map[string]config.RPCNode{name: {RPCEndpoint: s.RPCURL(), Observer: true}}, poolCfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+
+	return NewLogObserver(pool, name, cfg, NewSignatureDedup(cfg), DefaultSubscriptions())
+}
+
+// addPolledTx adds successful transaction with given logs to signatures of given address.
+func addPolledTx(t *testing.T, s *fakerpc.Server, address string, sig solana.Signature, logs []string) {
+	t.Helper()
+
+	s.SetTransaction(sig.String(), txResult(t, sig, logs))
+	s.AddSignature(address, map[string]interface{}{"signature": sig.String(), "slot": 100})
+}
+
+func TestPollingHandlesSignaturesOverLimit(t *testing.T) {
+	s := fakerpc.NewServer(fakerpc.Fixtures{})
+	t.Cleanup(s.Close)
+
+	// Polling starts after the newest signature.
+	addPolledTx(t, s, raydiumPollAddress, testSignature(1), raydiumLogs)
+
+	candidateC := make(chan TxCandidate, 16)
+	startPolling(t, s, "node", candidateC, 2)
+
+	for i := byte(2); i <= 6; i++ {
+		addPolledTx(t, s, raydiumPollAddress, testSignature(i), raydiumLogs)
+	}
+
+	found := make(map[solana.Signature]bool)
+	for i := 0; i < 5; i++ {
+		found[expectCandidate(t, candidateC).Signature] = true
+	}
+
+	for i := byte(2); i <= 6; i++ {
+		if !found[testSignature(i)] {
+			t.Fatalf("expected candidate of signature %d over poll limit", i)
+		}
+	}
+
+	expectNoCandidate(t, candidateC)
+}
+
+func TestPollingFetchesOnlyRaydiumPoolInitializations(t *testing.T) {
+	s := fakerpc.NewServer(fakerpc.Fixtures{})
+	t.Cleanup(s.Close)
+
+	addPolledTx(t, s, raydiumPollAddress, testSignature(1), raydiumLogs)
+
+	candidateC := make(chan TxCandidate, 8)
+	startPolling(t, s, "node", candidateC, 1000)
+
+	// Swap mentions only the program; pool initialization pays fee too.
+	addPolledTx(t, s, raydiumProgram, testSignature(2), raydiumLogs[:1])
+	addPolledTx(t, s, raydiumProgram, testSignature(3), raydiumLogs)
+	addPolledTx(t, s, raydiumPollAddress, testSignature(3), raydiumLogs)
+
+	if candidate := expectCandidate(t, candidateC); candidate.Signature != testSignature(3) || candidate.Metadata == nil {
+		t.Fatalf("unexpected candidate: %+v", candidate)
+	}
+
+	expectNoCandidate(t, candidateC)
+	if err := s.AssertCalled("getTransaction", 1); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPollingSkipsSignaturesOverBacklog(t *testing.T) {
+	s := fakerpc.NewServer(fakerpc.Fixtures{})
+	t.Cleanup(s.Close)
+
+	addPolledTx(t, s, raydiumPollAddress, testSignature(1), raydiumLogs)
+	for i := byte(2); i <= pollBacklog+6; i++ {
+		addPolledTx(t, s, raydiumPollAddress, testSignature(i), raydiumLogs)
+	}
+
+	// Polling continues from the first signature, so the rest is polled at once.
+	o := newPolling(t, s, "node", 1)
+	o.byName[ProgramRaydium].lastSignature = testSignature(1)
+
+	candidateC := make(chan TxCandidate, 32)
+	if err := o.Start(context.Background(), candidateC); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		o.Stop(ctx)
+	})
+
+	found := make(map[solana.Signature]bool)
+	for i := 0; i < pollBacklog; i++ {
+		found[expectCandidate(t, candidateC).Signature] = true
+	}
+
+	for i := byte(7); i <= pollBacklog+6; i++ {
+		if !found[testSignature(i)] {
+			t.Fatalf("expected candidate of signature %d within backlog", i)
+		}
+	}
+
+	expectNoCandidate(t, candidateC)
+}
+
+func TestPollingReleasesUnfetchedSignature(t *testing.T) {
+	s := fakerpc.NewServer(fakerpc.Fixtures{})
+	t.Cleanup(s.Close)
+
+	addPolledTx(t, s, raydiumPollAddress, testSignature(1), raydiumLogs)
+
+	o := newPolling(t, s, "node", 1000)
+	o.cfg.NotFoundRetryDelay = time.Millisecond
+
+	candidateC := make(chan TxCandidate, 8)
+	if err := o.Start(context.Background(), candidateC); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		o.Stop(ctx)
+	})
+
+	// Both observed and tx-fetch node fail in every attempt.
+	s.InjectFault("getTransaction", fakerpc.Fault{RPCError: &jsonrpc.RPCError{Code: -32603, Message: "internal error"}, Times: 2 * fetchAttempts})
+	addPolledTx(t, s, raydiumPollAddress, testSignature(2), raydiumLogs)
+
+	waitFor(t, "fetch attempts", func() bool { return s.AssertCalled("getTransaction", 2*fetchAttempts) == nil })
+	expectNoCandidate(t, candidateC)
+
+	if !o.dedup.Claim(raydium.Raydium_Liquidity_Program_V4, testSignature(2), "other", time.Now()) {
+		t.Fatalf("expected unfetched signature to be released")
+	}
+}
+
+func TestPollingStopsFetches(t *testing.T) {
+	s := fakerpc.NewServer(fakerpc.Fixtures{})
+	t.Cleanup(s.Close)
+
+	addPolledTx(t, s, raydiumPollAddress, testSignature(1), raydiumLogs)
+
+	o := newPolling(t, s, "node", 1000)
+	candidateC := make(chan TxCandidate) // Nobody receives.
+	if err := o.Start(context.Background(), candidateC); err != nil {
+		t.Fatal(err)
+	}
+
+	addPolledTx(t, s, raydiumPollAddress, testSignature(2), raydiumLogs)
+	waitFor(t, "fetch", func() bool { return s.AssertCalled("getTransaction", 1) == nil })
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := o.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	close(candidateC) // Fetch mustn't send anything now.
+	time.Sleep(50 * time.Millisecond)
+}
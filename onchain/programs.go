@@ -0,0 +1,67 @@
+package onchain
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/patrulek/rayscan/onchain/raydium"
+	"github.com/patrulek/rayscan/onchain/serum"
+)
+
+// Names of programs LogObserver subscribes logs for by default.
+const (
+	ProgramOpenBook = "openbook"
+	ProgramRaydium  = "raydium"
+)
+
+// DefaultSubscriptions returns subscriptions for OpenBook and Raydium program logs.
+func DefaultSubscriptions() []ProgramSubscription {
+	return []ProgramSubscription{OpenBookSubscription(), RaydiumSubscription()}
+}
+
+// OpenBookSubscription finds possible InitMarket instructions in OpenBook program logs.
+func OpenBookSubscription() ProgramSubscription {
+	return ProgramSubscription{
+		Name:      ProgramOpenBook,
+		ProgramID: serum.OpenBookDex,
+		Match: func(logs []string, i int) bool {
+			return i+1 < len(logs) &&
+				strings.Contains(logs[i], "Program 11111111111111111111111111111111 success") &&
+				strings.Contains(logs[i+1], "Program srmqPvymJeFKQ4zGQed1GFppgkRHL9kaELCbyksJtPX invoke [1]")
+		},
+		// Known for sure that candidate without metadata is InitializeMarket instruction.
+	}
+}
+
+// RaydiumSubscription finds possible Purchase IDO instructions in Raydium Liquidity program logs.
+func RaydiumSubscription() ProgramSubscription {
+	return ProgramSubscription{
+		Name:        ProgramRaydium,
+		ProgramID:   raydium.Raydium_Liquidity_Program_V4,
+		PollAddress: raydium.Raydium_Create_Pool_Fee_V4,
+		Match: func(logs []string, i int) bool {
+			return strings.Contains(logs[i], " InitializeInstruction2 ")
+		},
+		Build: func(logs []string, i int) (*json.RawMessage, error) {
+			// Raw input data; bytes[2:6] -> possible timestamp for ido openning; bytes[7:15] -> possible pc amount, last 8 bytes, possible coin amount
+			// Parse IDO info from log
+			_, after, _ := strings.Cut(logs[i], " InitializeInstruction2 ")
+
+			// Add quotes to keys.
+			splitted := strings.Split(after, " ")
+			for i, s := range splitted {
+				if strings.Contains(s, ":") {
+					splitted[i] = "\"" + s[:len(s)-1] + "\":"
+				}
+			}
+
+			metadata := json.RawMessage(strings.Join(splitted, " "))
+			if !json.Valid(metadata) {
+				return nil, errors.New("invalid JSON")
+			}
+
+			return &metadata, nil
+		},
+	}
+}
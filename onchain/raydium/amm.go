@@ -13,6 +13,7 @@ import (
 var (
 	Raydium_Liquidity_Program_V4 solana.PublicKey = solana.MustPublicKeyFromBase58("675kPX9MHTjS2zt1qfr1NYHuzeLXfQM9H24wFSUt1Mp8") // This program calls Raydium Purchase IDO to create a new pair.
 	Raydium_Authority_Program_V4 solana.PublicKey = solana.MustPublicKeyFromBase58("5Q544fKrFoe6tsEbD7S8EmxGTJYAKtTVhAW5Q5pge4j1") // This is also a wallet that holds tokens and do swaps.
+	Raydium_Create_Pool_Fee_V4   solana.PublicKey = solana.MustPublicKeyFromBase58("7YttLkHDoNj9wyDur5pM1ejNaAvT9X4eqaYcHQqtj2G5") // Receives fee of every new pair, so only Purchase IDO transactions mention it.
 )
 
 // Raydium Purchase Ido: https://solscan.io/tx/5keDz6sQMZWWZurg82htZHd4HmpWjCScYbUvmvcSJtjCTHXt8FRMzAEBNZgbQ3v3pir9ATyPpqPHjqAUKTqodWkr
@@ -0,0 +1,24 @@
+package raydium
+
+// Raydium AMM v4 swap fee (0.25%), taken from input amount before the constant product is applied.
+const SwapFeeNumerator, SwapFeeDenominator = 25, 10000
+
+// amountOut calculates output of constant product swap (x * y = k) for given reserves and input amount.
+func amountOut(reserveIn, reserveOut, amountIn float64) float64 {
+	if reserveIn <= 0 || reserveOut <= 0 || amountIn <= 0 {
+		return 0
+	}
+
+	amountInWithFee := amountIn * (SwapFeeDenominator - SwapFeeNumerator) / SwapFeeDenominator
+	return reserveOut * amountInWithFee / (reserveIn + amountInWithFee)
+}
+
+// QuoteBuy returns amount of tokens received for given amount of lamports.
+func (a *AmmLiveInfo) QuoteBuy(lamportsIn float64) float64 {
+	return amountOut(a.PooledLamports, a.PooledToken, lamportsIn)
+}
+
+// QuoteSell returns amount of lamports received for given amount of tokens.
+func (a *AmmLiveInfo) QuoteSell(tokensIn float64) float64 {
+	return amountOut(a.PooledToken, a.PooledLamports, tokensIn)
+}
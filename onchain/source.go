@@ -0,0 +1,375 @@
+package onchain
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/patrulek/rayscan/config"
+	"github.com/patrulek/rayscan/connection"
+)
+
+// How often fallback source checks whether its sources are degraded.
+const fallbackCheckInterval = time.Second
+
+// Source produces tx candidates of observed programs seen by single node (or recorded from it).
+// Sources of all nodes publish to the same channel and share SignatureDedup, so they can be mixed freely.
+type Source interface {
+	ConnectionName() string
+	Kind() SourceKind
+	Start(ctx context.Context, txCandidatePublishC chan<- TxCandidate) error
+	// Stop stops the source for good; stopped source can't be started again.
+	Stop(ctx context.Context) error
+	// DegradedSince returns time since which source doesn't work (eg. is reconnecting), or zero time if it works.
+	DegradedSince() time.Time
+	// Stats returns stats of every program subscription by its name.
+	Stats() map[string]SubscriptionStats
+}
+
+var (
+	_ Source = (*LogObserver)(nil)
+	_ Source = (*FallbackSource)(nil)
+)
+
+// NewNodeSource creates source of observer of given node, of kind selected by its config. If node has fallback
+// sources, they are started in order while the ones before them are degraded. Recorder, if not nil,
+// receives log messages of all of them.
+func NewNodeSource(rpcPool *connection.RPCPool, node config.RPCNode, cfg config.Pipeline, dedup *SignatureDedup, programs []ProgramSubscription, recorder LogRecorder) Source {
+	newSource := func(kind SourceKind) Source {
+		o := NewLogObserver(rpcPool, node.Name, cfg, dedup, programs)
+		o.kind = kind
+		if recorder != nil {
+			o.SetRecorder(recorder)
+		}
+
+		return o
+	}
+
+	kinds := []SourceKind{SourceKind(node.ObserverSource())}
+	for _, kind := range node.Fallback {
+		kinds = append(kinds, SourceKind(kind))
+	}
+
+	if len(kinds) == 1 {
+		return newSource(kinds[0])
+	}
+
+	return NewFallbackSource(node.Name, kinds, newSource, cfg)
+}
+
+// FallbackSource runs the first of given sources and starts the next ones, in order, while all sources before them
+// have been degraded for fallback_delay. Fallback source is stopped once sources before it work again for that long.
+// Sources can't be restarted, so a new one is created every time fallback starts.
+type FallbackSource struct {
+	connName  string
+	kinds     []SourceKind
+	newSource func(kind SourceKind) Source
+	cfg       config.Pipeline
+
+	mu        sync.Mutex
+	sources   []Source                       // Running source of every kind; nil if it isn't running.
+	attempts  []time.Time                    // Time of last start attempt of every kind.
+	recovered []time.Time                    // Time since which running source of every kind works; zero if it's degraded.
+	stats     []map[string]SubscriptionStats // Stats of stopped sources of every kind.
+
+	txCandidatePublishC chan<- TxCandidate
+
+	running atomic.Bool
+	stopC   chan struct{}
+	doneC   chan struct{}
+}
+
+// NewFallbackSource creates fallback source of given connection; newSource creates not started source of given kind.
+func NewFallbackSource(connName string, kinds []SourceKind, newSource func(kind SourceKind) Source, cfg config.Pipeline) *FallbackSource {
+	stats := make([]map[string]SubscriptionStats, len(kinds))
+	for i := range stats {
+		stats[i] = make(map[string]SubscriptionStats)
+	}
+
+	return &FallbackSource{
+		connName:  connName,
+		kinds:     kinds,
+		newSource: newSource,
+		cfg:       cfg,
+		sources:   make([]Source, len(kinds)),
+		attempts:  make([]time.Time, len(kinds)),
+		recovered: make([]time.Time, len(kinds)),
+		stats:     stats,
+		stopC:     make(chan struct{}),
+		doneC:     make(chan struct{}),
+	}
+}
+
+func (s *FallbackSource) ConnectionName() string {
+	return s.connName
+}
+
+// Kind returns kind of the primary source.
+func (s *FallbackSource) Kind() SourceKind {
+	return s.kinds[0]
+}
+
+// Start starts the primary source; if it fails, fallback sources are tried in order and error is returned only if none starts.
+func (s *FallbackSource) Start(ctx context.Context, txCandidatePublishC chan<- TxCandidate) error {
+	if !s.running.CompareAndSwap(false, true) {
+		return fmt.Errorf("FallbackSource is already running")
+	}
+
+	s.txCandidatePublishC = txCandidatePublishC
+
+	var err error
+	for i := range s.kinds {
+		if _, err = s.start(ctx, i); err == nil {
+			break
+		}
+	}
+
+	if err != nil {
+		s.running.Store(false)
+		return err
+	}
+
+	go s.monitor()
+	return nil
+}
+
+// start starts source of given kind; it's kept only if fallback source wasn't stopped meanwhile.
+// Starting may take long, so caller mustn't hold the lock.
+func (s *FallbackSource) start(ctx context.Context, i int) (Source, error) {
+	if i > 0 {
+		fmt.Printf("[%v] FallbackSource: Starting %s fallback of %s source on %s...\n", time.Now().Format("2006-01-02 15:04:05.000"), s.kinds[i], s.kinds[0], s.connName)
+	}
+
+	s.mu.Lock()
+	s.attempts[i] = time.Now()
+	s.mu.Unlock()
+
+	src := s.newSource(s.kinds[i])
+	if err := src.Start(ctx, s.txCandidatePublishC); err != nil {
+		fmt.Printf("[%v] FallbackSource: Error starting %s source on %s: %v\n", time.Now().Format("2006-01-02 15:04:05.000"), s.kinds[i], s.connName, err)
+		return nil, err
+	}
+
+	s.mu.Lock()
+	if !s.running.Load() {
+		s.mu.Unlock()
+
+		// Stop doesn't see sources started after it, so this one has to be stopped here.
+		stopCtx, cancel := context.WithTimeout(context.Background(), s.cfg.ShutdownTimeout)
+		defer cancel()
+		s.stop(stopCtx, i, src)
+		return nil, fmt.Errorf("FallbackSource was stopped")
+	}
+
+	s.sources[i] = src
+	s.recovered[i] = time.Time{}
+	s.mu.Unlock()
+
+	return src, nil
+}
+
+// stop stops given source of given kind, already removed from running ones, keeping its stats; caller mustn't hold the lock.
+func (s *FallbackSource) stop(ctx context.Context, i int, src Source) error {
+	if i > 0 {
+		fmt.Printf("[%v] FallbackSource: Stopping %s fallback of %s source on %s...\n", time.Now().Format("2006-01-02 15:04:05.000"), s.kinds[i], s.kinds[0], s.connName)
+	}
+
+	err := src.Stop(ctx)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for program, stats := range src.Stats() {
+		s.stats[i][program] = s.stats[i][program].add(stats)
+	}
+
+	return err
+}
+
+// detach removes running sources of given kinds and returns them, indexed by kind; caller has to hold the lock.
+func (s *FallbackSource) detach(from int) []Source {
+	sources := make([]Source, len(s.sources))
+	for i := from; i < len(s.sources); i++ {
+		sources[i], s.sources[i] = s.sources[i], nil
+	}
+
+	return sources
+}
+
+func (s *FallbackSource) monitor() {
+	defer close(s.doneC)
+
+	ticker := time.NewTicker(fallbackCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stopC:
+			return
+		case <-ticker.C:
+			s.check()
+		}
+	}
+}
+
+// check starts the next source if all running ones have been degraded for too long, or stops sources
+// after the first one that has been working for long enough. Sources that failed to start are retried after fallback_delay.
+// Only monitor changes running sources besides Stop, so they're read under the lock but started and stopped outside of it.
+func (s *FallbackSource) check() {
+	now := time.Now()
+	for i := range s.kinds {
+		if !s.running.Load() {
+			return
+		}
+
+		s.mu.Lock()
+		src, attempt := s.sources[i], s.attempts[i]
+		s.mu.Unlock()
+
+		if src == nil {
+			if now.Sub(attempt) < s.cfg.FallbackDelay {
+				continue // Failed recently.
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), s.cfg.StartTimeout)
+			started, err := s.start(ctx, i)
+			cancel()
+
+			if err != nil {
+				continue
+			}
+			src = started
+		}
+
+		since := src.DegradedSince()
+
+		s.mu.Lock()
+		if !since.IsZero() {
+			s.recovered[i] = time.Time{}
+			s.mu.Unlock()
+
+			if now.Sub(since) >= s.cfg.FallbackDelay {
+				continue // Degraded; next source is needed.
+			}
+			return // Give it time to recover.
+		}
+
+		if s.recovered[i].IsZero() {
+			s.recovered[i] = now
+		}
+
+		if now.Sub(s.recovered[i]) < s.cfg.FallbackDelay {
+			s.mu.Unlock()
+			return // Not stable yet; keep fallbacks running.
+		}
+
+		fallbacks := s.detach(i + 1)
+		s.mu.Unlock()
+
+		for j, fallback := range fallbacks {
+			if fallback == nil {
+				continue
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), s.cfg.ShutdownTimeout)
+			if err := s.stop(ctx, j, fallback); err != nil {
+				fmt.Printf("[%v] FallbackSource: Error stopping %s source on %s: %v\n", time.Now().Format("2006-01-02 15:04:05.000"), s.kinds[j], s.connName, err)
+			}
+			cancel()
+		}
+		return
+	}
+}
+
+// DegradedSince returns zero time if any running source works, otherwise the latest time since which running source is degraded.
+func (s *FallbackSource) DegradedSince() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var degraded time.Time
+	for _, src := range s.sources {
+		if src == nil {
+			continue
+		}
+
+		since := src.DegradedSince()
+		if since.IsZero() {
+			return time.Time{}
+		}
+
+		if since.After(degraded) {
+			degraded = since
+		}
+	}
+
+	if degraded.IsZero() {
+		return time.Now() // Nothing is running.
+	}
+
+	return degraded
+}
+
+// Stats returns stats of all sources that ever ran; programs of fallback sources are suffixed with source kind.
+func (s *FallbackSource) Stats() map[string]SubscriptionStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := make(map[string]SubscriptionStats)
+	for i, kind := range s.kinds {
+		total := make(map[string]SubscriptionStats, len(s.stats[i]))
+		for program, st := range s.stats[i] {
+			total[program] = st
+		}
+
+		if src := s.sources[i]; src != nil {
+			for program, st := range src.Stats() {
+				total[program] = total[program].add(st)
+			}
+		}
+
+		for program, st := range total {
+			if i > 0 {
+				program = fmt.Sprintf("%s (%s)", program, kind)
+			}
+			stats[program] = st
+		}
+	}
+
+	return stats
+}
+
+// Stop stops all running sources, even if monitor doesn't finish in time; error of forced shutdown is returned then.
+func (s *FallbackSource) Stop(ctx context.Context) error {
+	if !s.running.CompareAndSwap(true, false) {
+		return fmt.Errorf("FallbackSource is not running")
+	}
+
+	close(s.stopC)
+
+	var err error
+	select {
+	case <-s.doneC:
+	case <-ctx.Done():
+		fmt.Printf("Err: FallbackSource: forced shutdown\n")
+		err = ctx.Err()
+	}
+
+	// Source started by monitor after this point stops itself, see start.
+	s.mu.Lock()
+	sources := s.detach(0)
+	s.mu.Unlock()
+
+	for i, src := range sources {
+		if src == nil {
+			continue
+		}
+
+		if stopErr := s.stop(ctx, i, src); stopErr != nil && err == nil {
+			err = stopErr
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,169 @@
+package onchain
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSource is a source whose state is set by the test.
+type fakeSource struct {
+	kind     SourceKind
+	releaseC chan struct{} // If not nil, Start waits until it's closed.
+	startedC chan struct{} // Closed once Start is called.
+	once     sync.Once
+
+	mu       sync.Mutex
+	degraded time.Time
+	running  bool
+	stopped  bool
+}
+
+func newFakeSource(kind SourceKind, blocking bool) *fakeSource {
+	src := &fakeSource{kind: kind, startedC: make(chan struct{})}
+	if blocking {
+		src.releaseC = make(chan struct{})
+	}
+
+	return src
+}
+
+func (s *fakeSource) ConnectionName() string { return "node" }
+func (s *fakeSource) Kind() SourceKind       { return s.kind }
+
+func (s *fakeSource) Start(ctx context.Context, txCandidatePublishC chan<- TxCandidate) error {
+	s.once.Do(func() { close(s.startedC) })
+	if s.releaseC != nil {
+		<-s.releaseC
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.running = true
+	return nil
+}
+
+func (s *fakeSource) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.running = false
+	s.stopped = true
+	return nil
+}
+
+func (s *fakeSource) DegradedSince() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.degraded
+}
+
+func (s *fakeSource) Stats() map[string]SubscriptionStats {
+	return map[string]SubscriptionStats{ProgramRaydium: {Received: 1}}
+}
+
+func (s *fakeSource) setDegraded(since time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.degraded = since
+}
+
+func (s *fakeSource) isStopped() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.stopped && !s.running
+}
+
+// newTestFallbackSource returns fallback source of given fake sources, in order; primary one degrades at once.
+func newTestFallbackSource(t *testing.T, sources ...*fakeSource) *FallbackSource {
+	t.Helper()
+
+	cfg, _ := testDefaults(t)
+	cfg.FallbackDelay = 0
+
+	byKind := make(map[SourceKind]*fakeSource, len(sources))
+	kinds := make([]SourceKind, 0, len(sources))
+	for _, src := range sources {
+		byKind[src.kind] = src
+		kinds = append(kinds, src.kind)
+	}
+
+	s := NewFallbackSource("node", kinds, func(kind SourceKind) Source { return byKind[kind] }, cfg)
+	if err := s.Start(context.Background(), make(chan TxCandidate)); err != nil {
+		t.Fatal(err)
+	}
+
+	sources[0].setDegraded(time.Now())
+	return s
+}
+
+func TestFallbackSourceDoesNotLockWhileStarting(t *testing.T) {
+	primary, fallback := newFakeSource(SourceLogs, false), newFakeSource(SourcePolling, true)
+	s := newTestFallbackSource(t, primary, fallback)
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		s.Stop(ctx)
+	}()
+
+	checkC := make(chan struct{})
+	go func() {
+		s.check()
+		close(checkC)
+	}()
+
+	<-fallback.startedC
+
+	statsC := make(chan struct{})
+	go func() {
+		s.Stats()
+		s.DegradedSince()
+		close(statsC)
+	}()
+
+	select {
+	case <-statsC:
+	case <-time.After(time.Second):
+		t.Fatalf("fallback source is locked while starting source")
+	}
+
+	close(fallback.releaseC)
+	<-checkC
+
+	if stats := s.Stats(); stats[ProgramRaydium].Received != 1 || stats[ProgramRaydium+" ("+string(SourcePolling)+")"].Received != 1 {
+		t.Fatalf("expected stats of both sources: %+v", stats)
+	}
+}
+
+func TestFallbackSourceStopsSourcesOnForcedShutdown(t *testing.T) {
+	primary, fallback := newFakeSource(SourceLogs, false), newFakeSource(SourcePolling, true)
+	s := newTestFallbackSource(t, primary, fallback)
+
+	// Monitor hangs starting fallback source.
+	select {
+	case <-fallback.startedC:
+	case <-time.After(3 * fallbackCheckInterval):
+		t.Fatalf("expected fallback source to be started")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	if err := s.Stop(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected forced shutdown, got %v", err)
+	}
+
+	if !primary.isStopped() {
+		t.Fatalf("expected primary source to be stopped on forced shutdown")
+	}
+
+	// Source started after Stop stops itself.
+	close(fallback.releaseC)
+	waitFor(t, "fallback source stopped", fallback.isStopped)
+}
@@ -0,0 +1,127 @@
+package onchain
+
+import (
+	"encoding/json"
+	"math/rand"
+	"sync/atomic"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+// LogMatcher tells if i-th log line of transaction marks it as a tx candidate.
+type LogMatcher func(logs []string, i int) bool
+
+// CandidateBuilder builds metadata of tx candidate from matched log line; error means the line isn't a candidate after all
+// and search continues.
+type CandidateBuilder func(logs []string, i int) (*json.RawMessage, error)
+
+// ReconnectPolicy tells how broken subscription is detected and restored; zero values are taken from pipeline config.
+type ReconnectPolicy struct {
+	Timeout     time.Duration // Timeout of single (re)subscribe attempt.
+	Delay       time.Duration // Initial delay between failed attempts; doubled after each failure, with jitter.
+	MaxDelay    time.Duration // Maximal delay between failed attempts.
+	IdleTimeout time.Duration // Subscription without messages for that long is reconnected; negative disables check.
+}
+
+// backoff returns delay before next attempt, given delay before the previous one (zero for the first attempt).
+func (p ReconnectPolicy) backoff(prev time.Duration) time.Duration {
+	next := p.Delay
+	if prev > 0 {
+		next = min(prev*2, p.MaxDelay)
+	}
+
+	return next
+}
+
+// jitter returns random delay within [d/2, d), so observers of many nodes don't reconnect in lockstep.
+func jitter(d time.Duration) time.Duration {
+	if d < 2 {
+		return d
+	}
+
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)))
+}
+
+// ProgramSubscription describes subscription for logs of single program and how tx candidates are found in them.
+type ProgramSubscription struct {
+	Name        string // Unique name; used in logs, recordings and stats.
+	ProgramID   solana.PublicKey
+	Commitment  rpc.CommitmentType // Empty uses pipeline logs_commitment.
+	Match       LogMatcher
+	Build       CandidateBuilder // Nil builds candidates without metadata.
+	Reconnect   ReconnectPolicy
+	PollAddress solana.PublicKey // Polled instead of ProgramID by polling source, if set; one that only candidates mention, so not every transaction of program is fetched.
+}
+
+// candidate returns metadata of the first tx candidate found in logs.
+func (s *ProgramSubscription) candidate(logs []string) (*json.RawMessage, bool) {
+	for i := range logs {
+		if !s.Match(logs, i) {
+			continue // Search further.
+		}
+
+		if s.Build == nil {
+			return nil, true
+		}
+
+		metadata, err := s.Build(logs, i)
+		if err != nil {
+			continue // Search further.
+		}
+
+		return metadata, true
+	}
+
+	return nil, false
+}
+
+// SubscriptionStats are counters of single program subscription of observer.
+type SubscriptionStats struct {
+	Received    uint64 // Log messages received, including duplicates and failed transactions.
+	Candidates  uint64 // Tx candidates published, including gap filled ones.
+	GapFilled   uint64 // Tx candidates found by gap fill after reconnects.
+	Reconnects  uint64
+	IdleTimeout uint64 // Reconnects caused by lack of messages.
+	LastMessage time.Time
+}
+
+type subscriptionStats struct {
+	received    atomic.Uint64
+	candidates  atomic.Uint64
+	gapFilled   atomic.Uint64
+	reconnects  atomic.Uint64
+	idleTimeout atomic.Uint64
+	lastMessage atomic.Int64 // Unix nanoseconds.
+}
+
+func (s *subscriptionStats) snapshot() SubscriptionStats {
+	stats := SubscriptionStats{
+		Received:    s.received.Load(),
+		Candidates:  s.candidates.Load(),
+		GapFilled:   s.gapFilled.Load(),
+		Reconnects:  s.reconnects.Load(),
+		IdleTimeout: s.idleTimeout.Load(),
+	}
+
+	if last := s.lastMessage.Load(); last > 0 {
+		stats.LastMessage = time.Unix(0, last)
+	}
+
+	return stats
+}
+
+// add returns sum of stats of two subscriptions of the same program, eg. of subsequent sources.
+func (s SubscriptionStats) add(other SubscriptionStats) SubscriptionStats {
+	s.Received += other.Received
+	s.Candidates += other.Candidates
+	s.GapFilled += other.GapFilled
+	s.Reconnects += other.Reconnects
+	s.IdleTimeout += other.IdleTimeout
+	if other.LastMessage.After(s.LastMessage) {
+		s.LastMessage = other.LastMessage
+	}
+
+	return s
+}
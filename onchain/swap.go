@@ -51,8 +51,8 @@ func (p *PairInfo) GetCurrentAmmLiveInfo() raydium.AmmLiveInfo {
 }
 
 func (p *PairInfo) SetCurrentAmmLiveInfo(ammLiveInfo raydium.AmmLiveInfo) {
-	p.mu.RLock()
-	defer p.mu.RUnlock()
+	p.mu.Lock()
+	defer p.mu.Unlock()
 	p.AmmInfo.CurrentLiveInfo = ammLiveInfo
 }
 
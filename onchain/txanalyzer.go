@@ -3,42 +3,52 @@ package onchain
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strconv"
 	"time"
 
 	"github.com/gagliardetto/solana-go"
 	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/patrulek/rayscan/config"
 	"github.com/patrulek/rayscan/connection"
 	"github.com/patrulek/rayscan/onchain/raydium"
 	"github.com/patrulek/rayscan/onchain/serum"
 )
 
-var Max_Transaction_Version uint64 = 1
 var Rewards bool = false
 
 type TxCandidate struct {
 	Signature  solana.Signature
 	clientName string
 	Metadata   *json.RawMessage
+	Tx         *StreamedTx // Set if observer received full transaction along with logs; it isn't fetched again then.
 }
 
+// StreamedTx is a transaction received by observer from a stream that carries full transactions (eg. geyser).
+type StreamedTx struct {
+	Result      *rpc.GetTransactionResult // Slot, BlockTime (time of receipt) and Meta are set.
+	Transaction *solana.Transaction
+}
+
+// Maximal delay between attempts of getting transaction that failed with error.
+const maxErrorRetryDelay = 5 * time.Second
+
 type TxAnalyzer struct {
 	rpcPool *connection.RPCPool
+	cfg     config.Pipeline
 
 	txCandidateC chan TxCandidate
 	doneC        chan struct{}
 	infoPublishC chan<- Info
-
-	gotCandidates map[solana.Signature]struct{}
 }
 
-func NewTxAnalyzer(rpcPool *connection.RPCPool) *TxAnalyzer {
+func NewTxAnalyzer(rpcPool *connection.RPCPool, cfg config.Pipeline) *TxAnalyzer {
 	return &TxAnalyzer{
-		rpcPool:       rpcPool,
-		txCandidateC:  make(chan TxCandidate, 32),
-		doneC:         make(chan struct{}),
-		gotCandidates: make(map[solana.Signature]struct{}),
+		rpcPool:      rpcPool,
+		cfg:          cfg,
+		txCandidateC: make(chan TxCandidate, cfg.ChannelSize),
+		doneC:        make(chan struct{}),
 	}
 }
 
@@ -53,20 +63,17 @@ func (a *TxAnalyzer) Start(infoPublishC chan<- Info) {
 		defer close(a.doneC)
 
 		for txCandidate := range a.txCandidateC {
-			if _, ok := a.gotCandidates[txCandidate.Signature]; ok {
-				continue
-			}
-
-			a.gotCandidates[txCandidate.Signature] = struct{}{}
-
-			go a.analyze(txCandidate, infoPublishC)
+			// Candidates are already deduplicated by observers.
+			go a.Analyze(txCandidate, infoPublishC)
 		}
 	}()
 }
 
-func (a *TxAnalyzer) analyze(txCandidate TxCandidate, infoPublishC chan<- Info) {
+// Analyze gets transaction of tx candidate and publishes infos found in it before returning; Start analyzes
+// every received candidate concurrently, so it can be used directly where order of infos matters (eg. backtests).
+func (a *TxAnalyzer) Analyze(txCandidate TxCandidate, infoPublishC chan<- Info) {
 	// Send rpc for full tx details
-	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), a.cfg.AnalyzeTimeout)
 	defer cancel()
 
 	rpcTx, tx, err := a.getConfirmedTransaction(ctx, txCandidate)
@@ -89,25 +96,65 @@ func (a *TxAnalyzer) analyze(txCandidate TxCandidate, infoPublishC chan<- Info)
 }
 
 func (a *TxAnalyzer) getConfirmedTransaction(ctx context.Context, txCandidate TxCandidate) (*rpc.GetTransactionResult, *solana.Transaction, error) {
-	rpcClient := a.rpcPool.NamedConnection(txCandidate.clientName).RPCClient
+	if streamed := txCandidate.Tx; streamed != nil {
+		if streamed.Result.Meta.Err != nil {
+			return nil, nil, fmt.Errorf("Transaction failed: %v", streamed.Result.Meta.Err)
+		}
+
+		return streamed.Result, streamed.Transaction, nil
+	}
+
+	// Node that observed the transaction is asked first; it's most likely to have it already.
+	prefer := txCandidate.clientName
+	errorDelay := a.cfg.NotFoundRetryDelay // Doubled after every failure that isn't not found.
 
 	for {
 		select {
 		case <-ctx.Done():
 			return nil, nil, ctx.Err()
 		default:
-			rctx, rcancel := context.WithTimeout(ctx, 5*time.Second)
-			rpcTx, err := rpcClient.GetTransaction(rctx, txCandidate.Signature, &rpc.GetTransactionOpts{
-				MaxSupportedTransactionVersion: &Max_Transaction_Version,
-				Commitment:                     rpc.CommitmentConfirmed,
+			rctx, rcancel := context.WithTimeout(ctx, a.cfg.GetTransactionTimeout)
+			rpcTx, winner, err := connection.Hedge(rctx, a.rpcPool, connection.RoleTxFetch, "getTransaction", prefer, func(ctx context.Context, client *rpc.Client) (*rpc.GetTransactionResult, error) {
+				return client.GetTransaction(ctx, txCandidate.Signature, &rpc.GetTransactionOpts{
+					MaxSupportedTransactionVersion: &a.cfg.MaxTransactionVersion,
+					Commitment:                     rpc.CommitmentType(a.cfg.TxCommitment),
+				})
 			})
 			rcancel()
 
 			if err != nil {
-				rpcClient = a.rpcPool.Client() // Try with another client.
+				if errors.Is(err, connection.ErrNoConnectionForRole) {
+					return nil, nil, err
+				}
+
+				switch connection.ClassifyError(err) {
+				case connection.ErrorNotFound:
+					// Transaction not confirmed yet; ask same node again after a while.
+					select {
+					case <-ctx.Done():
+					case <-time.After(a.cfg.NotFoundRetryDelay):
+					}
+				default:
+					if connection.IsPermanentError(err) {
+						return nil, nil, err // Other nodes would answer the same.
+					}
+
+					// Let pool choose another node; failing one may be on cooldown now. Wait anyway, as not every
+					// error puts node on cooldown, and the only node left would be asked again at once.
+					prefer = ""
+					select {
+					case <-ctx.Done():
+					case <-time.After(errorDelay):
+					}
+					errorDelay = min(2*errorDelay, maxErrorRetryDelay)
+				}
 				continue
 			}
 
+			if winner != txCandidate.clientName {
+				fmt.Printf("[%v] TxAnalyzer: transaction fetched from %s instead of %s (tx: %s)\n", time.Now().Format("2006-01-02 15:04:05.000"), winner, txCandidate.clientName, txCandidate.Signature)
+			}
+
 			if rpcTx.Meta.Err != nil {
 				return nil, nil, fmt.Errorf("Transaction failed: %v", rpcTx.Meta.Err)
 			}
@@ -148,10 +195,15 @@ func (a *TxAnalyzer) analyzeInitMarket(rpcTx *rpc.GetTransactionResult, tx *sola
 }
 
 func (a *TxAnalyzer) TokenInfoFromMarket(market serum.MarketInfo) (TokenInfo, error) {
-	Limit := 100
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	Limit := a.cfg.SignatureLimit
+	ctx, cancel := context.WithTimeout(context.Background(), a.cfg.TokenInfoTimeout)
 	defer cancel()
-	sigs, err := a.rpcPool.Client().GetSignaturesForAddressWithOpts(ctx, market.TokenAddress(),
+	backfillClient, err := a.rpcPool.RoleClientForMethod(ctx, connection.RoleBackfill, "getSignaturesForAddress")
+	if err != nil {
+		return TokenInfo{}, err
+	}
+
+	sigs, err := backfillClient.GetSignaturesForAddressWithOpts(ctx, market.TokenAddress(),
 		&rpc.GetSignaturesForAddressOpts{
 			Limit: &Limit,
 		},
@@ -170,7 +222,12 @@ func (a *TxAnalyzer) TokenInfoFromMarket(market serum.MarketInfo) (TokenInfo, er
 		createTime = lastSig.BlockTime.Time()
 	}
 
-	rpcTokenSupply, err := a.rpcPool.Client().GetTokenSupply(ctx, market.TokenAddress(), rpc.CommitmentFinalized)
+	accountsClient, err := a.rpcPool.RoleClientForMethod(ctx, connection.RoleAccountReads, "getTokenSupply")
+	if err != nil {
+		return TokenInfo{}, err
+	}
+
+	rpcTokenSupply, err := accountsClient.GetTokenSupply(ctx, market.TokenAddress(), rpc.CommitmentType(a.cfg.TokenSupplyCommitment))
 	if err != nil {
 		return TokenInfo{}, err
 	}
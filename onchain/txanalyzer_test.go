@@ -0,0 +1,142 @@
+package onchain
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/gagliardetto/solana-go/rpc/jsonrpc"
+	"github.com/patrulek/rayscan/fakerpc"
+)
+
+func TestTxAnalyzerUsesStreamedTransaction(t *testing.T) {
+	cfg, poolCfg := testDefaults(t)
+	pool, servers := newFakePool(t, poolCfg, "node")
+	a := NewTxAnalyzer(pool, cfg)
+
+	streamed := &StreamedTx{
+		Result:      &rpc.GetTransactionResult{Slot: 100, Meta: &rpc.TransactionMeta{LogMessages: openBookLogs}},
+		Transaction: &solana.Transaction{Signatures: []solana.Signature{testSignature(1)}},
+	}
+
+	rpcTx, tx, err := a.getConfirmedTransaction(context.Background(), TxCandidate{testSignature(1), "node", nil, streamed})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rpcTx != streamed.Result || tx != streamed.Transaction {
+		t.Fatalf("expected streamed transaction")
+	}
+
+	if err := servers["node"].AssertCalled("getTransaction", 0); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTxAnalyzerWaitsForTransactionOnObserverNode(t *testing.T) {
+	cfg, poolCfg := testDefaults(t)
+	cfg.NotFoundRetryDelay = 20 * time.Millisecond
+	pool, servers := newFakePool(t, poolCfg, "a", "b")
+	a := NewTxAnalyzer(pool, cfg)
+
+	// Transaction isn't confirmed yet when candidate is found.
+	time.AfterFunc(100*time.Millisecond, func() {
+		servers["b"].SetTransaction(testSignature(1).String(), txResult(t, testSignature(1), openBookLogs))
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	rpcTx, tx, err := a.getConfirmedTransaction(ctx, TxCandidate{testSignature(1), "b", nil, nil})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tx.Signatures[0] != testSignature(1) || len(rpcTx.Meta.LogMessages) != len(openBookLogs) {
+		t.Fatalf("unexpected transaction: %+v", tx)
+	}
+
+	if calls := len(servers["b"].Calls("getTransaction")); calls < 2 {
+		t.Fatalf("expected not found transaction to be asked again, got %d calls", calls)
+	}
+
+	if err := servers["a"].AssertCalled("getTransaction", 0); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTxAnalyzerSkipsFailedTransaction(t *testing.T) {
+	cfg, poolCfg := testDefaults(t)
+	pool, servers := newFakePool(t, poolCfg, "node")
+	a := NewTxAnalyzer(pool, cfg)
+
+	failed := txResult(t, testSignature(1), openBookLogs)
+	failed["meta"] = map[string]interface{}{"err": map[string]interface{}{"InstructionError": []interface{}{0, "Custom"}}, "logMessages": openBookLogs}
+	servers["node"].SetTransaction(testSignature(1).String(), failed)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	if _, _, err := a.getConfirmedTransaction(ctx, TxCandidate{testSignature(1), "node", nil, nil}); err == nil {
+		t.Fatalf("expected error of failed transaction")
+	}
+}
+
+func TestTxAnalyzerGivesUpOnTimeout(t *testing.T) {
+	cfg, poolCfg := testDefaults(t)
+	cfg.NotFoundRetryDelay = 20 * time.Millisecond
+	pool, _ := newFakePool(t, poolCfg, "node")
+	a := NewTxAnalyzer(pool, cfg)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	if _, _, err := a.getConfirmedTransaction(ctx, TxCandidate{testSignature(1), "node", nil, nil}); err != context.DeadlineExceeded {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+}
+
+func TestTxAnalyzerBacksOffOnErrors(t *testing.T) {
+	cfg, poolCfg := testDefaults(t)
+	cfg.NotFoundRetryDelay = 20 * time.Millisecond
+	pool, servers := newFakePool(t, poolCfg, "node")
+	a := NewTxAnalyzer(pool, cfg)
+
+	// Internal error doesn't put node on cooldown, so it's the only node asked again.
+	servers["node"].InjectFault("getTransaction", fakerpc.Fault{RPCError: &jsonrpc.RPCError{Code: -32603, Message: "internal error"}})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+
+	if _, _, err := a.getConfirmedTransaction(ctx, TxCandidate{testSignature(1), "node", nil, nil}); err != context.DeadlineExceeded {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+
+	// Asked after 0, 20, 60 and 140ms; 300ms is over before the next one.
+	if calls := len(servers["node"].Calls("getTransaction")); calls < 2 || calls > 5 {
+		t.Fatalf("expected few backed off calls, got %d", calls)
+	}
+}
+
+func TestTxAnalyzerGivesUpOnInvalidRequest(t *testing.T) {
+	cfg, poolCfg := testDefaults(t)
+	pool, servers := newFakePool(t, poolCfg, "a", "b")
+	a := NewTxAnalyzer(pool, cfg)
+
+	for _, s := range servers {
+		s.InjectFault("getTransaction", fakerpc.Fault{RPCError: &jsonrpc.RPCError{Code: -32602, Message: "invalid params"}})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	if _, _, err := a.getConfirmedTransaction(ctx, TxCandidate{testSignature(1), "a", nil, nil}); err == nil || ctx.Err() != nil {
+		t.Fatalf("expected invalid params error before timeout, got %v", err)
+	}
+
+	if calls := len(servers["a"].Calls("getTransaction")) + len(servers["b"].Calls("getTransaction")); calls > 2 {
+		t.Fatalf("expected invalid request not to be retried, got %d calls", calls)
+	}
+}
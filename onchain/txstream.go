@@ -0,0 +1,244 @@
+package onchain
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/gorilla/websocket"
+	"github.com/patrulek/rayscan/connection"
+)
+
+// How often raw websocket feeds ping the node, so idle connections aren't closed by proxies.
+const wsPingInterval = 20 * time.Second
+
+// txStreamFeed is a blockSubscribe or transactionSubscribe subscription of single program, delivering full transactions.
+// Websocket client doesn't support them (nor maxSupportedTransactionVersion), so raw connection is used.
+type txStreamFeed struct {
+	observer *LogObserver
+	sub      *subscription
+	conn     *websocket.Conn
+
+	once  sync.Once
+	stopC chan struct{}
+}
+
+type wsMessage struct {
+	ID     *uint64         `json:"id"`
+	Method string          `json:"method"`
+	Result json.RawMessage `json:"result"`
+	Error  json.RawMessage `json:"error"`
+	Params struct {
+		Result json.RawMessage `json:"result"`
+	} `json:"params"`
+}
+
+// blockNotification is a result of blockNotification; transactions of block are filtered by mentioned program.
+type blockNotification struct {
+	Value struct {
+		Slot  uint64              `json:"slot"`
+		Err   interface{}         `json:"err"`
+		Block *rpc.GetBlockResult `json:"block"`
+	} `json:"value"`
+}
+
+// transactionNotification is a result of transactionNotification.
+type transactionNotification struct {
+	Signature   solana.Signature        `json:"signature"`
+	Slot        uint64                  `json:"slot"`
+	Transaction rpc.TransactionWithMeta `json:"transaction"`
+}
+
+// openTxStream subscribes for blocks or transactions mentioning program of given subscription on new websocket connection.
+func (o *LogObserver) openTxStream(ctx context.Context, conn *connection.Connection, kind SourceKind, sub *subscription) (feed, error) {
+	options := map[string]interface{}{
+		"commitment":                     sub.Commitment,
+		"encoding":                       solana.EncodingBase64,
+		"transactionDetails":             rpc.TransactionDetailsFull,
+		"maxSupportedTransactionVersion": o.cfg.MaxTransactionVersion,
+	}
+
+	var method string
+	var params []interface{}
+	switch kind {
+	case SourceBlocks:
+		// Blocks aren't sent for processed commitment.
+		if sub.Commitment == rpc.CommitmentProcessed {
+			options["commitment"] = rpc.CommitmentConfirmed
+		}
+		options["showRewards"] = false
+
+		method = "blockSubscribe"
+		params = []interface{}{map[string]interface{}{"mentionsAccountOrProgram": sub.ProgramID}, options}
+	case SourceTransactions:
+		method = "transactionSubscribe"
+		params = []interface{}{map[string]interface{}{"accountInclude": []solana.PublicKey{sub.ProgramID}, "vote": false, "failed": false}, options}
+	default:
+		return nil, fmt.Errorf("unsupported transaction stream: %s", kind)
+	}
+
+	wsConn, err := conn.DialWSConn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := subscribeWS(ctx, wsConn, method, params); err != nil {
+		wsConn.Close()
+		return nil, err
+	}
+
+	f := &txStreamFeed{observer: o, sub: sub, conn: wsConn, stopC: make(chan struct{})}
+	go keepAlive(wsConn, f.stopC)
+
+	return f, nil
+}
+
+// subscribeWS sends subscribe request on raw websocket connection and waits for its response.
+func subscribeWS(ctx context.Context, conn *websocket.Conn, method string, params []interface{}) error {
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetReadDeadline(deadline)
+		conn.SetWriteDeadline(deadline)
+		defer conn.SetReadDeadline(time.Time{})
+		defer conn.SetWriteDeadline(time.Time{})
+	}
+
+	err := conn.WriteJSON(map[string]interface{}{"jsonrpc": "2.0", "id": 1, "method": method, "params": params})
+	if err != nil {
+		return err
+	}
+
+	for {
+		var msg wsMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			return err
+		}
+
+		if msg.ID == nil || *msg.ID != 1 {
+			continue // Not a response.
+		}
+
+		if len(msg.Error) > 0 && string(msg.Error) != "null" {
+			return fmt.Errorf("%s failed: %s", method, msg.Error)
+		}
+
+		return nil
+	}
+}
+
+// keepAlive pings the node over raw websocket connection until stopC is closed.
+func keepAlive(conn *websocket.Conn, stopC <-chan struct{}) {
+	ticker := time.NewTicker(wsPingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopC:
+			return
+		case <-ticker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsPingInterval)); err != nil {
+				return // Connection is broken; recv fails too.
+			}
+		}
+	}
+}
+
+func (f *txStreamFeed) recv(txCandidatePublishC chan<- TxCandidate) (bool, error) {
+	var msg wsMessage
+	if err := f.conn.ReadJSON(&msg); err != nil {
+		return false, err
+	}
+
+	var txs []*StreamedTx
+	var err error
+	switch msg.Method {
+	case "blockNotification":
+		txs, err = blockTransactions(msg.Params.Result)
+	case "transactionNotification":
+		txs, err = notificationTransaction(msg.Params.Result)
+	default:
+		return false, nil // Not a notification.
+	}
+
+	if err != nil {
+		fmt.Printf("[%v] LogObserver: Error decoding %s of %s program on %s: %v\n", time.Now().Format("2006-01-02 15:04:05.000"), msg.Method, f.sub.Name, f.observer.connName, err)
+		return true, nil
+	}
+
+	for _, tx := range txs {
+		f.observer.handleStreamedTx([]string{f.sub.Name}, tx, txCandidatePublishC)
+	}
+
+	return true, nil
+}
+
+func (f *txStreamFeed) close() {
+	f.once.Do(func() {
+		close(f.stopC)
+		f.conn.Close()
+	})
+}
+
+// blockTransactions decodes transactions of block notification.
+func blockTransactions(result json.RawMessage) ([]*StreamedTx, error) {
+	var notification blockNotification
+	if err := json.Unmarshal(result, &notification); err != nil {
+		return nil, err
+	}
+
+	block := notification.Value.Block
+	if notification.Value.Err != nil || block == nil {
+		return nil, nil // Block couldn't be read by node; its transactions are found by gap fill, if needed.
+	}
+
+	blockTime := block.BlockTime
+	if blockTime == nil {
+		now := solana.UnixTimeSeconds(time.Now().Unix())
+		blockTime = &now
+	}
+
+	txs := make([]*StreamedTx, 0, len(block.Transactions))
+	for _, txWithMeta := range block.Transactions {
+		if txWithMeta.Meta == nil || txWithMeta.Transaction == nil {
+			continue
+		}
+
+		tx, err := txWithMeta.GetTransaction()
+		if err != nil {
+			return nil, err
+		}
+
+		txs = append(txs, &StreamedTx{
+			Result:      &rpc.GetTransactionResult{Slot: notification.Value.Slot, BlockTime: blockTime, Meta: txWithMeta.Meta, Version: txWithMeta.Version},
+			Transaction: tx,
+		})
+	}
+
+	return txs, nil
+}
+
+// notificationTransaction decodes transaction of transaction notification; it has no block time, so time of receipt is used.
+func notificationTransaction(result json.RawMessage) ([]*StreamedTx, error) {
+	var notification transactionNotification
+	if err := json.Unmarshal(result, &notification); err != nil {
+		return nil, err
+	}
+
+	if notification.Transaction.Meta == nil || notification.Transaction.Transaction == nil {
+		return nil, nil
+	}
+
+	tx, err := notification.Transaction.GetTransaction()
+	if err != nil {
+		return nil, err
+	}
+
+	blockTime := solana.UnixTimeSeconds(time.Now().Unix())
+	return []*StreamedTx{{
+		Result:      &rpc.GetTransactionResult{Slot: notification.Slot, BlockTime: &blockTime, Meta: notification.Transaction.Meta, Version: notification.Transaction.Version},
+		Transaction: tx,
+	}}, nil
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/patrulek/rayscan/config"
+	"github.com/patrulek/rayscan/connection"
+	"github.com/patrulek/rayscan/onchain"
+	"github.com/patrulek/rayscan/replay"
+	"github.com/patrulek/rayscan/trading"
+)
+
+// How often config file is checked for changes.
+const configWatchInterval = 2 * time.Second
+
+// observerSet holds running observer sources by connection name.
+type observerSet struct {
+	rpcPool      *connection.RPCPool
+	cfg          config.Pipeline
+	recorder     *replay.Recorder
+	dedup        *onchain.SignatureDedup
+	txCandidateC chan<- onchain.TxCandidate
+
+	mu        sync.Mutex
+	observers map[string]onchain.Source
+}
+
+func newObserverSet(rpcPool *connection.RPCPool, cfg config.Pipeline, recorder *replay.Recorder, dedup *onchain.SignatureDedup, txCandidateC chan<- onchain.TxCandidate) *observerSet {
+	return &observerSet{
+		rpcPool:      rpcPool,
+		cfg:          cfg,
+		recorder:     recorder,
+		dedup:        dedup,
+		txCandidateC: txCandidateC,
+		observers:    make(map[string]onchain.Source),
+	}
+}
+
+// start starts source of given connection, selected by its config, if it has observer role, is healthy and isn't observed yet.
+// Skipped unhealthy connection is started by handleHealth once it's back in rotation.
+func (s *observerSet) start(ctx context.Context, conn *connection.Connection) error {
+	name := conn.ConnectionInfo.Name
+	if !conn.HasRole(connection.RoleObserver) || s.running(name) {
+		return nil
+	}
+
+	if !conn.Healthy() {
+		fmt.Printf("Skipping %s log observer; connection is unhealthy (reason: %s)\n", name, conn.HealthReason())
+		return nil
+	}
+
+	var recorder onchain.LogRecorder
+	if s.recorder != nil {
+		recorder = s.recorder
+	}
+
+	return s.add(ctx, onchain.NewNodeSource(s.rpcPool, conn.ConnectionInfo, s.cfg, s.dedup, onchain.DefaultSubscriptions(), recorder))
+}
+
+// add starts given source and holds it until it's stopped. Source is stopped again if another one of the same
+// connection was started in the meantime (eg. by reload and health event at once).
+func (s *observerSet) add(ctx context.Context, src onchain.Source) error {
+	if err := src.Start(ctx, s.txCandidateC); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	_, exists := s.observers[src.ConnectionName()]
+	if !exists {
+		s.observers[src.ConnectionName()] = src
+	}
+	s.mu.Unlock()
+
+	if exists {
+		return src.Stop(ctx)
+	}
+
+	return nil
+}
+
+// running tells if source of given connection is running.
+func (s *observerSet) running(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.observers[name]
+	return ok
+}
+
+// handleHealth starts observer of connection brought back into rotation. Observers of connections taken out of rotation
+// keep running; they reconnect on their own and their duplicates are dropped by dedup.
+func (s *observerSet) handleHealth(event connection.HealthEvent) {
+	if !event.Healthy {
+		return
+	}
+
+	conn, err := s.rpcPool.NamedConnection(event.Connection)
+	if err != nil {
+		return // Removed by reload.
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.cfg.StartTimeout)
+	defer cancel()
+
+	if err := s.start(ctx, conn); err != nil {
+		fmt.Printf("Error starting %s log observer: %s\n", event.Connection, err)
+	}
+}
+
+// stop stops source of given connection, if it's running.
+func (s *observerSet) stop(ctx context.Context, name string) {
+	s.mu.Lock()
+	obs, ok := s.observers[name]
+	delete(s.observers, name)
+	s.mu.Unlock()
+
+	if !ok {
+		return
+	}
+
+	if err := obs.Stop(ctx); err != nil {
+		fmt.Printf("Error stopping %s log observer: %s\n", name, err)
+	}
+
+	for program, stats := range obs.Stats() {
+		fmt.Printf("Observer %s %s subscription stats: received: %d, candidates: %d (gap filled: %d), reconnects: %d (idle: %d), last message: %v\n",
+			name, program, stats.Received, stats.Candidates, stats.GapFilled, stats.Reconnects, stats.IdleTimeout, stats.LastMessage.Format("2006-01-02 15:04:05.000"))
+	}
+}
+
+func (s *observerSet) stopAll(ctx context.Context) {
+	s.mu.Lock()
+	names := make([]string, 0, len(s.observers))
+	for name := range s.observers {
+		names = append(names, name)
+	}
+	s.mu.Unlock()
+
+	for _, name := range names {
+		s.stop(ctx, name)
+	}
+}
+
+// reloader applies changes of config file on SIGHUP or when the file is modified.
+// Nodes, pool settings and trading rules are applied live; other changes require restart.
+type reloader struct {
+	path            string
+	cfg             config.Config
+	modTime         time.Time
+	rpcPool         *connection.RPCPool
+	observers       *observerSet
+	paperEngine     *trading.PaperEngine
+	positionManager *trading.PositionManager
+
+	stopC chan struct{}
+	doneC chan struct{}
+}
+
+func newReloader(path string, cfg config.Config, rpcPool *connection.RPCPool, observers *observerSet, paperEngine *trading.PaperEngine, positionManager *trading.PositionManager) *reloader {
+	r := &reloader{
+		path:            path,
+		cfg:             cfg,
+		rpcPool:         rpcPool,
+		observers:       observers,
+		paperEngine:     paperEngine,
+		positionManager: positionManager,
+		stopC:           make(chan struct{}),
+		doneC:           make(chan struct{}),
+	}
+
+	if info, err := os.Stat(path); err == nil {
+		r.modTime = info.ModTime()
+	}
+
+	return r
+}
+
+func (r *reloader) Start() {
+	hupC := make(chan os.Signal, 1)
+	signal.Notify(hupC, syscall.SIGHUP)
+
+	go func() {
+		defer close(r.doneC)
+		defer signal.Stop(hupC)
+
+		ticker := time.NewTicker(configWatchInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-r.stopC:
+				return
+			case <-hupC:
+				r.reload("SIGHUP")
+			case <-ticker.C:
+				info, err := os.Stat(r.path)
+				if err != nil || info.ModTime().Equal(r.modTime) {
+					continue
+				}
+
+				r.modTime = info.ModTime()
+				r.reload("file changed")
+			}
+		}
+	}()
+}
+
+func (r *reloader) reload(reason string) {
+	fmt.Printf("[%v] Reloading config %s (reason: %s)...\n", time.Now().Format("2006-01-02 15:04:05.000"), r.path, reason)
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Printf("[%v] Error reloading config; keeping previous one: %s\n", time.Now().Format("2006-01-02 15:04:05.000"), err)
+		return
+	}
+
+	if reflect.DeepEqual(cfg, r.cfg) {
+		fmt.Printf("[%v] Config unchanged\n", time.Now().Format("2006-01-02 15:04:05.000"))
+		return
+	}
+
+	if restart := restartRequired(r.cfg, cfg); len(restart) > 0 {
+		fmt.Printf("[%v] Changes of %s require restart; ignoring them\n", time.Now().Format("2006-01-02 15:04:05.000"), strings.Join(restart, ", "))
+	}
+
+	result, err := r.rpcPool.Reload(cfg.Nodes, cfg.Pool)
+	if err != nil {
+		fmt.Printf("[%v] Error reloading connections; keeping previous ones: %s\n", time.Now().Format("2006-01-02 15:04:05.000"), err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.cfg.Pipeline.ShutdownTimeout)
+	for _, conn := range result.Removed {
+		r.observers.stop(ctx, conn.ConnectionInfo.Name)
+	}
+	cancel()
+
+	ctx, cancel = context.WithTimeout(context.Background(), r.cfg.Pipeline.StartTimeout)
+	for _, conn := range result.Added {
+		if err := r.observers.start(ctx, conn); err != nil {
+			fmt.Printf("[%v] Error starting %s log observer: %s\n", time.Now().Format("2006-01-02 15:04:05.000"), conn.ConnectionInfo.Name, err)
+		}
+	}
+	cancel()
+
+	if r.paperEngine != nil {
+		r.paperEngine.SetEntryRules(trading.EntryRulesFromConfig(cfg.Trading))
+	}
+
+	if r.positionManager != nil {
+		r.positionManager.SetExitRules(trading.ExitRulesFromConfig(cfg.Trading))
+	}
+
+	// Keep settings that weren't applied, so they're reported again on next reload.
+	applied := r.cfg
+	applied.Nodes, applied.Pool.Strategy, applied.Pool.CriticalStrategy, applied.Pool.Base, applied.Pool.Hedge = cfg.Nodes, cfg.Pool.Strategy, cfg.Pool.CriticalStrategy, cfg.Pool.Base, cfg.Pool.Hedge
+	applied.Trading = withRules(applied.Trading, cfg.Trading)
+	r.cfg = applied
+
+	fmt.Printf("[%v] Config reloaded (added connections: %d, removed connections: %d)\n", time.Now().Format("2006-01-02 15:04:05.000"), len(result.Added), len(result.Removed))
+}
+
+// restartRequired returns keys of settings that changed, but can't be applied without restart.
+func restartRequired(prev, next config.Config) []string {
+	var keys []string
+
+	if !reflect.DeepEqual(prev.Pipeline, next.Pipeline) {
+		keys = append(keys, "pipeline")
+	}
+
+	if prev.Pool.HealthInterval != next.Pool.HealthInterval || prev.Pool.MaxSlotLag != next.Pool.MaxSlotLag || prev.Pool.MaxLatency != next.Pool.MaxLatency {
+		keys = append(keys, "pool health checks")
+	}
+
+	if withRules(prev.Trading, next.Trading) != next.Trading {
+		keys = append(keys, "trading settings other than entry/exit rules")
+	}
+
+	return keys
+}
+
+// withRules returns trading settings with entry and exit rules taken from other settings.
+func withRules(t, rules config.Trading) config.Trading {
+	t.MinLiquidity, t.MaxOpenDelay, t.MaxOpenPositions = rules.MinLiquidity, rules.MaxOpenDelay, rules.MaxOpenPositions
+	t.TakeProfit, t.StopLoss, t.TrailingStop, t.MaxHoldTime = rules.TakeProfit, rules.StopLoss, rules.TrailingStop, rules.MaxHoldTime
+	return t
+}
+
+func (r *reloader) Stop() {
+	close(r.stopC)
+	<-r.doneC
+}
@@ -0,0 +1,227 @@
+package replay
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/gagliardetto/solana-go/rpc/jsonrpc"
+	"github.com/gagliardetto/solana-go/rpc/ws"
+	"github.com/patrulek/rayscan/config"
+	"github.com/patrulek/rayscan/connection"
+)
+
+// LogHandler receives replayed log message together with name of connection and program it was recorded for.
+type LogHandler func(connName, program string, log *ws.LogResult)
+
+// Player feeds recorded logs back with original (or scaled) timing and serves recorded RPC responses.
+type Player struct {
+	logs []Record
+
+	mu        sync.Mutex
+	responses map[string][]Record // rpcKey -> responses in recorded order
+	served    map[string]int      // rpcKey -> number of responses served
+}
+
+func LoadPlayer(path string) (*Player, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	p := &Player{
+		responses: make(map[string][]Record),
+		served:    make(map[string]int),
+	}
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 1024*1024), 64*1024*1024)
+
+	for line := 1; scanner.Scan(); line++ {
+		var rec Record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("error parsing record at line %d: %w", line, err)
+		}
+
+		switch rec.Kind {
+		case KindLog:
+			p.logs = append(p.logs, rec)
+		case KindRPC:
+			key := rpcKey(rec.Method, rec.Params)
+			p.responses[key] = append(p.responses[key], rec)
+		default:
+			return nil, fmt.Errorf("unknown record kind at line %d: %s", line, rec.Kind)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	// Records are written concurrently, so keep them ordered by receive time.
+	sort.SliceStable(p.logs, func(i, j int) bool {
+		return p.logs[i].Time.Before(p.logs[j].Time)
+	})
+
+	return p, nil
+}
+
+// Connections returns names of connections that recorded logs came from.
+func (p *Player) Connections() []string {
+	var names []string
+	seen := make(map[string]struct{})
+
+	for _, rec := range p.logs {
+		if _, ok := seen[rec.Connection]; ok {
+			continue
+		}
+
+		seen[rec.Connection] = struct{}{}
+		names = append(names, rec.Connection)
+	}
+
+	return names
+}
+
+// Logs returns recorded log records ordered by receive time.
+func (p *Player) Logs() []Record {
+	return append([]Record(nil), p.logs...)
+}
+
+// Responses returns recorded responses of given method ordered by receive time.
+func (p *Player) Responses(method string) []Record {
+	var records []Record
+	for _, responses := range p.responses {
+		if len(responses) > 0 && responses[0].Method == method {
+			records = append(records, responses...)
+		}
+	}
+
+	sort.SliceStable(records, func(i, j int) bool {
+		if !records[i].Time.Equal(records[j].Time) {
+			return records[i].Time.Before(records[j].Time)
+		}
+		return string(records[i].Params) < string(records[j].Params) // Keep order of responses of different requests deterministic.
+	})
+
+	return records
+}
+
+// RPCPool returns pool with a connection for each recorded observer; all of them serve recorded responses.
+func (p *Player) RPCPool() *connection.RPCPool {
+	var pool connection.RPCPool
+
+	for _, name := range p.Connections() {
+		pool.Connections = append(pool.Connections, &connection.Connection{
+			ConnectionInfo: config.RPCNode{Name: name, Observer: true},
+			RPCClient:      rpc.NewWithCustomRPCClient(&replayClient{player: p}),
+		})
+	}
+
+	return &pool
+}
+
+// Play passes recorded logs to handler. Delays between logs are divided by speed; zero speed replays without delays.
+func (p *Player) Play(ctx context.Context, speed float64, handle LogHandler) error {
+	return p.play(ctx, speed, "", handle)
+}
+
+// play passes recorded logs of given connection (all if empty) to handler, keeping their (scaled) timing
+// relative to the first recorded log, so logs of connections played separately keep their order.
+func (p *Player) play(ctx context.Context, speed float64, connName string, handle LogHandler) error {
+	start := time.Now()
+
+	for _, rec := range p.logs {
+		if connName != "" && rec.Connection != connName {
+			continue
+		}
+
+		if speed > 0 {
+			delay := time.Duration(float64(rec.Time.Sub(p.logs[0].Time))/speed) - time.Since(start)
+
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		var log ws.LogResult
+		if err := json.Unmarshal(rec.Log, &log); err != nil {
+			return fmt.Errorf("error parsing recorded log: %w", err)
+		}
+
+		handle(rec.Connection, rec.Program, &log)
+	}
+
+	return nil
+}
+
+// response returns next recorded response for given request; last one is repeated once all were served.
+func (p *Player) response(method string, params []interface{}) (Record, error) {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return Record{}, err
+	}
+
+	key := rpcKey(method, data)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	responses := p.responses[key]
+	if len(responses) == 0 {
+		return Record{}, fmt.Errorf("no recorded response for %s %s", method, data)
+	}
+
+	idx := p.served[key]
+	if idx >= len(responses) {
+		idx = len(responses) - 1
+	}
+
+	p.served[key]++
+	return responses[idx], nil
+}
+
+type replayClient struct {
+	player *Player
+}
+
+func (c *replayClient) CallForInto(ctx context.Context, out interface{}, method string, params []interface{}) error {
+	rec, err := c.player.response(method, params)
+	if err != nil {
+		return err
+	}
+
+	if rec.RPCError != nil {
+		return rec.RPCError
+	}
+
+	if rec.Error != "" {
+		return errors.New(rec.Error)
+	}
+
+	result := rec.Result
+	if result == nil {
+		result = json.RawMessage("null")
+	}
+
+	return json.Unmarshal(result, out)
+}
+
+func (c *replayClient) CallWithCallback(ctx context.Context, method string, params []interface{}, callback func(*http.Request, *http.Response) error) error {
+	return fmt.Errorf("replay: %s with callback is not supported", method)
+}
+
+func (c *replayClient) CallBatch(ctx context.Context, requests jsonrpc.RPCRequests) (jsonrpc.RPCResponses, error) {
+	return nil, fmt.Errorf("replay: batch calls are not supported")
+}
@@ -0,0 +1,161 @@
+package replay
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc/ws"
+	"github.com/patrulek/rayscan/config"
+	"github.com/patrulek/rayscan/onchain"
+)
+
+// openBookLogs are logs matched as InitializeMarket candidate.
+var openBookLogs = []string{
+	"Program 11111111111111111111111111111111 invoke [1]",
+	"Program 11111111111111111111111111111111 success",
+	"Program srmqPvymJeFKQ4zGQed1GFppgkRHL9kaELCbyksJtPX invoke [1]",
+	"Program srmqPvymJeFKQ4zGQed1GFppgkRHL9kaELCbyksJtPX success",
+}
+
+func testSignature(seed byte) solana.Signature {
+	var sig solana.Signature
+	for i := range sig {
+		sig[i] = seed
+	}
+
+	return sig
+}
+
+func logRecord(t *testing.T, connName string, at time.Time, sig solana.Signature, failed bool) Record {
+	t.Helper()
+
+	log := &ws.LogResult{}
+	log.Value.Signature = sig
+	log.Value.Logs = openBookLogs
+	if failed {
+		log.Value.Err = map[string]interface{}{"InstructionError": []interface{}{0, "Custom"}}
+	}
+
+	data, err := json.Marshal(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return Record{Kind: KindLog, Time: at, Connection: connName, Program: onchain.ProgramOpenBook, Log: data}
+}
+
+// writeRecords writes records to a recording file in given order and loads it.
+func writeRecords(t *testing.T, records []Record) *Player {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "recording.jsonl")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	enc := json.NewEncoder(f)
+	for _, rec := range records {
+		if err := enc.Encode(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	player, err := LoadPlayer(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return player
+}
+
+func TestPlayerPlaysLogsByReceiveTime(t *testing.T) {
+	start := time.Now()
+
+	// Records are written concurrently, so they may be stored out of order.
+	var records []Record
+	for i := 9; i >= 0; i-- {
+		records = append(records, logRecord(t, "node", start.Add(time.Duration(i)*time.Millisecond), testSignature(byte(i+1)), false))
+	}
+
+	player := writeRecords(t, records)
+
+	var played []solana.Signature
+	err := player.Play(context.Background(), 0, func(_, _ string, log *ws.LogResult) {
+		played = append(played, log.Value.Signature)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(played) != 10 {
+		t.Fatalf("expected 10 logs, got %d", len(played))
+	}
+
+	for i, sig := range played {
+		if sig != testSignature(byte(i+1)) {
+			t.Fatalf("log %d played out of order: %s", i, sig)
+		}
+	}
+}
+
+func TestSourcePublishesCandidatesInRecordedOrder(t *testing.T) {
+	const connName = "node"
+	start := time.Now()
+
+	var records []Record
+	for i := 0; i < 50; i++ {
+		records = append(records, logRecord(t, connName, start.Add(time.Duration(i)*time.Microsecond), testSignature(byte(i+1)), i%10 == 9))
+	}
+
+	player := writeRecords(t, records)
+
+	cfg := config.Pipeline{DedupSize: 1000, DedupTTL: time.Hour}
+	dedup := onchain.NewSignatureDedup(cfg)
+	observer := onchain.NewLogObserver(player.RPCPool(), connName, cfg, dedup, []onchain.ProgramSubscription{onchain.OpenBookSubscription()})
+	source := player.Source(observer, dedup, 0)
+
+	candidateC := make(chan onchain.TxCandidate) // Unbuffered, so concurrent sends would be received in random order.
+	if err := source.Start(context.Background(), candidateC); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		if err := source.Stop(ctx); err != nil {
+			t.Errorf("stop: %v", err)
+		}
+	}()
+
+	for i := 0; i < 50; i++ {
+		if i%10 == 9 {
+			continue // Failed transaction.
+		}
+
+		select {
+		case candidate := <-candidateC:
+			if want := testSignature(byte(i + 1)); candidate.Signature != want {
+				t.Fatalf("candidate %d out of order: got %s, want %s", i, candidate.Signature, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("candidate %d not published", i)
+		}
+	}
+
+	select {
+	case candidate := <-candidateC:
+		t.Fatalf("unexpected candidate: %s", candidate.Signature)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,39 @@
+package replay
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gagliardetto/solana-go/rpc/jsonrpc"
+)
+
+type RecordKind string
+
+const (
+	KindLog RecordKind = "log" // Raw ws.LogResult received by LogObserver.
+	KindRPC RecordKind = "rpc" // JSON-RPC response (eg. getTransaction).
+)
+
+// Record is a single recorded event; records are stored one per line as JSON.
+type Record struct {
+	Kind       RecordKind
+	Time       time.Time // Time the event was received.
+	Connection string    // Name of connection the event was received from.
+
+	// Log record fields.
+	Program string          `json:",omitempty"` // Program which logs were subscribed for.
+	Log     json.RawMessage `json:",omitempty"`
+
+	// RPC record fields.
+	Method   string            `json:",omitempty"`
+	Params   json.RawMessage   `json:",omitempty"`
+	Result   json.RawMessage   `json:",omitempty"`
+	RPCError *jsonrpc.RPCError `json:",omitempty"` // Error returned by node.
+	Error    string            `json:",omitempty"` // Transport error (eg. timeout).
+}
+
+// rpcKey identifies RPC request by method and params. Connection is not a part of key, because
+// requests can be routed to different connections than during recording (eg. TxAnalyzer retries).
+func rpcKey(method string, params json.RawMessage) string {
+	return method + "|" + string(params)
+}
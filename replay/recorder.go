@@ -0,0 +1,135 @@
+package replay
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/gagliardetto/solana-go/rpc/jsonrpc"
+	"github.com/gagliardetto/solana-go/rpc/ws"
+	"github.com/patrulek/rayscan/connection"
+)
+
+// Recorder writes observed logs and RPC responses to a file, so they can be replayed later by Player.
+type Recorder struct {
+	mu  sync.Mutex
+	f   *os.File
+	enc *json.Encoder
+}
+
+func NewRecorder(path string) (*Recorder, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Recorder{
+		f:   f,
+		enc: json.NewEncoder(f),
+	}, nil
+}
+
+// RecordLog stores raw log message received by LogObserver.
+func (r *Recorder) RecordLog(connName, program string, log *ws.LogResult) {
+	data, err := json.Marshal(log)
+	if err != nil {
+		fmt.Printf("[%v] Recorder: error marshaling log (tx: %s): %s\n", time.Now().Format("2006-01-02 15:04:05.000"), log.Value.Signature, err)
+		return
+	}
+
+	r.record(Record{
+		Kind:       KindLog,
+		Time:       time.Now(),
+		Connection: connName,
+		Program:    program,
+		Log:        data,
+	})
+}
+
+func (r *Recorder) record(rec Record) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.enc.Encode(rec); err != nil {
+		fmt.Printf("[%v] Recorder: error writing record: %s\n", time.Now().Format("2006-01-02 15:04:05.000"), err)
+	}
+}
+
+// Wrap makes RPC clients of all pool connections record every response.
+func (r *Recorder) Wrap(pool *connection.RPCPool) {
+	for _, c := range pool.ConnectionList() {
+		r.wrapConnection(c)
+	}
+
+	pool.SetConnectHook(r.wrapConnection) // Connections added by config reload.
+}
+
+func (r *Recorder) wrapConnection(c *connection.Connection) {
+	connName := c.ConnectionInfo.Name
+	c.WrapRPCClient(func(client rpc.JSONRPCClient) rpc.JSONRPCClient {
+		return &recordingClient{
+			JSONRPCClient: client,
+			recorder:      r,
+			connName:      connName,
+		}
+	})
+}
+
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.f.Close()
+}
+
+type recordingClient struct {
+	rpc.JSONRPCClient
+	recorder *Recorder
+	connName string
+}
+
+func (c *recordingClient) CallForInto(ctx context.Context, out interface{}, method string, params []interface{}) error {
+	var result json.RawMessage
+	err := c.JSONRPCClient.CallForInto(ctx, &result, method, params)
+
+	rec := Record{
+		Kind:       KindRPC,
+		Time:       time.Now(),
+		Connection: c.connName,
+		Method:     method,
+		Result:     result,
+	}
+
+	rec.Params, _ = json.Marshal(params)
+
+	if rpcErr, ok := err.(*jsonrpc.RPCError); ok {
+		rec.RPCError = rpcErr
+	} else if err != nil {
+		rec.Error = err.Error()
+	}
+
+	c.recorder.record(rec)
+
+	if err != nil {
+		return err
+	}
+
+	if result == nil {
+		result = json.RawMessage("null")
+	}
+
+	return json.Unmarshal(result, out)
+}
+
+func (c *recordingClient) Close() error {
+	if closer, ok := c.JSONRPCClient.(io.Closer); ok {
+		return closer.Close()
+	}
+
+	return nil
+}
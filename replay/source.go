@@ -0,0 +1,92 @@
+package replay
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/gagliardetto/solana-go/rpc/ws"
+	"github.com/patrulek/rayscan/onchain"
+)
+
+// Source is an onchain.Source of single connection that plays logs recorded from it; they are analyzed by given observer.
+type Source struct {
+	player   *Player
+	observer *onchain.LogObserver
+	dedup    *onchain.SignatureDedup
+	speed    float64
+
+	cancel  context.CancelFunc
+	doneC   chan struct{}
+	running atomic.Bool
+}
+
+var _ onchain.Source = (*Source)(nil)
+
+// Source returns source of connection of given observer, playing its logs with given speed (see Play).
+func (p *Player) Source(observer *onchain.LogObserver, dedup *onchain.SignatureDedup, speed float64) *Source {
+	return &Source{
+		player:   p,
+		observer: observer,
+		dedup:    dedup,
+		speed:    speed,
+		doneC:    make(chan struct{}),
+	}
+}
+
+func (s *Source) ConnectionName() string {
+	return s.observer.ConnectionName()
+}
+
+func (s *Source) Kind() onchain.SourceKind {
+	return onchain.SourceReplay
+}
+
+// Start starts playing logs; ctx isn't used, as nothing is opened.
+func (s *Source) Start(_ context.Context, txCandidatePublishC chan<- onchain.TxCandidate) error {
+	if !s.running.CompareAndSwap(false, true) {
+		return fmt.Errorf("replay source is already running")
+	}
+
+	s.dedup.Register(s.ConnectionName())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+
+	go func() {
+		defer close(s.doneC)
+
+		err := s.player.play(ctx, s.speed, s.ConnectionName(), func(_, program string, log *ws.LogResult) {
+			s.observer.HandleLog(program, log, txCandidatePublishC)
+		})
+		fmt.Printf("[%v] Replay of %s finished (err: %v); interrupt to exit\n", time.Now().Format("2006-01-02 15:04:05.000"), s.ConnectionName(), err)
+	}()
+
+	return nil
+}
+
+// DegradedSince returns zero time; recording doesn't break.
+func (s *Source) DegradedSince() time.Time {
+	return time.Time{}
+}
+
+func (s *Source) Stats() map[string]onchain.SubscriptionStats {
+	return s.observer.Stats()
+}
+
+func (s *Source) Stop(ctx context.Context) error {
+	if !s.running.CompareAndSwap(true, false) {
+		return fmt.Errorf("replay source is not running")
+	}
+
+	s.cancel()
+	s.dedup.Unregister(s.ConnectionName())
+
+	select {
+	case <-s.doneC:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,70 @@
+package trading
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/patrulek/rayscan/config"
+	"github.com/patrulek/rayscan/onchain"
+)
+
+// ErrEntryRejected is returned when pair doesn't pass entry rules.
+var ErrEntryRejected = errors.New("entry rejected")
+
+// EntryRule decides whether pair should be entered; returned error is a reason of skipping it.
+type EntryRule interface {
+	Check(pair *onchain.PairInfo, openPositions int, now time.Time) error
+}
+
+// MinLiquidity skips pairs with initial pooled lamports lower than given amount.
+type MinLiquidity uint64
+
+func (r MinLiquidity) Check(pair *onchain.PairInfo, openPositions int, now time.Time) error {
+	if pooled := pair.AmmInfo.InitialLiveInfo.PooledLamports; pooled < float64(r) {
+		return fmt.Errorf("liquidity too low (%.0f < %.0f)", pooled, float64(r))
+	}
+
+	return nil
+}
+
+// MaxOpenDelay skips pairs that open for trading later than given duration from now.
+type MaxOpenDelay time.Duration
+
+func (r MaxOpenDelay) Check(pair *onchain.PairInfo, openPositions int, now time.Time) error {
+	if delay := pair.AmmInfo.InitialLiveInfo.UpdateTime.Sub(now); delay > time.Duration(r) {
+		return fmt.Errorf("opens too late (in %v)", delay.Round(time.Second))
+	}
+
+	return nil
+}
+
+// MaxOpenPositions skips pairs if there is already given number of open positions.
+type MaxOpenPositions int
+
+func (r MaxOpenPositions) Check(pair *onchain.PairInfo, openPositions int, now time.Time) error {
+	if openPositions >= int(r) {
+		return fmt.Errorf("too many open positions (%d)", openPositions)
+	}
+
+	return nil
+}
+
+// EntryRulesFromConfig creates entry rules enabled in config.
+func EntryRulesFromConfig(cfg config.Trading) []EntryRule {
+	var rules []EntryRule
+
+	if cfg.MinLiquidity > 0 {
+		rules = append(rules, MinLiquidity(cfg.MinLiquidity))
+	}
+
+	if cfg.MaxOpenDelay > 0 {
+		rules = append(rules, MaxOpenDelay(cfg.MaxOpenDelay))
+	}
+
+	if cfg.MaxOpenPositions > 0 {
+		rules = append(rules, MaxOpenPositions(cfg.MaxOpenPositions))
+	}
+
+	return rules
+}
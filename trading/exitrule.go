@@ -0,0 +1,80 @@
+package trading
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/patrulek/rayscan/config"
+)
+
+// ExitRule decides whether position should be closed; returned string is a reason of exit.
+type ExitRule interface {
+	ShouldExit(position *Position, now time.Time) (bool, string)
+}
+
+// TakeProfit exits when position value grows by given fraction of its cost.
+type TakeProfit float64
+
+func (r TakeProfit) ShouldExit(position *Position, now time.Time) (bool, string) {
+	if position.Value() >= position.Cost*(1+float64(r)) {
+		return true, fmt.Sprintf("take profit (+%.0f%%)", float64(r)*100)
+	}
+
+	return false, ""
+}
+
+// StopLoss exits when position value drops by given fraction of its cost.
+type StopLoss float64
+
+func (r StopLoss) ShouldExit(position *Position, now time.Time) (bool, string) {
+	if position.Value() <= position.Cost*(1-float64(r)) {
+		return true, fmt.Sprintf("stop loss (-%.0f%%)", float64(r)*100)
+	}
+
+	return false, ""
+}
+
+// TrailingStop exits when position value drops by given fraction of its highest observed value.
+type TrailingStop float64
+
+func (r TrailingStop) ShouldExit(position *Position, now time.Time) (bool, string) {
+	if position.PeakValue > 0 && position.Value() <= position.PeakValue*(1-float64(r)) {
+		return true, fmt.Sprintf("trailing stop (-%.0f%% from peak)", float64(r)*100)
+	}
+
+	return false, ""
+}
+
+// TimeExit exits when position is held longer than given duration.
+type TimeExit time.Duration
+
+func (r TimeExit) ShouldExit(position *Position, now time.Time) (bool, string) {
+	if now.Sub(position.OpenTime) >= time.Duration(r) {
+		return true, fmt.Sprintf("max hold time (%v)", time.Duration(r))
+	}
+
+	return false, ""
+}
+
+// ExitRulesFromConfig creates exit rules enabled in config.
+func ExitRulesFromConfig(cfg config.Trading) []ExitRule {
+	var rules []ExitRule
+
+	if cfg.TakeProfit > 0 {
+		rules = append(rules, TakeProfit(cfg.TakeProfit))
+	}
+
+	if cfg.StopLoss > 0 {
+		rules = append(rules, StopLoss(cfg.StopLoss))
+	}
+
+	if cfg.TrailingStop > 0 {
+		rules = append(rules, TrailingStop(cfg.TrailingStop))
+	}
+
+	if cfg.MaxHoldTime > 0 {
+		rules = append(rules, TimeExit(cfg.MaxHoldTime))
+	}
+
+	return rules
+}
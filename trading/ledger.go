@@ -0,0 +1,135 @@
+package trading
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// LedgerEntry is a summary of a single position.
+type LedgerEntry struct {
+	Token      string
+	AmmID      string
+	Status     PositionStatus
+	OpenTime   time.Time
+	CloseTime  time.Time
+	Cost       float64 // Lamports spent on entry.
+	Proceeds   float64 // Lamports received on exit.
+	PnL        float64 // Realized for closed positions, unrealized for open ones.
+	Return     float64 // PnL as a fraction of cost.
+	ExitReason string
+}
+
+// Ledger summarizes positions; statistics are calculated over closed positions only.
+type Ledger struct {
+	Entries     []LedgerEntry
+	Trades      int
+	Wins        int
+	WinRate     float64
+	TotalPnL    float64 // Lamports.
+	MaxDrawdown float64 // Largest drop of cumulative PnL from its peak, in lamports.
+}
+
+func NewLedger(positions []Position) Ledger {
+	sort.Slice(positions, func(i, j int) bool {
+		return positions[i].OpenTime.Before(positions[j].OpenTime)
+	})
+
+	var ledger Ledger
+	var closed []LedgerEntry
+
+	for i := range positions {
+		p := &positions[i]
+		entry := LedgerEntry{
+			Token:      p.Token.String(),
+			AmmID:      p.AmmID.String(),
+			Status:     p.Status,
+			OpenTime:   p.OpenTime,
+			CloseTime:  p.CloseTime,
+			Cost:       p.Cost,
+			Proceeds:   p.Proceeds,
+			PnL:        p.PnL(),
+			ExitReason: p.ExitReason,
+		}
+
+		if p.Cost > 0 {
+			entry.Return = entry.PnL / p.Cost
+		}
+
+		ledger.Entries = append(ledger.Entries, entry)
+		if p.Status == PositionClosed {
+			closed = append(closed, entry)
+		}
+	}
+
+	// Drawdown is measured on equity curve ordered by realization time.
+	sort.Slice(closed, func(i, j int) bool {
+		return closed[i].CloseTime.Before(closed[j].CloseTime)
+	})
+
+	var peak float64
+	for _, entry := range closed {
+		ledger.Trades++
+		if entry.PnL > 0 {
+			ledger.Wins++
+		}
+
+		ledger.TotalPnL += entry.PnL
+		if ledger.TotalPnL > peak {
+			peak = ledger.TotalPnL
+		}
+
+		if drawdown := peak - ledger.TotalPnL; drawdown > ledger.MaxDrawdown {
+			ledger.MaxDrawdown = drawdown
+		}
+	}
+
+	if ledger.Trades > 0 {
+		ledger.WinRate = float64(ledger.Wins) / float64(ledger.Trades)
+	}
+
+	return ledger
+}
+
+func (l Ledger) ExportJSON(path string) error {
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, 0644)
+}
+
+// ExportCSV writes ledger entries, one row per position.
+func (l Ledger) ExportCSV(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	w.Write([]string{"token", "ammid", "status", "open_time", "close_time", "cost", "proceeds", "pnl", "return", "exit_reason"})
+
+	formatTime := func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.Format(time.RFC3339Nano)
+	}
+
+	formatFloat := func(f float64) string {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+
+	for _, e := range l.Entries {
+		w.Write([]string{e.Token, e.AmmID, string(e.Status), formatTime(e.OpenTime), formatTime(e.CloseTime),
+			formatFloat(e.Cost), formatFloat(e.Proceeds), formatFloat(e.PnL), formatFloat(e.Return), e.ExitReason})
+	}
+
+	w.Flush()
+	return w.Error()
+}
@@ -0,0 +1,168 @@
+package trading
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/patrulek/rayscan/config"
+	"github.com/patrulek/rayscan/connection"
+	"github.com/patrulek/rayscan/onchain"
+)
+
+// PaperEngine enters published pairs according to entry rules with simulated fills.
+// Entered positions are handed over to PositionManager, which simulates exits.
+type PaperEngine struct {
+	rpcPool         *connection.RPCPool
+	positionManager *PositionManager
+	cfg             config.Trading
+
+	rulesMu sync.RWMutex
+	rules   []EntryRule
+
+	pairC chan *onchain.PairInfo
+	stopC chan struct{}
+	doneC chan struct{}
+
+	wg sync.WaitGroup // Pending entries.
+}
+
+func NewPaperEngine(rpcPool *connection.RPCPool, positionManager *PositionManager, cfg config.Trading) *PaperEngine {
+	return &PaperEngine{
+		rpcPool:         rpcPool,
+		positionManager: positionManager,
+		cfg:             cfg,
+		rules:           EntryRulesFromConfig(cfg),
+		pairC:           make(chan *onchain.PairInfo, 32),
+		stopC:           make(chan struct{}),
+		doneC:           make(chan struct{}),
+	}
+}
+
+// SetEntryRules replaces entry rules applied to pairs published from now on.
+func (e *PaperEngine) SetEntryRules(rules []EntryRule) {
+	e.rulesMu.Lock()
+	defer e.rulesMu.Unlock()
+
+	e.rules = rules
+}
+
+func (e *PaperEngine) Channel() chan<- *onchain.PairInfo {
+	return e.pairC
+}
+
+func (e *PaperEngine) Start() {
+	fmt.Printf("[%v] PaperEngine: starting (entry amount: %d, latency: %v)...\n", time.Now().Format("2006-01-02 15:04:05.000"), e.cfg.EntryAmount, e.cfg.Latency)
+
+	go func() {
+		defer close(e.doneC)
+		defer e.wg.Wait()
+
+		for {
+			select {
+			case <-e.stopC:
+				return
+			case pair := <-e.pairC:
+				if e.cfg.EntryAmount == 0 {
+					continue // Entries disabled.
+				}
+
+				e.wg.Add(1)
+				go e.enter(pair)
+			}
+		}
+	}()
+}
+
+func (e *PaperEngine) enter(pair *onchain.PairInfo) {
+	defer e.wg.Done()
+
+	tokenAddress := pair.TokenAddress()
+	if err := e.checkRules(pair, len(e.positionManager.OpenPositions())); err != nil {
+		fmt.Printf("[%v] PaperEngine: skip pair (token: %s): %s\n", time.Now().Format("2006-01-02 15:04:05.000"), tokenAddress, err)
+		return
+	}
+
+	// Pool cannot be swapped before its open time; wait for it and then simulate transaction latency.
+	wait := time.Until(pair.AmmInfo.InitialLiveInfo.UpdateTime)
+	if wait < 0 {
+		wait = 0
+	}
+
+	select {
+	case <-time.After(wait + e.cfg.Latency):
+	case <-e.stopC:
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	liveInfo, err := FetchLiveInfo(ctx, e.rpcPool, pair.AmmInfo.PoolCoinTokenAccount, pair.AmmInfo.PoolPcTokenAccount)
+	cancel()
+
+	if err != nil {
+		fmt.Printf("[%v] PaperEngine: error fetching reserves (token: %s): %s\n", time.Now().Format("2006-01-02 15:04:05.000"), tokenAddress, err)
+		return
+	}
+
+	pair.SetCurrentAmmLiveInfo(liveInfo)
+
+	// Rules are evaluated again, as they or open positions might have changed while waiting.
+	_, err = e.positionManager.Open(pair, float64(e.cfg.EntryAmount), e.entryRules())
+	if errors.Is(err, ErrEntryRejected) {
+		fmt.Printf("[%v] PaperEngine: skip pair (token: %s): %s\n", time.Now().Format("2006-01-02 15:04:05.000"), tokenAddress, err)
+	} else if err != nil {
+		fmt.Printf("[%v] PaperEngine: error opening position (token: %s): %s\n", time.Now().Format("2006-01-02 15:04:05.000"), tokenAddress, err)
+	}
+}
+
+func (e *PaperEngine) entryRules() []EntryRule {
+	e.rulesMu.RLock()
+	defer e.rulesMu.RUnlock()
+
+	return e.rules
+}
+
+// checkRules returns the first error of entry rules not passed by pair.
+func (e *PaperEngine) checkRules(pair *onchain.PairInfo, openPositions int) error {
+	for _, rule := range e.entryRules() {
+		if err := rule.Check(pair, openPositions, time.Now()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Ledger returns summary of all positions tracked by position manager.
+func (e *PaperEngine) Ledger() Ledger {
+	return NewLedger(e.positionManager.Positions())
+}
+
+// ExportLedger writes ledger as JSON and CSV files with base name taken from config.
+func (e *PaperEngine) ExportLedger() error {
+	ledger := e.Ledger()
+
+	if err := ledger.ExportJSON(e.cfg.LedgerFile + ".json"); err != nil {
+		return err
+	}
+
+	return ledger.ExportCSV(e.cfg.LedgerFile + ".csv")
+}
+
+// Stop stops entering pairs; channel isn't closed, as pairs may still be published to it.
+func (e *PaperEngine) Stop(ctx context.Context) error {
+	close(e.stopC)
+
+	select {
+	case <-e.doneC:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	ledger := e.Ledger()
+	fmt.Printf("[%v] PaperEngine: trades: %d, win rate: %.2f, pnl: %.0f, max drawdown: %.0f\n", time.Now().Format("2006-01-02 15:04:05.000"), ledger.Trades, ledger.WinRate, ledger.TotalPnL, ledger.MaxDrawdown)
+
+	return e.ExportLedger()
+}
@@ -0,0 +1,76 @@
+package trading
+
+import (
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/patrulek/rayscan/onchain/raydium"
+)
+
+type PositionStatus string
+
+const (
+	PositionOpen   PositionStatus = "open"
+	PositionClosed PositionStatus = "closed"
+)
+
+type Side string
+
+const (
+	SideBuy  Side = "buy"
+	SideSell Side = "sell"
+)
+
+// Fill is a single executed (or simulated in paper mode) swap of a position.
+type Fill struct {
+	Side      Side
+	Time      time.Time
+	AmountIn  float64 // Lamports for buy, tokens for sell.
+	AmountOut float64 // Tokens for buy, lamports for sell.
+	Paper     bool    // Whether fill was simulated.
+}
+
+// Position is a token holding entered through a Raydium pair.
+type Position struct {
+	Token           solana.PublicKey
+	AmmID           solana.PublicKey
+	TokenVault      solana.PublicKey // Amm token account (PoolCoinTokenAccount); used for reserve tracking.
+	CurrencyVault   solana.PublicKey // Amm WSOL account (PoolPcTokenAccount); used for reserve tracking.
+	Status          PositionStatus
+	OpenTime        time.Time
+	CloseTime       time.Time
+	Cost            float64 // Lamports spent on entry.
+	Size            float64 // Tokens held.
+	Proceeds        float64 // Lamports received on exit.
+	PeakValue       float64 // Highest observed value of position in lamports; used by trailing stop.
+	ExitReason      string
+	CurrentLiveInfo raydium.AmmLiveInfo // Last tracked reserves.
+	Fills           []Fill
+}
+
+// Value returns amount of lamports that selling whole position at last tracked reserves would give.
+func (p *Position) Value() float64 {
+	return p.CurrentLiveInfo.QuoteSell(p.Size)
+}
+
+// PnL returns realized profit for closed position, and unrealized one for open position.
+func (p *Position) PnL() float64 {
+	if p.Status == PositionClosed {
+		return p.Proceeds - p.Cost
+	}
+
+	return p.Value() - p.Cost
+}
+
+// SwapIntent describes a swap that should be executed for given position.
+// In paper mode intent is informational only; it is never signed nor sent.
+type SwapIntent struct {
+	AmmID        solana.PublicKey
+	InputMint    solana.PublicKey
+	OutputMint   solana.PublicKey
+	AmountIn     uint64
+	MinAmountOut uint64
+	Reason       string
+	Paper        bool
+	Timestamp    time.Time
+}
@@ -0,0 +1,374 @@
+package trading
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/patrulek/rayscan/config"
+	"github.com/patrulek/rayscan/connection"
+	"github.com/patrulek/rayscan/onchain"
+	"github.com/patrulek/rayscan/onchain/raydium"
+)
+
+// PositionManager tracks reserves of pools with open positions and closes them according to exit rules.
+// Only paper mode is supported: fills are simulated against constant product model and nothing is ever signed.
+type PositionManager struct {
+	rpcPool *connection.RPCPool
+	cfg     config.Trading
+	rules   []ExitRule
+
+	stopC chan struct{}
+	doneC chan struct{}
+
+	running atomic.Bool
+
+	mu        sync.RWMutex
+	positions map[solana.PublicKey]*Position // Token address -> position
+}
+
+func NewPositionManager(rpcPool *connection.RPCPool, cfg config.Trading) (*PositionManager, error) {
+	if !cfg.Paper {
+		return nil, fmt.Errorf("live trading is not supported; set paper mode")
+	}
+
+	return &PositionManager{
+		rpcPool:   rpcPool,
+		cfg:       cfg,
+		rules:     ExitRulesFromConfig(cfg),
+		stopC:     make(chan struct{}),
+		doneC:     make(chan struct{}),
+		positions: make(map[solana.PublicKey]*Position),
+	}, nil
+}
+
+func (m *PositionManager) Start(intentPublishC chan<- SwapIntent) error {
+	if !m.running.CompareAndSwap(false, true) {
+		return fmt.Errorf("PositionManager is already running")
+	}
+
+	if err := m.load(); err != nil {
+		return fmt.Errorf("error loading positions: %w", err)
+	}
+
+	fmt.Printf("[%v] PositionManager: starting (paper: %v, open positions: %d)...\n", time.Now().Format("2006-01-02 15:04:05.000"), m.cfg.Paper, len(m.OpenPositions()))
+
+	go func() {
+		defer close(m.doneC)
+
+		ticker := time.NewTicker(m.cfg.PollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-m.stopC:
+				return
+			case <-ticker.C:
+				m.evaluate(intentPublishC)
+			}
+		}
+	}()
+
+	return nil
+}
+
+// SetExitRules replaces exit rules of all open positions.
+func (m *PositionManager) SetExitRules(rules []ExitRule) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.rules = rules
+}
+
+// Open enters a position for given pair with given amount of lamports, if it passes given entry rules.
+// Rules are checked under the same lock the position is added with, so concurrent entries can't exceed MaxOpenPositions.
+func (m *PositionManager) Open(pair *onchain.PairInfo, lamportsIn float64, rules []EntryRule) (*Position, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tokenAddress := pair.TokenAddress()
+	if p, ok := m.positions[tokenAddress]; ok && p.Status == PositionOpen {
+		return nil, fmt.Errorf("position already open for token: %s", tokenAddress)
+	}
+
+	openPositions := 0
+	for _, p := range m.positions {
+		if p.Status == PositionOpen {
+			openPositions++
+		}
+	}
+
+	for _, rule := range rules {
+		if err := rule.Check(pair, openPositions, time.Now()); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrEntryRejected, err)
+		}
+	}
+
+	liveInfo := pair.GetCurrentAmmLiveInfo()
+	tokensOut := liveInfo.QuoteBuy(lamportsIn)
+	if tokensOut == 0 {
+		return nil, fmt.Errorf("no liquidity for token: %s", tokenAddress)
+	}
+
+	now := time.Now()
+	position := &Position{
+		Token:           tokenAddress,
+		AmmID:           pair.AmmInfo.AmmID,
+		TokenVault:      pair.AmmInfo.PoolCoinTokenAccount,
+		CurrencyVault:   pair.AmmInfo.PoolPcTokenAccount,
+		Status:          PositionOpen,
+		OpenTime:        now,
+		Cost:            lamportsIn,
+		Size:            tokensOut,
+		CurrentLiveInfo: liveInfo,
+		Fills:           []Fill{{Side: SideBuy, Time: now, AmountIn: lamportsIn, AmountOut: tokensOut, Paper: m.cfg.Paper}},
+	}
+	position.PeakValue = position.Value()
+
+	m.positions[tokenAddress] = position
+	if err := m.save(); err != nil {
+		fmt.Printf("[%v] PositionManager: error saving positions: %s\n", time.Now().Format("2006-01-02 15:04:05.000"), err)
+	}
+
+	fmt.Printf("[%v] PositionManager: opened position (token: %s, ammid: %s, cost: %.0f, size: %.0f)\n", time.Now().Format("2006-01-02 15:04:05.000"), tokenAddress, position.AmmID, position.Cost, position.Size)
+	return position, nil
+}
+
+// Positions returns copy of all tracked positions.
+func (m *PositionManager) Positions() []Position {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	positions := make([]Position, 0, len(m.positions))
+	for _, p := range m.positions {
+		positions = append(positions, *p)
+	}
+
+	return positions
+}
+
+// OpenPositions returns copy of positions that are not closed yet.
+func (m *PositionManager) OpenPositions() []Position {
+	var positions []Position
+	for _, p := range m.Positions() {
+		if p.Status == PositionOpen {
+			positions = append(positions, p)
+		}
+	}
+
+	return positions
+}
+
+func (m *PositionManager) evaluate(intentPublishC chan<- SwapIntent) {
+	for _, p := range m.OpenPositions() {
+		if err := m.track(p.Token, p.TokenVault, p.CurrencyVault); err != nil {
+			fmt.Printf("[%v] PositionManager: error fetching reserves (token: %s): %s\n", time.Now().Format("2006-01-02 15:04:05.000"), p.Token, err)
+			continue
+		}
+
+		reason := m.exitReason(p.Token)
+		if reason == "" {
+			continue
+		}
+
+		// Simulate time needed to build, send and land the transaction.
+		if m.cfg.Latency > 0 {
+			select {
+			case <-time.After(m.cfg.Latency):
+			case <-m.stopC:
+				return
+			}
+
+			if err := m.track(p.Token, p.TokenVault, p.CurrencyVault); err != nil {
+				fmt.Printf("[%v] PositionManager: error fetching reserves (token: %s): %s\n", time.Now().Format("2006-01-02 15:04:05.000"), p.Token, err)
+				continue
+			}
+		}
+
+		intent := m.close(p.Token, reason)
+
+		select {
+		case intentPublishC <- intent:
+		case <-m.stopC:
+			return
+		}
+	}
+}
+
+// track fetches current reserves of position's pool and updates position with them.
+func (m *PositionManager) track(tokenAddress, tokenVault, currencyVault solana.PublicKey) error {
+	ctx, cancel := context.WithTimeout(context.Background(), m.cfg.PollInterval)
+	defer cancel()
+
+	liveInfo, err := FetchLiveInfo(ctx, m.rpcPool, tokenVault, currencyVault)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	position := m.positions[tokenAddress]
+	position.CurrentLiveInfo = liveInfo
+
+	if value := position.Value(); value > position.PeakValue {
+		position.PeakValue = value
+	}
+
+	return nil
+}
+
+// exitReason returns reason of first met exit rule or empty string if position should be held.
+func (m *PositionManager) exitReason(tokenAddress solana.PublicKey) string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	position, now := m.positions[tokenAddress], time.Now()
+	for _, rule := range m.rules {
+		if exit, reason := rule.ShouldExit(position, now); exit {
+			return reason
+		}
+	}
+
+	return ""
+}
+
+// close sells whole position at last tracked reserves.
+func (m *PositionManager) close(tokenAddress solana.PublicKey, reason string) SwapIntent {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	position, now := m.positions[tokenAddress], time.Now()
+	lamportsOut := position.Value()
+	intent := SwapIntent{
+		AmmID:        position.AmmID,
+		InputMint:    position.Token,
+		OutputMint:   solana.WrappedSol,
+		AmountIn:     uint64(position.Size),
+		MinAmountOut: uint64(lamportsOut * (1 - m.cfg.Slippage)),
+		Reason:       reason,
+		Paper:        m.cfg.Paper,
+		Timestamp:    now,
+	}
+
+	position.Fills = append(position.Fills, Fill{Side: SideSell, Time: now, AmountIn: position.Size, AmountOut: lamportsOut, Paper: m.cfg.Paper})
+	position.Proceeds = lamportsOut
+	position.Status = PositionClosed
+	position.CloseTime = now
+	position.ExitReason = reason
+
+	if err := m.save(); err != nil {
+		fmt.Printf("[%v] PositionManager: error saving positions: %s\n", time.Now().Format("2006-01-02 15:04:05.000"), err)
+	}
+
+	fmt.Printf("[%v] PositionManager: closed position (token: %s, reason: %s, pnl: %.0f)\n", time.Now().Format("2006-01-02 15:04:05.000"), tokenAddress, reason, position.PnL())
+	return intent
+}
+
+// FetchLiveInfo reads current reserves of a pool from its token and currency vaults.
+func FetchLiveInfo(ctx context.Context, rpcPool *connection.RPCPool, tokenVault, currencyVault solana.PublicKey) (raydium.AmmLiveInfo, error) {
+	client, err := rpcPool.ClientFor(ctx, connection.RoleAccountReads)
+	if err != nil {
+		return raydium.AmmLiveInfo{}, err
+	}
+
+	tokenBalance, err := client.GetTokenAccountBalance(ctx, tokenVault, rpc.CommitmentProcessed)
+	if err != nil {
+		return raydium.AmmLiveInfo{}, err
+	}
+
+	currencyBalance, err := client.GetTokenAccountBalance(ctx, currencyVault, rpc.CommitmentProcessed)
+	if err != nil {
+		return raydium.AmmLiveInfo{}, err
+	}
+
+	if tokenBalance.Value == nil || currencyBalance.Value == nil {
+		return raydium.AmmLiveInfo{}, fmt.Errorf("no vault balance")
+	}
+
+	tokenReserve, err := strconv.ParseFloat(tokenBalance.Value.Amount, 64)
+	if err != nil {
+		return raydium.AmmLiveInfo{}, err
+	}
+
+	lamportReserve, err := strconv.ParseFloat(currencyBalance.Value.Amount, 64)
+	if err != nil {
+		return raydium.AmmLiveInfo{}, err
+	}
+
+	return raydium.AmmLiveInfo{
+		UpdateTime:     time.Now(),
+		PooledLamports: lamportReserve,
+		PooledToken:    tokenReserve,
+		Price:          tokenReserve / lamportReserve,
+	}, nil
+}
+
+// load reads positions from state file; missing file means no positions.
+func (m *PositionManager) load() error {
+	data, err := os.ReadFile(m.cfg.StateFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	var positions []*Position
+	if err := json.Unmarshal(data, &positions); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, p := range positions {
+		m.positions[p.Token] = p
+	}
+
+	return nil
+}
+
+// save writes all positions to state file. Caller has to hold the lock.
+func (m *PositionManager) save() error {
+	positions := make([]*Position, 0, len(m.positions))
+	for _, p := range m.positions {
+		positions = append(positions, p)
+	}
+
+	data, err := json.MarshalIndent(positions, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmpFile := m.cfg.StateFile + ".tmp"
+	if err := os.WriteFile(tmpFile, data, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpFile, m.cfg.StateFile)
+}
+
+func (m *PositionManager) Stop(ctx context.Context) error {
+	if !m.running.CompareAndSwap(true, false) {
+		return fmt.Errorf("PositionManager is not running")
+	}
+
+	close(m.stopC)
+
+	select {
+	case <-m.doneC:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}